@@ -12,6 +12,8 @@ import (
 type CrawlerHandler interface {
 	Attach(r *mux.Router)
 	HandleCrawl(w http.ResponseWriter, r *http.Request)
+	HandleDuplicates(w http.ResponseWriter, r *http.Request)
+	HandleCancel(w http.ResponseWriter, r *http.Request)
 }
 
 type crawlerHandler struct {
@@ -27,20 +29,37 @@ func NewCrawlerHandler(s service.CrawlerService) CrawlerHandler {
 
 // Attach attaches the crawler endpoints to the router
 func (h *crawlerHandler) Attach(r *mux.Router) {
-	r.HandleFunc("/crawl", h.HandleCrawl).Methods("GET", "OPTIONS")
+	r.HandleFunc("/crawl", h.HandleCrawl).Methods("GET", "POST", "OPTIONS")
+	r.HandleFunc("/crawl", h.HandleCancel).Methods("DELETE")
+	r.HandleFunc("/crawl/duplicates", h.HandleDuplicates).Methods("GET", "POST", "OPTIONS")
 }
 
-// HandleCrawl exposes the API to crawl a website
+// HandleCrawl exposes the API to crawl a website. The url can be sent as a query param, or in a POST body along with
+// the limits of the crawl. The recrawl param crawls the website again instead of returning the cached sitemap
 func (h *crawlerHandler) HandleCrawl(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
-	url := r.URL.Query().Get("url")
+	req := &model.Request{
+		Url:     r.URL.Query().Get("url"),
+		Recrawl: r.URL.Query().Get("recrawl") == "true",
+	}
+
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			log.Printf("error unmarshaling request: %s", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
 
-	res, err := h.Service.Crawl(r.Context(), url)
+	res, err := h.Service.Crawl(r.Context(), req)
 	if err != nil {
 		if err.Error() == service.UrlNotFound {
-			res = &model.Response{
-				Status: "accepted",
+			// The response of the service holds the request id, needed to follow the job and to cancel it
+			if res == nil {
+				res = &model.Response{
+					Status: "accepted",
+				}
 			}
 			w.WriteHeader(http.StatusAccepted)
 		} else {
@@ -61,3 +80,87 @@ func (h *crawlerHandler) HandleCrawl(w http.ResponseWriter, r *http.Request) {
 
 	w.Write(body)
 }
+
+// HandleDuplicates exposes the groups of pages with the same or nearly the same content found when crawling the url.
+// The url must have been crawled already with the same options, sent in a POST body as in the crawl API
+func (h *crawlerHandler) HandleDuplicates(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	req := &model.Request{
+		Url: r.URL.Query().Get("url"),
+	}
+
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			log.Printf("error unmarshaling request: %s", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	url := req.Url
+	if url == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.Service.GetDuplicates(r.Context(), req)
+	if err != nil {
+		if err.Error() == service.UrlNotFound {
+			res = &model.DuplicatesResponse{
+				Url:    url,
+				Status: "not crawled yet",
+			}
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			log.Printf("error getting duplicates: %s", err)
+			res = &model.DuplicatesResponse{
+				Url:    url,
+				Status: "error",
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	body, err := json.Marshal(res)
+	if err != nil {
+		log.Printf("error marshaling payload: %s", err)
+		return
+	}
+
+	w.Write(body)
+}
+
+// HandleCancel exposes the API to cancel a crawl job by its request id. The job ends with the pages crawled so far
+func (h *crawlerHandler) HandleCancel(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	reqId := r.URL.Query().Get("reqId")
+	if reqId == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	res := &model.Response{
+		Request: model.Request{ReqId: reqId},
+		Status:  "cancel requested",
+	}
+
+	if err := h.Service.Cancel(r.Context(), reqId); err != nil {
+		log.Printf("error cancelling crawl job: %s", err)
+		res.Status = "error"
+		w.WriteHeader(http.StatusInternalServerError)
+	} else {
+		w.WriteHeader(http.StatusAccepted)
+	}
+
+	body, err := json.Marshal(res)
+	if err != nil {
+		log.Printf("error marshaling payload: %s", err)
+		return
+	}
+
+	w.Write(body)
+}
@@ -9,6 +9,7 @@ import (
 	"net/http/httptest"
 	"server/internal/model"
 	mock_service "server/internal/service/mocks"
+	"strings"
 	"testing"
 
 	"github.com/golang/mock/gomock"
@@ -98,7 +99,38 @@ func TestCrawlerHandler_HandleCrawl(t *testing.T) {
 
 		rr := httptest.NewRecorder()
 
-		mockService.EXPECT().Crawl(gomock.Any(), gomock.Any()).Return(nil, errors.New(service.UrlNotFound))
+		expectedResponse := &model.Response{
+			Request: model.Request{ReqId: "test-req-id", Url: url},
+			Status:  "accepted for async processing",
+		}
+
+		mockService.EXPECT().Crawl(gomock.Any(), gomock.Any()).Return(expectedResponse, errors.New(service.UrlNotFound))
+
+		handler.HandleCrawl(rr, req)
+
+		if rr.Code != http.StatusAccepted {
+			t.Errorf("Expected status code %d, got %d", http.StatusAccepted, rr.Code)
+		}
+
+		expected, _ := json.Marshal(expectedResponse)
+		assert.Equal(t, expected, rr.Body.Bytes())
+	})
+
+	t.Run("Crawl With Limits", func(t *testing.T) {
+		body := strings.NewReader(fmt.Sprintf(`{"url":"%s","limits":{"maxDepth":2,"maxPages":100}}`, url))
+		req, err := http.NewRequest("POST", "/crawl", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		expectedRequest := &model.Request{
+			Url:    url,
+			Limits: &model.Limits{MaxDepth: 2, MaxPages: 100},
+		}
+
+		mockService.EXPECT().Crawl(gomock.Any(), expectedRequest).Return(nil, errors.New(service.UrlNotFound))
 
 		handler.HandleCrawl(rr, req)
 
@@ -107,6 +139,40 @@ func TestCrawlerHandler_HandleCrawl(t *testing.T) {
 		}
 	})
 
+	t.Run("Recrawl", func(t *testing.T) {
+		req, err := http.NewRequest("GET", fmt.Sprintf("/crawl?url=%s&recrawl=true", url), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		expectedRequest := &model.Request{Url: url, Recrawl: true}
+
+		mockService.EXPECT().Crawl(gomock.Any(), expectedRequest).Return(nil, errors.New(service.UrlNotFound))
+
+		handler.HandleCrawl(rr, req)
+
+		if rr.Code != http.StatusAccepted {
+			t.Errorf("Expected status code %d, got %d", http.StatusAccepted, rr.Code)
+		}
+	})
+
+	t.Run("Invalid Request Body", func(t *testing.T) {
+		req, err := http.NewRequest("POST", "/crawl", strings.NewReader("{"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		handler.HandleCrawl(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
 	t.Run("Error in Crawl", func(t *testing.T) {
 		req, err := http.NewRequest("GET", fmt.Sprintf("/crawl?url=%s", url), nil)
 		if err != nil {
@@ -126,3 +192,162 @@ func TestCrawlerHandler_HandleCrawl(t *testing.T) {
 		}
 	})
 }
+
+func TestCrawlerHandler_HandleDuplicates(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockService := mock_service.NewMockCrawlerService(ctrl)
+
+	handler := NewCrawlerHandler(mockService)
+
+	url := "https://parserdigital.com/"
+
+	t.Run("Successful Duplicates", func(t *testing.T) {
+		req, err := http.NewRequest("GET", fmt.Sprintf("/crawl/duplicates?url=%s", url), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		expectedResponse := &model.DuplicatesResponse{
+			Url: url,
+			Duplicates: []model.DuplicateCluster{{
+				Exact: true,
+				Urls:  []string{url + "career", url + "career?utm_source=home"},
+			}},
+			Status: "returned from cache",
+		}
+
+		mockService.EXPECT().GetDuplicates(gomock.Any(), &model.Request{Url: url}).Return(expectedResponse, nil)
+
+		handler.HandleDuplicates(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		expected, err := json.Marshal(expectedResponse)
+		if err != nil {
+			t.Errorf("Error marshaling expected response: %s", err)
+		}
+
+		assert.Equal(t, expected, rr.Body.Bytes())
+	})
+
+	t.Run("URL Not Crawled", func(t *testing.T) {
+		req, err := http.NewRequest("GET", fmt.Sprintf("/crawl/duplicates?url=%s", url), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		mockService.EXPECT().GetDuplicates(gomock.Any(), &model.Request{Url: url}).Return(nil, errors.New(service.UrlNotFound))
+
+		handler.HandleDuplicates(rr, req)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("Expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("Crawl Options", func(t *testing.T) {
+		body := strings.NewReader(fmt.Sprintf(`{"url":"%s","scope":{"mode":"domain"}}`, url))
+		req, err := http.NewRequest("POST", "/crawl/duplicates", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		expectedRequest := &model.Request{Url: url, Scope: &model.ScopeRules{Mode: "domain"}}
+		mockService.EXPECT().GetDuplicates(gomock.Any(), expectedRequest).Return(&model.DuplicatesResponse{Url: url}, nil)
+
+		handler.HandleDuplicates(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+
+	t.Run("Missing URL", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/crawl/duplicates", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		handler.HandleDuplicates(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
+
+func TestCrawlerHandler_HandleCancel(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockService := mock_service.NewMockCrawlerService(ctrl)
+
+	handler := NewCrawlerHandler(mockService)
+
+	t.Run("Cancel Requested", func(t *testing.T) {
+		req, err := http.NewRequest("DELETE", "/crawl?reqId=test-req-id", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		mockService.EXPECT().Cancel(gomock.Any(), "test-req-id").Return(nil)
+
+		handler.HandleCancel(rr, req)
+
+		if rr.Code != http.StatusAccepted {
+			t.Errorf("Expected status code %d, got %d", http.StatusAccepted, rr.Code)
+		}
+
+		expected, _ := json.Marshal(&model.Response{
+			Request: model.Request{ReqId: "test-req-id"},
+			Status:  "cancel requested",
+		})
+		assert.Equal(t, expected, rr.Body.Bytes())
+	})
+
+	t.Run("Missing Request Id", func(t *testing.T) {
+		req, err := http.NewRequest("DELETE", "/crawl", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		handler.HandleCancel(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("Error in Cancel", func(t *testing.T) {
+		req, err := http.NewRequest("DELETE", "/crawl?reqId=test-req-id", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		mockService.EXPECT().Cancel(gomock.Any(), "test-req-id").Return(errors.New("test error"))
+
+		handler.HandleCancel(rr, req)
+
+		if rr.Code != http.StatusInternalServerError {
+			t.Errorf("Expected status code %d, got %d", http.StatusInternalServerError, rr.Code)
+		}
+	})
+}
@@ -47,6 +47,18 @@ func (mr *MockCrawlerHandlerMockRecorder) Attach(r interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Attach", reflect.TypeOf((*MockCrawlerHandler)(nil).Attach), r)
 }
 
+// HandleCancel mocks base method.
+func (m *MockCrawlerHandler) HandleCancel(w http.ResponseWriter, r *http.Request) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "HandleCancel", w, r)
+}
+
+// HandleCancel indicates an expected call of HandleCancel.
+func (mr *MockCrawlerHandlerMockRecorder) HandleCancel(w, r interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HandleCancel", reflect.TypeOf((*MockCrawlerHandler)(nil).HandleCancel), w, r)
+}
+
 // HandleCrawl mocks base method.
 func (m *MockCrawlerHandler) HandleCrawl(w http.ResponseWriter, r *http.Request) {
 	m.ctrl.T.Helper()
@@ -58,3 +70,15 @@ func (mr *MockCrawlerHandlerMockRecorder) HandleCrawl(w, r interface{}) *gomock.
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HandleCrawl", reflect.TypeOf((*MockCrawlerHandler)(nil).HandleCrawl), w, r)
 }
+
+// HandleDuplicates mocks base method.
+func (m *MockCrawlerHandler) HandleDuplicates(w http.ResponseWriter, r *http.Request) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "HandleDuplicates", w, r)
+}
+
+// HandleDuplicates indicates an expected call of HandleDuplicates.
+func (mr *MockCrawlerHandlerMockRecorder) HandleDuplicates(w, r interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HandleDuplicates", reflect.TypeOf((*MockCrawlerHandler)(nil).HandleDuplicates), w, r)
+}
@@ -74,7 +74,8 @@ func (h *wsHandler) readMessages(conn *websocket.Conn) {
 	}
 }
 
-// ProcessCrawledUrls watches for messages in the broadcast channel and send them to the corresponding clients
+// ProcessCrawledUrls watches for messages in the broadcast channel and send them to the corresponding clients. The page
+// events of a job are streamed to its client as they come, followed by the result with the complete sitemap
 func (h *wsHandler) ProcessCrawledUrls(ctx context.Context) {
 	broadcast := make(chan []byte)
 	go h.Service.ConsumeFromResponseQueue(ctx, broadcast)
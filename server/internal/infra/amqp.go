@@ -11,6 +11,7 @@ import (
 type AMQPClient interface {
 	SetupAMQExchange() error
 	PublishAMQMessage(message []byte) error
+	PublishAMQCancel(message []byte) error
 	ConsumeAMQMessages() (<-chan amqp.Delivery, error)
 }
 
@@ -18,6 +19,7 @@ const (
 	exchangeName = "parser-crawler"
 	reqKey       = "messages.request"
 	resKey       = "messages.response"
+	cancelKey    = "messages.cancel"
 	queueName    = "parser-crawler-res-queue"
 )
 
@@ -69,6 +71,19 @@ func (c *amqpClient) PublishAMQMessage(message []byte) error {
 	return nil
 }
 
+// PublishAMQCancel publishes a cancel command to the amq exchange, where every worker receives it
+func (c *amqpClient) PublishAMQCancel(message []byte) error {
+	msg := amqp.Publishing{
+		ContentType: "text/plain",
+		Body:        message,
+	}
+	if err := c.Ch.Publish(exchangeName, cancelKey, false, false, msg); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // ConsumeAMQMessages returns the messages from the subscribed queue
 func (c *amqpClient) ConsumeAMQMessages() (<-chan amqp.Delivery, error) {
 	q, err := c.Ch.QueueDeclare(queueName, false, false, false, false, nil)
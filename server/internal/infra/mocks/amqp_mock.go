@@ -49,6 +49,20 @@ func (mr *MockAMQPClientMockRecorder) ConsumeAMQMessages() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeAMQMessages", reflect.TypeOf((*MockAMQPClient)(nil).ConsumeAMQMessages))
 }
 
+// PublishAMQCancel mocks base method.
+func (m *MockAMQPClient) PublishAMQCancel(message []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PublishAMQCancel", message)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PublishAMQCancel indicates an expected call of PublishAMQCancel.
+func (mr *MockAMQPClientMockRecorder) PublishAMQCancel(message interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PublishAMQCancel", reflect.TypeOf((*MockAMQPClient)(nil).PublishAMQCancel), message)
+}
+
 // PublishAMQMessage mocks base method.
 func (m *MockAMQPClient) PublishAMQMessage(message []byte) error {
 	m.ctrl.T.Helper()
@@ -1,16 +1,208 @@
 package model
 
 type Request struct {
-	ReqId string `json:"reqId,omitempty"`
-	Url   string `json:"url,omitempty"`
+	ReqId      string            `json:"reqId,omitempty"`
+	Url        string            `json:"url,omitempty"`
+	Limits     *Limits           `json:"limits,omitempty"`
+	Canonical  *CanonicalRules   `json:"canonical,omitempty"`
+	Scope      *ScopeRules       `json:"scope,omitempty"`
+	Fetch      *FetchOptions     `json:"fetch,omitempty"`
+	Retry      *RetryOptions     `json:"retry,omitempty"`
+	Follow     *FollowRules      `json:"follow,omitempty"`
+	Directives *DirectivesPolicy `json:"directives,omitempty"`
+	// Distributed spreads the pages of the job over all the workers instead of crawling them in a single one
+	Distributed bool `json:"distributed,omitempty"`
+	// Recrawl crawls the url again instead of returning the cached sitemap, only downloading the pages changed since
+	// the previous crawl of the site with the same options
+	Recrawl bool `json:"recrawl,omitempty"`
+}
+
+// Limits bounds the size of a crawl job. A zero value means there is no limit
+type Limits struct {
+	MaxDepth   int   `json:"maxDepth,omitempty"`
+	MaxPages   int   `json:"maxPages,omitempty"`
+	MaxBytes   int64 `json:"maxBytes,omitempty"`
+	MaxSeconds int   `json:"maxSeconds,omitempty"`
+}
+
+// CanonicalRules configures the optional steps of the url canonicalization. Fragments, scheme and host case, default
+// ports, dot segments and internationalized hosts are always normalized
+type CanonicalRules struct {
+	SortQuery     bool   `json:"sortQuery,omitempty"`
+	TrailingSlash string `json:"trailingSlash,omitempty"`
+}
+
+// ScopeRules configures which urls belong to a crawl job. Hosts is the allow-list used by the "hosts" mode
+type ScopeRules struct {
+	Mode  string   `json:"mode,omitempty"`
+	Hosts []string `json:"hosts,omitempty"`
+}
+
+// FetchOptions overrides the HTTP settings of the worker for a crawl job. Timeouts are in seconds, and the proxy must
+// be one of the proxies allowed by the worker
+type FetchOptions struct {
+	UserAgent      string            `json:"userAgent,omitempty"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	ConnectTimeout int               `json:"connectTimeout,omitempty"`
+	ReadTimeout    int               `json:"readTimeout,omitempty"`
+	Timeout        int               `json:"timeout,omitempty"`
+	Proxy          string            `json:"proxy,omitempty"`
+	MaxRedirects   *int              `json:"maxRedirects,omitempty"`
+}
+
+// RetryOptions overrides the retry policy of the worker for a crawl job. MaxRetries is the number of retries of each
+// page and MaxTotalRetries the number of retries of the whole job
+type RetryOptions struct {
+	MaxRetries      *int `json:"maxRetries,omitempty"`
+	MaxTotalRetries *int `json:"maxTotalRetries,omitempty"`
+}
+
+// FollowRules configures the kinds of links the crawler follows. Only navigation links are followed by default
+type FollowRules struct {
+	Kinds []string `json:"kinds,omitempty"`
+}
+
+// DirectivesPolicy configures which nofollow directives the crawler ignores. By default it does not follow the
+// rel="nofollow" links nor the links of pages with a nofollow robots meta tag or X-Robots-Tag header
+type DirectivesPolicy struct {
+	IgnoreNofollowLinks bool `json:"ignoreNofollowLinks,omitempty"`
+	IgnoreMetaRobots    bool `json:"ignoreMetaRobots,omitempty"`
+}
+
+// Link is a url found in a page, with the element it comes from and its kind
+type Link struct {
+	Url      string `json:"url"`
+	Element  string `json:"element"`
+	Kind     string `json:"kind"`
+	Nofollow bool   `json:"nofollow,omitempty"`
+}
+
+// PageError is a page that could not be crawled, with the error of its last attempt
+type PageError struct {
+	Url   string `json:"url"`
+	Error string `json:"error"`
+}
+
+// PageInfo is the metadata of a crawled page. ResponseTime is the time in milliseconds to receive the response
+// headers, Error is set when the page could not be crawled, and Noindex and Nofollow report the robots directives
+// of the page. Canonical is its <link rel="canonical">, and ContentHash and SimHash identify its text. ETag and
+// LastModified are the validators sent by the server, and NotModified is set when the page was reused from the previous
+// crawl after a 304 response
+type PageInfo struct {
+	Status        int           `json:"status,omitempty"`
+	FinalUrl      string        `json:"finalUrl,omitempty"`
+	ContentType   string        `json:"contentType,omitempty"`
+	Charset       string        `json:"charset,omitempty"`
+	ContentLength int64         `json:"contentLength,omitempty"`
+	ResponseTime  int64         `json:"responseTime,omitempty"`
+	Depth         int           `json:"depth"`
+	Title         string        `json:"title,omitempty"`
+	Error         string        `json:"error,omitempty"`
+	Redirects     []RedirectHop `json:"redirects,omitempty"`
+	Noindex       bool          `json:"noindex,omitempty"`
+	Nofollow      bool          `json:"nofollow,omitempty"`
+	Canonical     string        `json:"canonical,omitempty"`
+	ContentHash   string        `json:"contentHash,omitempty"`
+	SimHash       string        `json:"simHash,omitempty"`
+	ETag          string        `json:"etag,omitempty"`
+	LastModified  string        `json:"lastModified,omitempty"`
+	NotModified   bool          `json:"notModified,omitempty"`
+}
+
+// DuplicateCluster is a group of pages with the same or nearly the same content. Exact is set when all of them have
+// the same content hash, and Canonical is the url they declare as canonical when they agree on one
+type DuplicateCluster struct {
+	Canonical string   `json:"canonical,omitempty"`
+	Exact     bool     `json:"exact"`
+	Urls      []string `json:"urls"`
+}
+
+// RedirectHop is a redirect received while fetching a page, with its Location resolved to an absolute url
+type RedirectHop struct {
+	Url      string `json:"url"`
+	Status   int    `json:"status"`
+	Location string `json:"location"`
+}
+
+// RedirectIssue lists the problems found in the redirect chain of a requested url
+type RedirectIssue struct {
+	Url    string   `json:"url"`
+	Issues []string `json:"issues"`
+}
+
+// Outcomes of a crawl job
+const (
+	OutcomeSucceeded = "succeeded"
+	OutcomePartial   = "partial"
+	OutcomeFailed    = "failed"
+	OutcomeCancelled = "cancelled"
+)
+
+// EventResult is the type of the message with the complete sitemap of a crawl job. The other messages are page events
+// published by the workers while the job runs
+const EventResult = "result"
+
+// CancelCommand asks the workers to stop the crawl job with the request id
+type CancelCommand struct {
+	ReqId string `json:"reqId"`
 }
 
 type Response struct {
 	Request
 	Sitemap
+	Type   string `json:"type,omitempty"`
 	Status string `json:"status"`
 }
 
+// DuplicatesResponse holds the duplicate clusters found in the cached sitemap of a url
+type DuplicatesResponse struct {
+	Url        string             `json:"url"`
+	Duplicates []DuplicateCluster `json:"duplicates"`
+	Status     string             `json:"status"`
+}
+
 type Sitemap struct {
 	Pages map[string][]string `json:"pages"`
+	// PageInfo holds the metadata of the visited and failed pages, keyed by the same urls as pages
+	PageInfo    map[string]PageInfo `json:"pageInfo,omitempty"`
+	Disallowed  []string            `json:"disallowed,omitempty"`
+	Truncated   bool                `json:"truncated,omitempty"`
+	TruncatedBy string              `json:"truncatedBy,omitempty"`
+	// Outcome is failed when the seed url or the job itself could not be crawled, partial when some other pages failed,
+	// cancelled when the job was cancelled before finishing and succeeded otherwise
+	Outcome string `json:"outcome,omitempty"`
+	// Attempted counts the pages requested and Succeeded the ones crawled without errors
+	Attempted int `json:"attempted"`
+	Succeeded int `json:"succeeded"`
+	// Links are all the links in scope found in each page, classified by element and kind. Pages only holds the
+	// followed ones
+	Links map[string][]Link `json:"links,omitempty"`
+	// Noindex are the crawled pages that ask not to be indexed with a robots meta tag or X-Robots-Tag header
+	Noindex []string `json:"noindex,omitempty"`
+	// Duplicates are the groups of pages with the same canonical url or the same or nearly the same content
+	Duplicates []DuplicateCluster `json:"duplicates,omitempty"`
+	// Orphans are the pages listed in sitemap.xml that are never linked from the crawled pages
+	Orphans []string `json:"orphans,omitempty"`
+	// MissingFromSitemap are the linked pages that are not listed in sitemap.xml
+	MissingFromSitemap []string `json:"missingFromSitemap,omitempty"`
+	// Errors are the pages that could not be crawled or were answered with an error status, and the errors that
+	// prevented the job from starting
+	Errors []PageError `json:"errors,omitempty"`
+	// RedirectIssues are the requested urls whose redirect chain loops, is too long or goes from https to http
+	RedirectIssues []RedirectIssue `json:"redirectIssues,omitempty"`
+	// Resources are the urls in scope that are not HTML pages, with their media type. They are leaf nodes in pages
+	Resources map[string]string `json:"resources,omitempty"`
+	// Changes compares the pages with the previous crawl of the site, when there is one
+	Changes *Changes `json:"changes,omitempty"`
+}
+
+// Changes are the pages that changed, were unchanged, were added and disappeared since the previous crawl of the site,
+// crawled at Since. Disappeared are the pages no longer found or answered with an error status, and they are not
+// reported when the crawl was truncated or cancelled
+type Changes struct {
+	Since       string   `json:"since"`
+	Changed     []string `json:"changed"`
+	Unchanged   []string `json:"unchanged"`
+	Added       []string `json:"added"`
+	Disappeared []string `json:"disappeared"`
 }
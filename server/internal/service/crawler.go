@@ -2,6 +2,8 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,7 +15,9 @@ import (
 )
 
 type CrawlerService interface {
-	Crawl(ctx context.Context, url string) (*model.Response, error)
+	Crawl(ctx context.Context, req *model.Request) (*model.Response, error)
+	GetDuplicates(ctx context.Context, req *model.Request) (*model.DuplicatesResponse, error)
+	Cancel(ctx context.Context, reqId string) error
 	ConsumeFromResponseQueue(ctx context.Context, broadcast chan []byte)
 }
 
@@ -32,12 +36,22 @@ func NewCrawlerService(crawlerRepo repo.CrawlerRepo, amqpClient infra.AMQPClient
 
 const UrlNotFound = "url not found in cache"
 
-// Crawl gets the crawled url data from the cache.
-// If there is a cache miss, it publishes the url to the request queue to be processed by the workers
-func (s *crawlService) Crawl(ctx context.Context, url string) (*model.Response, error) {
-	reqId := uuid.New().String()
+// Crawl gets the crawled url data from the cache, under the key of the url and the options of the request.
+// If there is a cache miss, it publishes the url to the request queue to be processed by the workers. Recrawl
+// requests skip the cache, and the workers only download the pages changed since the previous crawl
+func (s *crawlService) Crawl(ctx context.Context, req *model.Request) (*model.Response, error) {
+	req.ReqId = uuid.New().String()
 
-	data, err := s.CrawlerRepo.GetUrl(ctx, url)
+	if req.Recrawl {
+		go s.publishToRequestQueue(*req)
+
+		return &model.Response{
+			Request: *req,
+			Status:  "accepted for async processing",
+		}, errors.New(UrlNotFound)
+	}
+
+	data, err := s.CrawlerRepo.GetUrl(ctx, cacheKey(req))
 	if err == nil {
 		log.Printf("data returned from cache: %s...\n", data)
 
@@ -56,24 +70,87 @@ func (s *crawlService) Crawl(ctx context.Context, url string) (*model.Response,
 		return nil, errors.New(fmt.Sprintf("error getting url from cache: %s", err))
 	}
 
-	go s.publishToRequestQueue(url, reqId)
+	go s.publishToRequestQueue(*req)
 
 	return &model.Response{
-		Request: model.Request{
-			ReqId: reqId,
-			Url:   url,
-		},
-		Status: "accepted for async processing",
+		Request: *req,
+		Status:  "accepted for async processing",
 	}, errors.New(UrlNotFound)
 }
 
-// publishToRequestQueue publishes the url to the request queue to be processed by the workers
-func (s *crawlService) publishToRequestQueue(url string, reqId string) {
-	req := model.Request{
-		Url:   url,
-		ReqId: reqId,
+// GetDuplicates gets the groups of duplicate pages from the sitemap cached for the url and the options of the request.
+// It does not start a crawl when the sitemap is not in the cache
+func (s *crawlService) GetDuplicates(ctx context.Context, req *model.Request) (*model.DuplicatesResponse, error) {
+	data, err := s.CrawlerRepo.GetUrl(ctx, cacheKey(req))
+	if err != nil {
+		if err.Error() == repo.KeyNotFound {
+			return nil, errors.New(UrlNotFound)
+		}
+		return nil, errors.New(fmt.Sprintf("error getting url from cache: %s", err))
+	}
+
+	res := &model.Response{}
+	if err := json.Unmarshal([]byte(data), res); err != nil {
+		return nil, errors.New(fmt.Sprintf("error unmarshaling payload: %s", err))
+	}
+
+	duplicates := res.Duplicates
+	if duplicates == nil {
+		duplicates = []model.DuplicateCluster{}
+	}
+
+	return &model.DuplicatesResponse{
+		Url:        req.Url,
+		Duplicates: duplicates,
+		Status:     "returned from cache",
+	}, nil
+}
+
+// Cancel sends a cancel command for the crawl job to the workers. The job ends with the pages crawled so far, which
+// are sent to the clients with the cancelled status
+func (s *crawlService) Cancel(ctx context.Context, reqId string) error {
+	body, err := json.Marshal(&model.CancelCommand{ReqId: reqId})
+	if err != nil {
+		return errors.New(fmt.Sprintf("error marshaling cancel command: %s", err))
+	}
+
+	if err = s.AMQPClient.SetupAMQExchange(); err != nil {
+		return errors.New(fmt.Sprintf("error setting up the amq connection and exchange: %s", err))
 	}
 
+	if err := s.AMQPClient.PublishAMQCancel(body); err != nil {
+		return errors.New(fmt.Sprintf("error publishing cancel command: %s", err))
+	}
+
+	log.Printf("publishing cancel command: %s\n", body)
+
+	return nil
+}
+
+// cacheKey returns the key of the sitemap of the request in the cache. The sitemaps crawled with options that change
+// the result are cached apart from the default crawl of the url, under a hash of those options
+func cacheKey(req *model.Request) string {
+	options := struct {
+		Limits     *model.Limits           `json:"limits,omitempty"`
+		Canonical  *model.CanonicalRules   `json:"canonical,omitempty"`
+		Scope      *model.ScopeRules       `json:"scope,omitempty"`
+		Fetch      *model.FetchOptions     `json:"fetch,omitempty"`
+		Retry      *model.RetryOptions     `json:"retry,omitempty"`
+		Follow     *model.FollowRules      `json:"follow,omitempty"`
+		Directives *model.DirectivesPolicy `json:"directives,omitempty"`
+	}{req.Limits, req.Canonical, req.Scope, req.Fetch, req.Retry, req.Follow, req.Directives}
+
+	data, err := json.Marshal(options)
+	if err != nil || string(data) == "{}" {
+		return req.Url
+	}
+
+	hash := sha256.Sum256(data)
+	return req.Url + "#" + hex.EncodeToString(hash[:])
+}
+
+// publishToRequestQueue publishes the url to the request queue to be processed by the workers
+func (s *crawlService) publishToRequestQueue(req model.Request) {
 	body, err := json.Marshal(req)
 	if err != nil {
 		log.Printf("error marshaling request: %s", err)
@@ -93,7 +170,8 @@ func (s *crawlService) publishToRequestQueue(url string, reqId string) {
 	log.Printf("publishing url to the request queue: %s\n", body)
 }
 
-// ConsumeFromResponseQueue consumes messages from the response queue and pushes them to the broadcast channel
+// ConsumeFromResponseQueue consumes the page events and results of the crawl jobs from the response queue and pushes
+// them to the broadcast channel
 func (s *crawlService) ConsumeFromResponseQueue(ctx context.Context, broadcast chan []byte) {
 	if err := s.AMQPClient.SetupAMQExchange(); err != nil {
 		log.Printf("error setting up the amq connection and exchange: %s", err)
@@ -106,16 +184,40 @@ func (s *crawlService) ConsumeFromResponseQueue(ctx context.Context, broadcast c
 		return
 	}
 
-	res := &model.Response{}
-
 	for msg := range messages {
+		res := &model.Response{}
 		if err := json.Unmarshal(msg.Body, res); err != nil {
 			log.Printf("error unmarshaling response: %s", err)
 			return
 		}
 
-		// Store the URL in the cache before sending it to the broadcast channel
-		s.CrawlerRepo.StoreUrl(ctx, res.Url, string(msg.Body))
+		// Page events are forwarded as they come, only the final result of a job is cached
+		if res.Type != "" && res.Type != model.EventResult {
+			broadcast <- msg.Body
+			continue
+		}
+
+		// Failed and cancelled jobs are not cached so the next request crawls the url again, and the clients are told
+		// how the job ended
+		if res.Outcome == model.OutcomeFailed || res.Outcome == model.OutcomeCancelled {
+			log.Printf("crawl of %s %s: %v", res.Url, res.Outcome, res.Errors)
+
+			res.Status = res.Outcome
+			body, err := json.Marshal(res)
+			if err != nil {
+				log.Printf("error marshaling response: %s", err)
+				continue
+			}
+
+			broadcast <- body
+			continue
+		}
+
+		// Store the URL in the cache before sending it to the broadcast channel. Truncated sitemaps are not cached
+		// since they depend on the limits of the request
+		if !res.Truncated {
+			s.CrawlerRepo.StoreUrl(ctx, cacheKey(&res.Request), string(msg.Body))
+		}
 
 		broadcast <- msg.Body
 	}
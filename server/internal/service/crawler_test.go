@@ -6,6 +6,7 @@ import (
 	"errors"
 	"github.com/golang/mock/gomock"
 	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
 	mock_infra "server/internal/infra/mocks"
 	"server/internal/model"
 	"server/internal/repo"
@@ -33,7 +34,7 @@ func TestCrawlService_Crawl(t *testing.T) {
 
 		mockRepo.EXPECT().GetUrl(ctx, testURL).Return(string(data), nil)
 
-		response, err := service.Crawl(ctx, testURL)
+		response, err := service.Crawl(ctx, &model.Request{Url: testURL})
 		if err != nil {
 			t.Errorf("Expected no error, got: %v", err)
 		}
@@ -46,7 +47,7 @@ func TestCrawlService_Crawl(t *testing.T) {
 	t.Run("URL Not Found in Cache", func(t *testing.T) {
 		mockRepo.EXPECT().GetUrl(ctx, testURL).Return("", errors.New(repo.KeyNotFound))
 
-		response, err := service.Crawl(ctx, testURL)
+		response, err := service.Crawl(ctx, &model.Request{Url: testURL})
 		if err != nil && err.Error() != UrlNotFound {
 			t.Errorf("Expected error: %v, got: %v", errors.New(UrlNotFound), err)
 		}
@@ -60,12 +61,44 @@ func TestCrawlService_Crawl(t *testing.T) {
 		}()
 	})
 
+	t.Run("Recrawl Skips The Cache", func(t *testing.T) {
+		// The client is not shared with the other cases, which publish asynchronously
+		mockRecrawlClient := mock_infra.NewMockAMQPClient(ctrl)
+		service := NewCrawlerService(mockRepo, mockRecrawlClient)
+
+		published := make(chan []byte, 1)
+		mockRecrawlClient.EXPECT().SetupAMQExchange().Return(nil)
+		mockRecrawlClient.EXPECT().PublishAMQMessage(gomock.Any()).DoAndReturn(func(body []byte) error {
+			published <- body
+			return nil
+		})
+
+		response, err := service.Crawl(ctx, &model.Request{Url: testURL, Recrawl: true})
+
+		assert.EqualError(t, err, UrlNotFound)
+		assert.True(t, response.Recrawl)
+
+		req := &model.Request{}
+		assert.NoError(t, json.Unmarshal(<-published, req))
+		assert.True(t, req.Recrawl)
+		assert.Equal(t, response.ReqId, req.ReqId)
+	})
+
+	t.Run("Options Cached Apart", func(t *testing.T) {
+		req := &model.Request{Url: testURL, Scope: &model.ScopeRules{Mode: "subdomains"}}
+		mockRepo.EXPECT().GetUrl(ctx, cacheKey(req)).Return(`{"pages":{}}`, nil)
+
+		_, err := service.Crawl(ctx, req)
+
+		assert.NoError(t, err)
+	})
+
 	t.Run("Error Getting URL from Cache", func(t *testing.T) {
 		expectedError := errors.New("some error")
 
 		mockRepo.EXPECT().GetUrl(ctx, testURL).Return("", expectedError)
 
-		response, err := service.Crawl(ctx, testURL)
+		response, err := service.Crawl(ctx, &model.Request{Url: testURL})
 
 		if err.Error() != "error getting url from cache: some error" {
 			t.Errorf("Expected error: %s, got: %s", "error getting url from cache: some error", err.Error())
@@ -76,6 +109,105 @@ func TestCrawlService_Crawl(t *testing.T) {
 	})
 }
 
+func TestCacheKey(t *testing.T) {
+	url := "https://parserdigital.com/"
+
+	tests := []struct {
+		name  string
+		req   *model.Request
+		plain bool
+	}{
+		{name: "Default Crawl", req: &model.Request{Url: url}, plain: true},
+		{name: "Distributed", req: &model.Request{Url: url, Distributed: true}, plain: true},
+		{name: "Recrawl", req: &model.Request{Url: url, Recrawl: true}, plain: true},
+		{name: "Limits", req: &model.Request{Url: url, Limits: &model.Limits{MaxPages: 10}}},
+		{name: "Scope", req: &model.Request{Url: url, Scope: &model.ScopeRules{Mode: "subdomains"}}},
+		{name: "Canonical", req: &model.Request{Url: url, Canonical: &model.CanonicalRules{SortQuery: true}}},
+		{name: "Fetch", req: &model.Request{Url: url, Fetch: &model.FetchOptions{UserAgent: "Bot/2.0"}}},
+		{name: "Follow", req: &model.Request{Url: url, Follow: &model.FollowRules{Kinds: []string{"asset"}}}},
+		{name: "Directives", req: &model.Request{Url: url, Directives: &model.DirectivesPolicy{IgnoreMetaRobots: true}}},
+	}
+
+	keys := make(map[string]string)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key := cacheKey(test.req)
+
+			if test.plain {
+				assert.Equal(t, url, key)
+				return
+			}
+
+			assert.Contains(t, key, url+"#")
+			assert.NotContains(t, keys, key, "same key as another request")
+			assert.Equal(t, key, cacheKey(test.req))
+			keys[key] = test.name
+		})
+	}
+}
+
+func TestCrawlService_GetDuplicates(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mock_repo.NewMockCrawlerRepo(ctrl)
+	mockAMQPClient := mock_infra.NewMockAMQPClient(ctrl)
+
+	service := NewCrawlerService(mockRepo, mockAMQPClient)
+
+	ctx := context.Background()
+	testURL := "https://parsedigital.com/"
+
+	t.Run("URL Found in Cache", func(t *testing.T) {
+		clusters := []model.DuplicateCluster{{
+			Canonical: testURL + "career",
+			Exact:     true,
+			Urls:      []string{testURL + "career", testURL + "career?utm_source=home"},
+		}}
+		data, _ := json.Marshal(&model.Response{Sitemap: model.Sitemap{Duplicates: clusters}})
+
+		mockRepo.EXPECT().GetUrl(ctx, testURL).Return(string(data), nil)
+
+		response, err := service.GetDuplicates(ctx, &model.Request{Url: testURL})
+		if err != nil {
+			t.Errorf("Expected no error, got: %v", err)
+		}
+
+		assert.Equal(t, testURL, response.Url)
+		assert.Equal(t, clusters, response.Duplicates)
+	})
+
+	t.Run("No Duplicates", func(t *testing.T) {
+		mockRepo.EXPECT().GetUrl(ctx, testURL).Return(`{"pages":{}}`, nil)
+
+		response, err := service.GetDuplicates(ctx, &model.Request{Url: testURL})
+		if err != nil {
+			t.Errorf("Expected no error, got: %v", err)
+		}
+
+		assert.Equal(t, []model.DuplicateCluster{}, response.Duplicates)
+	})
+
+	t.Run("Crawl Options", func(t *testing.T) {
+		req := &model.Request{Url: testURL, Scope: &model.ScopeRules{Mode: "domain"}}
+		mockRepo.EXPECT().GetUrl(ctx, cacheKey(req)).Return(`{"pages":{}}`, nil)
+
+		response, err := service.GetDuplicates(ctx, req)
+
+		assert.NoError(t, err)
+		assert.Equal(t, testURL, response.Url)
+	})
+
+	t.Run("URL Not Found in Cache", func(t *testing.T) {
+		mockRepo.EXPECT().GetUrl(ctx, testURL).Return("", errors.New(repo.KeyNotFound))
+
+		response, err := service.GetDuplicates(ctx, &model.Request{Url: testURL})
+
+		assert.EqualError(t, err, UrlNotFound)
+		assert.Nil(t, response)
+	})
+}
+
 func TestCrawlService_ConsumeFromResponseQueue(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -111,6 +243,161 @@ func TestCrawlService_ConsumeFromResponseQueue(t *testing.T) {
 	}
 }
 
+func TestCrawlService_ConsumeFromResponseQueue_Failed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mock_repo.NewMockCrawlerRepo(ctrl)
+	mockAMQPClient := mock_infra.NewMockAMQPClient(ctrl)
+
+	service := NewCrawlerService(mockRepo, mockAMQPClient)
+
+	ctx := context.Background()
+	amqpMessages := make(chan amqp.Delivery)
+	broadcast := make(chan []byte, 1)
+
+	mockAMQPClient.EXPECT().SetupAMQExchange().Return(nil)
+	mockAMQPClient.EXPECT().ConsumeAMQMessages().Return(amqpMessages, nil)
+	mockRepo.EXPECT().StoreUrl(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	go service.ConsumeFromResponseQueue(ctx, broadcast)
+
+	failed := &model.Response{
+		Request: model.Request{ReqId: "req-id", Url: "https://parserdigital.com/"},
+		Sitemap: model.Sitemap{
+			Outcome:   model.OutcomeFailed,
+			Attempted: 1,
+			Errors:    []model.PageError{{Url: "https://parserdigital.com/", Error: "connection refused"}},
+		},
+	}
+	failedJSON, _ := json.Marshal(failed)
+
+	amqpMessages <- amqp.Delivery{Body: failedJSON}
+	close(amqpMessages)
+
+	received := &model.Response{}
+	assert.NoError(t, json.Unmarshal(<-broadcast, received))
+	assert.Equal(t, "failed", received.Status)
+	assert.Equal(t, "req-id", received.ReqId)
+	assert.Equal(t, model.OutcomeFailed, received.Outcome)
+	assert.Equal(t, failed.Errors, received.Errors)
+}
+
+func TestCrawlService_ConsumeFromResponseQueue_Events(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mock_repo.NewMockCrawlerRepo(ctrl)
+	mockAMQPClient := mock_infra.NewMockAMQPClient(ctrl)
+
+	service := NewCrawlerService(mockRepo, mockAMQPClient)
+
+	ctx := context.Background()
+	amqpMessages := make(chan amqp.Delivery)
+	broadcast := make(chan []byte, 2)
+
+	url := "https://parserdigital.com/"
+	event := []byte(`{"reqId":"req-id","url":"https://parserdigital.com/","type":"pageFetched",` +
+		`"page":{"url":"https://parserdigital.com/","links":["https://parserdigital.com/career"]},` +
+		`"progress":{"discovered":2,"visited":1,"failed":0,"disallowed":0}}`)
+	result, _ := json.Marshal(&model.Response{
+		Request: model.Request{ReqId: "req-id", Url: url},
+		Sitemap: model.Sitemap{Pages: map[string][]string{url: {url + "career"}}, Outcome: model.OutcomeSucceeded},
+		Type:    model.EventResult,
+	})
+
+	mockAMQPClient.EXPECT().SetupAMQExchange().Return(nil)
+	mockAMQPClient.EXPECT().ConsumeAMQMessages().Return(amqpMessages, nil)
+	mockRepo.EXPECT().StoreUrl(ctx, url, string(result)).Return(nil).Times(1)
+
+	go service.ConsumeFromResponseQueue(ctx, broadcast)
+
+	amqpMessages <- amqp.Delivery{Body: event}
+	amqpMessages <- amqp.Delivery{Body: result}
+	close(amqpMessages)
+
+	assert.Equal(t, event, <-broadcast)
+	assert.Equal(t, result, <-broadcast)
+}
+
 func responseEquals(a, b *model.Response) bool {
 	return a.Status == b.Status && a.Request.ReqId == b.Request.ReqId && a.Request.Url == b.Request.Url
 }
+
+func TestCrawlService_ConsumeFromResponseQueue_Cancelled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mock_repo.NewMockCrawlerRepo(ctrl)
+	mockAMQPClient := mock_infra.NewMockAMQPClient(ctrl)
+
+	service := NewCrawlerService(mockRepo, mockAMQPClient)
+
+	ctx := context.Background()
+	amqpMessages := make(chan amqp.Delivery)
+	broadcast := make(chan []byte, 1)
+
+	mockAMQPClient.EXPECT().SetupAMQExchange().Return(nil)
+	mockAMQPClient.EXPECT().ConsumeAMQMessages().Return(amqpMessages, nil)
+	mockRepo.EXPECT().StoreUrl(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	go service.ConsumeFromResponseQueue(ctx, broadcast)
+
+	url := "https://parserdigital.com/"
+	cancelled := &model.Response{
+		Request: model.Request{ReqId: "req-id", Url: url},
+		Sitemap: model.Sitemap{
+			Pages:     map[string][]string{url: {url + "career"}},
+			Outcome:   model.OutcomeCancelled,
+			Attempted: 1,
+			Succeeded: 1,
+		},
+		Type: model.EventResult,
+	}
+	cancelledJSON, _ := json.Marshal(cancelled)
+
+	amqpMessages <- amqp.Delivery{Body: cancelledJSON}
+	close(amqpMessages)
+
+	received := &model.Response{}
+	assert.NoError(t, json.Unmarshal(<-broadcast, received))
+	assert.Equal(t, "cancelled", received.Status)
+	assert.Equal(t, model.OutcomeCancelled, received.Outcome)
+	assert.Equal(t, cancelled.Pages, received.Pages)
+}
+
+func TestCrawlService_Cancel(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mock_repo.NewMockCrawlerRepo(ctrl)
+	mockAMQPClient := mock_infra.NewMockAMQPClient(ctrl)
+
+	service := NewCrawlerService(mockRepo, mockAMQPClient)
+
+	ctx := context.Background()
+
+	t.Run("Cancel Published", func(t *testing.T) {
+		mockAMQPClient.EXPECT().SetupAMQExchange().Return(nil)
+		mockAMQPClient.EXPECT().PublishAMQCancel([]byte(`{"reqId":"req-id"}`)).Return(nil)
+
+		assert.NoError(t, service.Cancel(ctx, "req-id"))
+	})
+
+	t.Run("Error Setting Up Exchange", func(t *testing.T) {
+		mockAMQPClient.EXPECT().SetupAMQExchange().Return(errors.New("connection refused"))
+
+		err := service.Cancel(ctx, "req-id")
+
+		assert.EqualError(t, err, "error setting up the amq connection and exchange: connection refused")
+	})
+
+	t.Run("Error Publishing", func(t *testing.T) {
+		mockAMQPClient.EXPECT().SetupAMQExchange().Return(nil)
+		mockAMQPClient.EXPECT().PublishAMQCancel(gomock.Any()).Return(errors.New("channel closed"))
+
+		err := service.Cancel(ctx, "req-id")
+
+		assert.EqualError(t, err, "error publishing cancel command: channel closed")
+	})
+}
@@ -35,6 +35,20 @@ func (m *MockCrawlerService) EXPECT() *MockCrawlerServiceMockRecorder {
 	return m.recorder
 }
 
+// Cancel mocks base method.
+func (m *MockCrawlerService) Cancel(ctx context.Context, reqId string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Cancel", ctx, reqId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Cancel indicates an expected call of Cancel.
+func (mr *MockCrawlerServiceMockRecorder) Cancel(ctx, reqId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Cancel", reflect.TypeOf((*MockCrawlerService)(nil).Cancel), ctx, reqId)
+}
+
 // ConsumeFromResponseQueue mocks base method.
 func (m *MockCrawlerService) ConsumeFromResponseQueue(ctx context.Context, broadcast chan []byte) {
 	m.ctrl.T.Helper()
@@ -48,16 +62,31 @@ func (mr *MockCrawlerServiceMockRecorder) ConsumeFromResponseQueue(ctx, broadcas
 }
 
 // Crawl mocks base method.
-func (m *MockCrawlerService) Crawl(ctx context.Context, url string) (*model.Response, error) {
+func (m *MockCrawlerService) Crawl(ctx context.Context, req *model.Request) (*model.Response, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Crawl", ctx, url)
+	ret := m.ctrl.Call(m, "Crawl", ctx, req)
 	ret0, _ := ret[0].(*model.Response)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Crawl indicates an expected call of Crawl.
-func (mr *MockCrawlerServiceMockRecorder) Crawl(ctx, url interface{}) *gomock.Call {
+func (mr *MockCrawlerServiceMockRecorder) Crawl(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Crawl", reflect.TypeOf((*MockCrawlerService)(nil).Crawl), ctx, req)
+}
+
+// GetDuplicates mocks base method.
+func (m *MockCrawlerService) GetDuplicates(ctx context.Context, req *model.Request) (*model.DuplicatesResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDuplicates", ctx, req)
+	ret0, _ := ret[0].(*model.DuplicatesResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDuplicates indicates an expected call of GetDuplicates.
+func (mr *MockCrawlerServiceMockRecorder) GetDuplicates(ctx, req interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Crawl", reflect.TypeOf((*MockCrawlerService)(nil).Crawl), ctx, url)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDuplicates", reflect.TypeOf((*MockCrawlerService)(nil).GetDuplicates), ctx, req)
 }
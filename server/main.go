@@ -36,7 +36,7 @@ func main() {
 	go wsHandler.ProcessCrawledUrls(context.Background())
 
 	allowedOrigins := handlers.AllowedOrigins([]string{"*"})
-	allowedMethods := handlers.AllowedMethods([]string{"GET", "POST"})
+	allowedMethods := handlers.AllowedMethods([]string{"GET", "POST", "DELETE"})
 	allowedHeaders := handlers.AllowedHeaders([]string{"Content-Type"})
 
 	if err := http.ListenAndServe(":5000", handlers.CORS(allowedOrigins, allowedMethods, allowedHeaders)(router)); err != nil {
@@ -1,13 +1,26 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"github.com/streadway/amqp"
 	"log"
+	"sync"
+	"time"
 	"worker/internal/infra"
 	"worker/internal/model"
 	"worker/internal/service"
 )
 
+const (
+	// eventsBuffer is the number of page events a crawl job can get ahead of their publishing before it waits
+	eventsBuffer = 100
+	// cancelRetention is how long a cancel command for a job that has not started is kept, waiting for the job
+	cancelRetention = time.Hour
+	// taskWorkers is the number of page tasks of the distributed jobs crawled simultaneously by the worker
+	taskWorkers = 10
+)
+
 type CrawlerHandler interface {
 	Process()
 }
@@ -15,6 +28,19 @@ type CrawlerHandler interface {
 type crawlHandler struct {
 	AMQPClient infra.AMQPClient
 	Service    service.CrawlerService
+	// jobs holds the cancel functions of the running jobs, tasks the contexts of the distributed jobs whose page tasks
+	// are running and cancelled the jobs cancelled before they started, all by request id
+	jobs      map[string]context.CancelFunc
+	tasks     map[string]*taskJob
+	cancelled map[string]time.Time
+	mu        sync.Mutex
+}
+
+// taskJob is the context shared by the page tasks of a distributed job running in the worker, with how many there are
+type taskJob struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	running int
 }
 
 // NewCrawlerHandler builds a service and injects its dependencies
@@ -22,11 +48,15 @@ func NewCrawlerHandler(amqpClient infra.AMQPClient, service service.CrawlerServi
 	return &crawlHandler{
 		AMQPClient: amqpClient,
 		Service:    service,
+		jobs:       make(map[string]context.CancelFunc),
+		tasks:      make(map[string]*taskJob),
+		cancelled:  make(map[string]time.Time),
 	}
 }
 
 // Process consumes the url to process from the request queue, calls the service to crawl it and publishes the results
-// to the response queue
+// to the response queue. The jobs are stopped by the cancel commands sent to the workers, and acknowledged when their
+// result is published. The page tasks of the distributed jobs are crawled alongside
 func (h *crawlHandler) Process() {
 	err := h.AMQPClient.SetupAMQExchange()
 	if err != nil {
@@ -34,42 +64,237 @@ func (h *crawlHandler) Process() {
 		return
 	}
 
+	cancels, err := h.AMQPClient.ConsumeAMQCancels()
+	if err != nil {
+		log.Printf("error consuming cancel messages: %s", err)
+		return
+	}
+	go h.listenCancels(cancels)
+
 	messages, err := h.AMQPClient.ConsumeAMQMessages()
 	if err != nil {
 		log.Printf("error consuming messages: %s", err)
 		return
 	}
 
+	tasks, err := h.AMQPClient.ConsumeAMQTasks(taskWorkers)
+	if err != nil {
+		log.Printf("error consuming page tasks: %s", err)
+		return
+	}
+	for i := 0; i < taskWorkers; i++ {
+		go h.processTasks(tasks)
+	}
+
 	for msg := range messages {
 		req := &model.Request{}
 		if err := json.Unmarshal(msg.Body, req); err != nil {
 			log.Printf("error unmarshaling payload: %s", err)
-			return
+			// The message is dropped, since it would fail again if it was delivered to another worker
+			msg.Reject(false)
+			continue
 		}
 
 		log.Printf("getting message from the request queue: %v", req)
+		if msg.Redelivered {
+			log.Printf("crawl job %s was delivered again, resuming it from its checkpoint if it has one", req.ReqId)
+		}
 
-		data := h.Service.Crawl(req.Url)
+		// The page events are published as the crawl goes, and the final sitemap once they are all sent
+		events := make(chan model.Event, eventsBuffer)
+		published := make(chan struct{})
+		go func() {
+			defer close(published)
+			h.publishEvents(req, events)
+		}()
+
+		ctx, cancel := h.startJob(req.ReqId)
+		data := h.Service.Crawl(ctx, req, events)
+		h.finishJob(req.ReqId, cancel)
+		close(events)
+		<-published
 
 		res := &model.Response{
-			Request: model.Request{
-				ReqId: req.ReqId,
-				Url:   req.Url,
-			},
+			Request: *req,
 			Sitemap: *data,
+			Type:    model.EventResult,
 		}
 
 		body, err := json.Marshal(res)
 		if err != nil {
 			log.Printf("error marshaling payload: %s", err)
-			return
+			// The result would fail to marshal again, so the job is dropped
+			msg.Reject(false)
+			continue
 		}
 
 		if err := h.AMQPClient.PublishAMQMessage(body); err != nil {
 			log.Printf("error publishing to the exchange: %s", err)
-			return
+			// The job goes back to the queue, so it is crawled again by this or another worker
+			if err := msg.Nack(false, true); err != nil {
+				log.Printf("error requeuing message: %s", err)
+			}
+			continue
 		}
 
 		log.Printf("published to the exchange: %#v", string(body))
+
+		// The job is only acknowledged once its result is published, so it is delivered again if the worker stops
+		if err := msg.Ack(false); err != nil {
+			log.Printf("error acknowledging message: %s", err)
+		}
+	}
+}
+
+// processTasks crawls the page tasks of the distributed jobs until the channel is closed. The tasks are acknowledged
+// once crawled, so the tasks of a worker that stops are delivered again. The cancel commands stop the tasks of their job
+func (h *crawlHandler) processTasks(tasks <-chan amqp.Delivery) {
+	for msg := range tasks {
+		task := &model.PageTask{}
+		if err := json.Unmarshal(msg.Body, task); err != nil {
+			log.Printf("error unmarshaling page task: %s", err)
+			msg.Reject(false)
+			continue
+		}
+
+		// The events of the page are published for the job it belongs to, as for the pages of the jobs of the worker
+		events := make(chan model.Event, eventsBuffer)
+		published := make(chan struct{})
+		go func() {
+			defer close(published)
+			h.publishEvents(&task.Request, events)
+		}()
+
+		ctx := h.startTask(task.Request.ReqId)
+		h.Service.CrawlTask(ctx, task, events)
+		h.finishTask(task.Request.ReqId)
+		close(events)
+		<-published
+
+		if err := msg.Ack(false); err != nil {
+			log.Printf("error acknowledging page task: %s", err)
+		}
+	}
+}
+
+// publishEvents publishes the events of a crawl job to the response exchange until the channel is closed. Events that
+// cannot be published are dropped, since the final sitemap holds all the pages anyway
+func (h *crawlHandler) publishEvents(req *model.Request, events <-chan model.Event) {
+	for event := range events {
+		event.ReqId, event.Url = req.ReqId, req.Url
+
+		body, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("error marshaling event: %s", err)
+			continue
+		}
+
+		if err := h.AMQPClient.PublishAMQMessage(body); err != nil {
+			log.Printf("error publishing event to the exchange: %s", err)
+		}
+	}
+}
+
+// listenCancels cancels the jobs named by the cancel commands until the channel is closed
+func (h *crawlHandler) listenCancels(cancels <-chan amqp.Delivery) {
+	for msg := range cancels {
+		cmd := &model.CancelCommand{}
+		if err := json.Unmarshal(msg.Body, cmd); err != nil {
+			log.Printf("error unmarshaling cancel command: %s", err)
+			continue
+		}
+
+		h.cancel(cmd.ReqId)
+	}
+}
+
+// cancel stops the job and its page tasks if they are running in this worker. Otherwise the job may be waiting in the
+// request queue, or more of its page tasks may come, so it is remembered for a while to cancel them as soon as they start
+func (h *crawlHandler) cancel(reqId string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if t, ok := h.tasks[reqId]; ok {
+		log.Printf("cancelling the page tasks of crawl job %s", reqId)
+		t.cancel()
+	}
+
+	if cancel, ok := h.jobs[reqId]; ok {
+		log.Printf("cancelling crawl job %s", reqId)
+		cancel()
+		return
+	}
+
+	now := time.Now()
+	for id, at := range h.cancelled {
+		if now.Sub(at) > cancelRetention {
+			delete(h.cancelled, id)
+		}
+	}
+	h.cancelled[reqId] = now
+}
+
+// startJob registers a job and returns its context, which is already cancelled if the job was cancelled before it
+// started
+func (h *crawlHandler) startJob(reqId string) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.cancelled[reqId]; ok {
+		log.Printf("crawl job %s was cancelled before it started", reqId)
+		delete(h.cancelled, reqId)
+		cancel()
+	}
+	h.jobs[reqId] = cancel
+
+	return ctx, cancel
+}
+
+// finishJob unregisters a job and releases its context
+func (h *crawlHandler) finishJob(reqId string, cancel context.CancelFunc) {
+	h.mu.Lock()
+	delete(h.jobs, reqId)
+	h.mu.Unlock()
+
+	cancel()
+}
+
+// startTask returns the context of the distributed job of a page task, shared by all its tasks running in the worker.
+// It is already cancelled if the job was cancelled
+func (h *crawlHandler) startTask(reqId string) context.Context {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	t, ok := h.tasks[reqId]
+	if !ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		t = &taskJob{ctx: ctx, cancel: cancel}
+		h.tasks[reqId] = t
+	}
+	// The command is kept, since more page tasks of the job can come
+	if _, ok := h.cancelled[reqId]; ok {
+		t.cancel()
+	}
+	t.running++
+
+	return t.ctx
+}
+
+// finishTask releases the context of the distributed job once none of its page tasks are running in the worker
+func (h *crawlHandler) finishTask(reqId string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	t, ok := h.tasks[reqId]
+	if !ok {
+		return
+	}
+
+	t.running--
+	if t.running <= 0 {
+		delete(h.tasks, reqId)
+		t.cancel()
 	}
 }
@@ -2,16 +2,60 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/golang/mock/gomock"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
 	"log"
+	"sync"
 	"testing"
+	"time"
 	mock_infra "worker/internal/infra/mocks"
 	"worker/internal/model"
 	mock_service "worker/internal/service/mocks"
 )
 
+// acknowledger records the acknowledgements of the deliveries
+type acknowledger struct {
+	acked    []uint64
+	rejected []uint64
+	requeued []uint64
+	mu       sync.Mutex
+}
+
+func (a *acknowledger) Ack(tag uint64, multiple bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.acked = append(a.acked, tag)
+	return nil
+}
+
+func (a *acknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if requeue {
+		a.requeued = append(a.requeued, tag)
+	}
+	return nil
+}
+
+func (a *acknowledger) Reject(tag uint64, requeue bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rejected = append(a.rejected, tag)
+	return nil
+}
+
+// tags returns the tags acknowledged and rejected so far
+func (a *acknowledger) tags() ([]uint64, []uint64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]uint64(nil), a.acked...), append([]uint64(nil), a.rejected...)
+}
+
 func TestCrawlHandler_Process(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -61,15 +105,18 @@ func TestCrawlHandler_Process(t *testing.T) {
 			Url:   req.Url,
 		},
 		Sitemap: *data,
+		Type:    model.EventResult,
 	}
 
 	body, _ := json.Marshal(res)
 
 	go func() {
-		mockCrawlerService.EXPECT().Crawl(gomock.Any()).Return(data)
+		mockCrawlerService.EXPECT().Crawl(gomock.Any(), gomock.Any(), gomock.Any()).Return(data)
 
 		mockAMQPClient.EXPECT().SetupAMQExchange().Return(nil)
+		mockAMQPClient.EXPECT().ConsumeAMQCancels().Return(nil, nil).AnyTimes()
 		mockAMQPClient.EXPECT().ConsumeAMQMessages().Return(nil, nil).AnyTimes()
+		mockAMQPClient.EXPECT().ConsumeAMQTasks(gomock.Any()).Return(make(<-chan amqp.Delivery), nil).AnyTimes()
 		mockAMQPClient.EXPECT().PublishAMQMessage(body).Return(nil).AnyTimes()
 
 		var logOutput bytes.Buffer
@@ -84,3 +131,305 @@ func TestCrawlHandler_Process(t *testing.T) {
 		}
 	}()
 }
+
+func TestCrawlHandler_Process_Events(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockAMQPClient := mock_infra.NewMockAMQPClient(ctrl)
+	mockCrawlerService := mock_service.NewMockCrawlerService(ctrl)
+
+	handler := NewCrawlerHandler(mockAMQPClient, mockCrawlerService)
+
+	url := "https://parserdigital.com/"
+	req := &model.Request{ReqId: "req-id", Url: url}
+	reqBody, _ := json.Marshal(req)
+
+	data := &model.Sitemap{Pages: map[string][]string{url: {url + "career"}}}
+	event := model.Event{
+		Type:     model.EventPageFetched,
+		Page:     model.PageEvent{Url: url, Links: []string{url + "career"}},
+		Progress: model.Progress{Discovered: 2, Visited: 1},
+	}
+
+	messages := make(chan amqp.Delivery, 1)
+	messages <- amqp.Delivery{Body: reqBody}
+	close(messages)
+
+	var published []json.RawMessage
+
+	mockAMQPClient.EXPECT().SetupAMQExchange().Return(nil)
+	mockAMQPClient.EXPECT().ConsumeAMQCancels().Return(make(<-chan amqp.Delivery), nil)
+	mockAMQPClient.EXPECT().ConsumeAMQMessages().Return((<-chan amqp.Delivery)(messages), nil)
+	mockAMQPClient.EXPECT().ConsumeAMQTasks(gomock.Any()).Return(make(<-chan amqp.Delivery), nil)
+	mockCrawlerService.EXPECT().Crawl(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, req *model.Request, events chan<- model.Event) *model.Sitemap {
+			events <- event
+			return data
+		})
+	mockAMQPClient.EXPECT().PublishAMQMessage(gomock.Any()).DoAndReturn(func(body []byte) error {
+		published = append(published, body)
+		return nil
+	}).Times(2)
+
+	handler.Process()
+
+	event.ReqId, event.Url = req.ReqId, req.Url
+	eventBody, _ := json.Marshal(event)
+	resBody, _ := json.Marshal(&model.Response{Request: *req, Sitemap: *data, Type: model.EventResult})
+
+	assert.Equal(t, []json.RawMessage{eventBody, resBody}, published)
+}
+
+func TestCrawlHandler_Process_Cancel(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockAMQPClient := mock_infra.NewMockAMQPClient(ctrl)
+	mockCrawlerService := mock_service.NewMockCrawlerService(ctrl)
+
+	handler := NewCrawlerHandler(mockAMQPClient, mockCrawlerService)
+
+	req := &model.Request{ReqId: "req-id", Url: "https://parserdigital.com/"}
+	reqBody, _ := json.Marshal(req)
+	cancelBody, _ := json.Marshal(&model.CancelCommand{ReqId: req.ReqId})
+
+	messages := make(chan amqp.Delivery, 1)
+	messages <- amqp.Delivery{Body: reqBody}
+	close(messages)
+
+	cancels := make(chan amqp.Delivery, 1)
+	defer close(cancels)
+
+	data := &model.Sitemap{Outcome: model.OutcomeCancelled}
+	var published []byte
+
+	mockAMQPClient.EXPECT().SetupAMQExchange().Return(nil)
+	mockAMQPClient.EXPECT().ConsumeAMQCancels().Return((<-chan amqp.Delivery)(cancels), nil)
+	mockAMQPClient.EXPECT().ConsumeAMQMessages().Return((<-chan amqp.Delivery)(messages), nil)
+	mockAMQPClient.EXPECT().ConsumeAMQTasks(gomock.Any()).Return(make(<-chan amqp.Delivery), nil)
+	mockCrawlerService.EXPECT().Crawl(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, req *model.Request, events chan<- model.Event) *model.Sitemap {
+			cancels <- amqp.Delivery{Body: cancelBody}
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+				t.Error("the crawl was not cancelled")
+			}
+			return data
+		})
+	mockAMQPClient.EXPECT().PublishAMQMessage(gomock.Any()).DoAndReturn(func(body []byte) error {
+		published = body
+		return nil
+	})
+
+	handler.Process()
+
+	res := &model.Response{}
+	assert.NoError(t, json.Unmarshal(published, res))
+	assert.Equal(t, model.OutcomeCancelled, res.Outcome)
+}
+
+func TestCrawlHandler_Cancel(t *testing.T) {
+	h := NewCrawlerHandler(nil, nil).(*crawlHandler)
+
+	t.Run("Running Job", func(t *testing.T) {
+		ctx, cancel := h.startJob("running")
+		defer h.finishJob("running", cancel)
+
+		h.cancel("running")
+
+		assert.Error(t, ctx.Err())
+		assert.NotContains(t, h.cancelled, "running")
+	})
+
+	t.Run("Job Not Started", func(t *testing.T) {
+		h.cancel("queued")
+		assert.Contains(t, h.cancelled, "queued")
+
+		ctx, cancel := h.startJob("queued")
+		defer h.finishJob("queued", cancel)
+
+		assert.Error(t, ctx.Err())
+		assert.NotContains(t, h.cancelled, "queued")
+	})
+
+	t.Run("Other Job", func(t *testing.T) {
+		h.cancel("other")
+
+		ctx, cancel := h.startJob("next")
+		defer h.finishJob("next", cancel)
+
+		assert.NoError(t, ctx.Err())
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		h.cancelled["old"] = time.Now().Add(-2 * cancelRetention)
+		h.cancel("new")
+
+		assert.NotContains(t, h.cancelled, "old")
+		assert.Contains(t, h.cancelled, "new")
+	})
+
+	t.Run("Page Tasks", func(t *testing.T) {
+		// The tasks of a job share its context while any of them runs
+		first := h.startTask("distributed")
+		second := h.startTask("distributed")
+		other := h.startTask("other-distributed")
+		defer h.finishTask("other-distributed")
+
+		h.cancel("distributed")
+
+		assert.Error(t, first.Err())
+		assert.Error(t, second.Err())
+		assert.NoError(t, other.Err())
+
+		// The tasks that come later are cancelled too
+		h.finishTask("distributed")
+		h.finishTask("distributed")
+		assert.NotContains(t, h.tasks, "distributed")
+		assert.Error(t, h.startTask("distributed").Err())
+		h.finishTask("distributed")
+	})
+}
+
+func TestCrawlHandler_Process_Acknowledge(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockAMQPClient := mock_infra.NewMockAMQPClient(ctrl)
+	mockCrawlerService := mock_service.NewMockCrawlerService(ctrl)
+
+	req := &model.Request{ReqId: "req-id", Url: "https://parserdigital.com/"}
+	reqBody, _ := json.Marshal(req)
+
+	t.Run("Acknowledged After Publishing", func(t *testing.T) {
+		handler := NewCrawlerHandler(mockAMQPClient, mockCrawlerService)
+		ack := &acknowledger{}
+
+		messages := make(chan amqp.Delivery, 2)
+		messages <- amqp.Delivery{Acknowledger: ack, DeliveryTag: 1, Body: reqBody}
+		messages <- amqp.Delivery{Acknowledger: ack, DeliveryTag: 2, Body: reqBody, Redelivered: true}
+		close(messages)
+
+		mockAMQPClient.EXPECT().SetupAMQExchange().Return(nil)
+		mockAMQPClient.EXPECT().ConsumeAMQCancels().Return(make(<-chan amqp.Delivery), nil)
+		mockAMQPClient.EXPECT().ConsumeAMQMessages().Return((<-chan amqp.Delivery)(messages), nil)
+		mockAMQPClient.EXPECT().ConsumeAMQTasks(gomock.Any()).Return(make(<-chan amqp.Delivery), nil)
+		mockCrawlerService.EXPECT().Crawl(gomock.Any(), req, gomock.Any()).Return(&model.Sitemap{}).Times(2)
+		mockAMQPClient.EXPECT().PublishAMQMessage(gomock.Any()).DoAndReturn(func(body []byte) error {
+			assert.Len(t, ack.acked, 0, "acknowledged before publishing the first result")
+			return nil
+		})
+		mockAMQPClient.EXPECT().PublishAMQMessage(gomock.Any()).Return(nil)
+
+		handler.Process()
+
+		assert.Equal(t, []uint64{1, 2}, ack.acked)
+	})
+
+	t.Run("Requeued When Publishing Fails", func(t *testing.T) {
+		handler := NewCrawlerHandler(mockAMQPClient, mockCrawlerService)
+		ack := &acknowledger{}
+
+		// The messages after the failed one are still processed
+		messages := make(chan amqp.Delivery, 2)
+		messages <- amqp.Delivery{Acknowledger: ack, DeliveryTag: 1, Body: reqBody}
+		messages <- amqp.Delivery{Acknowledger: ack, DeliveryTag: 2, Body: reqBody}
+		close(messages)
+
+		mockAMQPClient.EXPECT().SetupAMQExchange().Return(nil)
+		mockAMQPClient.EXPECT().ConsumeAMQCancels().Return(make(<-chan amqp.Delivery), nil)
+		mockAMQPClient.EXPECT().ConsumeAMQMessages().Return((<-chan amqp.Delivery)(messages), nil)
+		mockAMQPClient.EXPECT().ConsumeAMQTasks(gomock.Any()).Return(make(<-chan amqp.Delivery), nil)
+		mockCrawlerService.EXPECT().Crawl(gomock.Any(), req, gomock.Any()).Return(&model.Sitemap{}).Times(2)
+		gomock.InOrder(
+			mockAMQPClient.EXPECT().PublishAMQMessage(gomock.Any()).Return(errors.New("channel closed")),
+			mockAMQPClient.EXPECT().PublishAMQMessage(gomock.Any()).Return(nil),
+		)
+
+		handler.Process()
+
+		assert.Equal(t, []uint64{2}, ack.acked)
+		assert.Equal(t, []uint64{1}, ack.requeued)
+		assert.Empty(t, ack.rejected)
+	})
+
+	t.Run("Invalid Payload Rejected", func(t *testing.T) {
+		handler := NewCrawlerHandler(mockAMQPClient, mockCrawlerService)
+		ack := &acknowledger{}
+
+		// The messages after the invalid one are still processed
+		messages := make(chan amqp.Delivery, 2)
+		messages <- amqp.Delivery{Acknowledger: ack, DeliveryTag: 1, Body: []byte("{")}
+		messages <- amqp.Delivery{Acknowledger: ack, DeliveryTag: 2, Body: reqBody}
+		close(messages)
+
+		mockAMQPClient.EXPECT().SetupAMQExchange().Return(nil)
+		mockAMQPClient.EXPECT().ConsumeAMQCancels().Return(make(<-chan amqp.Delivery), nil)
+		mockAMQPClient.EXPECT().ConsumeAMQMessages().Return((<-chan amqp.Delivery)(messages), nil)
+		mockAMQPClient.EXPECT().ConsumeAMQTasks(gomock.Any()).Return(make(<-chan amqp.Delivery), nil)
+		mockCrawlerService.EXPECT().Crawl(gomock.Any(), req, gomock.Any()).Return(&model.Sitemap{})
+		mockAMQPClient.EXPECT().PublishAMQMessage(gomock.Any()).Return(nil)
+
+		handler.Process()
+
+		assert.Equal(t, []uint64{2}, ack.acked)
+		assert.Equal(t, []uint64{1}, ack.rejected)
+	})
+}
+
+func TestCrawlHandler_Process_Tasks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockAMQPClient := mock_infra.NewMockAMQPClient(ctrl)
+	mockCrawlerService := mock_service.NewMockCrawlerService(ctrl)
+
+	handler := NewCrawlerHandler(mockAMQPClient, mockCrawlerService)
+	ack := &acknowledger{}
+
+	task := &model.PageTask{
+		Request: model.Request{ReqId: "req-id", Url: "https://parserdigital.com/", Distributed: true},
+		Url:     "https://parserdigital.com/career",
+		Depth:   1,
+	}
+	taskBody, _ := json.Marshal(task)
+
+	tasks := make(chan amqp.Delivery, 2)
+	tasks <- amqp.Delivery{Acknowledger: ack, DeliveryTag: 1, Body: taskBody}
+	tasks <- amqp.Delivery{Acknowledger: ack, DeliveryTag: 2, Body: []byte("{")}
+	defer close(tasks)
+
+	messages := make(chan amqp.Delivery)
+	close(messages)
+
+	mockAMQPClient.EXPECT().SetupAMQExchange().Return(nil)
+	mockAMQPClient.EXPECT().ConsumeAMQCancels().Return(make(<-chan amqp.Delivery), nil)
+	mockAMQPClient.EXPECT().ConsumeAMQMessages().Return((<-chan amqp.Delivery)(messages), nil)
+	mockAMQPClient.EXPECT().ConsumeAMQTasks(taskWorkers).Return((<-chan amqp.Delivery)(tasks), nil)
+	mockCrawlerService.EXPECT().CrawlTask(gomock.Any(), task, gomock.Any()).DoAndReturn(
+		func(ctx context.Context, task *model.PageTask, events chan<- model.Event) {
+			events <- model.Event{Type: model.EventPageFetched, Page: model.PageEvent{Url: task.Url}}
+		})
+
+	// The events of the page are published for the job of the task
+	published := make(chan []byte, 1)
+	mockAMQPClient.EXPECT().PublishAMQMessage(gomock.Any()).DoAndReturn(func(body []byte) error {
+		published <- body
+		return nil
+	})
+
+	handler.Process()
+
+	assert.Eventually(t, func() bool {
+		acked, rejected := ack.tags()
+		return assert.ObjectsAreEqual([]uint64{1}, acked) && assert.ObjectsAreEqual([]uint64{2}, rejected)
+	}, time.Second, 10*time.Millisecond)
+
+	event := &model.Event{}
+	assert.NoError(t, json.Unmarshal(<-published, event))
+	assert.Equal(t, "req-id", event.ReqId)
+	assert.Equal(t, task.Request.Url, event.Url)
+	assert.Equal(t, task.Url, event.Page.Url)
+}
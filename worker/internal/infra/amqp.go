@@ -12,18 +12,26 @@ type AMQPClient interface {
 	SetupAMQExchange() error
 	PublishAMQMessage(message []byte) error
 	ConsumeAMQMessages() (<-chan amqp.Delivery, error)
+	ConsumeAMQCancels() (<-chan amqp.Delivery, error)
+	PublishAMQTask(message []byte) error
+	ConsumeAMQTasks(prefetch int) (<-chan amqp.Delivery, error)
 }
 
 const (
-	exchangeName = "parser-crawler"
-	reqKey       = "messages.request"
-	resKey       = "messages.response"
-	queueName    = "parser-crawler-req-queue"
+	exchangeName  = "parser-crawler"
+	reqKey        = "messages.request"
+	resKey        = "messages.response"
+	cancelKey     = "messages.cancel"
+	taskKey       = "messages.task"
+	queueName     = "parser-crawler-req-queue"
+	taskQueueName = "parser-crawler-task-queue"
 )
 
 type amqpClient struct {
 	Conn *amqp.Connection
 	Ch   *amqp.Channel
+	// ReqCh only carries the crawl jobs, so the broker closing it on a consumer timeout does not stop the other queues
+	ReqCh *amqp.Channel
 }
 
 // NewAMQPClient builds an amqp client
@@ -69,21 +77,91 @@ func (c *amqpClient) PublishAMQMessage(message []byte) error {
 	return nil
 }
 
-// ConsumeAMQMessages returns the messages from the subscribed queue
+// ConsumeAMQMessages returns the messages from the subscribed queue. The messages must be acknowledged once processed,
+// so the job of a worker that stops is delivered again, and a worker only takes one job at a time. A job stays
+// unacknowledged while it is crawled, so the consumer_timeout of the broker must be longer than the longest crawl job
 func (c *amqpClient) ConsumeAMQMessages() (<-chan amqp.Delivery, error) {
-	q, err := c.Ch.QueueDeclare(queueName, false, false, false, false, nil)
+	var err error
+	c.ReqCh, err = c.Conn.Channel()
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error opening amqp request channel: %s", err))
+	}
+
+	q, err := c.ReqCh.QueueDeclare(queueName, false, false, false, false, nil)
 	if err != nil {
 		return nil, errors.New(fmt.Sprintf("error declaring queue: %s", err))
 	}
 
-	if err = c.Ch.QueueBind(q.Name, reqKey, exchangeName, false, nil); err != nil {
+	if err = c.ReqCh.QueueBind(q.Name, reqKey, exchangeName, false, nil); err != nil {
 		return nil, errors.New(fmt.Sprintf("error binding exchange to queue: %s", err))
 	}
 
-	messages, err := c.Ch.Consume(q.Name, "", true, false, false, false, nil)
+	if err = c.ReqCh.Qos(1, 0, false); err != nil {
+		return nil, errors.New(fmt.Sprintf("error setting the prefetch count: %s", err))
+	}
+
+	messages, err := c.ReqCh.Consume(q.Name, "", false, false, false, false, nil)
 	if err != nil {
 		return nil, errors.New(fmt.Sprintf("error consuming queued messages: %s", err))
 	}
 
 	return messages, nil
 }
+
+// ConsumeAMQCancels returns the cancel commands sent to all the workers. Every worker gets its own exclusive queue, so
+// the command reaches the one running the job wherever it is
+func (c *amqpClient) ConsumeAMQCancels() (<-chan amqp.Delivery, error) {
+	q, err := c.Ch.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error declaring cancel queue: %s", err))
+	}
+
+	if err = c.Ch.QueueBind(q.Name, cancelKey, exchangeName, false, nil); err != nil {
+		return nil, errors.New(fmt.Sprintf("error binding exchange to cancel queue: %s", err))
+	}
+
+	cancels, err := c.Ch.Consume(q.Name, "", true, true, false, false, nil)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error consuming cancel messages: %s", err))
+	}
+
+	return cancels, nil
+}
+
+// PublishAMQTask publishes a page task of a distributed crawl job to the amq exchange
+func (c *amqpClient) PublishAMQTask(message []byte) error {
+	msg := amqp.Publishing{
+		ContentType:  "text/plain",
+		DeliveryMode: amqp.Persistent,
+		Body:         message,
+	}
+	if err := c.Ch.Publish(exchangeName, taskKey, false, false, msg); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ConsumeAMQTasks returns the page tasks of the distributed crawl jobs, shared by all the workers. Up to prefetch tasks
+// are delivered to the worker at once, and they must be acknowledged once processed
+func (c *amqpClient) ConsumeAMQTasks(prefetch int) (<-chan amqp.Delivery, error) {
+	q, err := c.Ch.QueueDeclare(taskQueueName, true, false, false, false, nil)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error declaring task queue: %s", err))
+	}
+
+	if err = c.Ch.QueueBind(q.Name, taskKey, exchangeName, false, nil); err != nil {
+		return nil, errors.New(fmt.Sprintf("error binding exchange to task queue: %s", err))
+	}
+
+	if err = c.Ch.Qos(prefetch, 0, false); err != nil {
+		return nil, errors.New(fmt.Sprintf("error setting the prefetch count: %s", err))
+	}
+
+	tasks, err := c.Ch.Consume(q.Name, "", false, false, false, false, nil)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error consuming page tasks: %s", err))
+	}
+
+	return tasks, nil
+}
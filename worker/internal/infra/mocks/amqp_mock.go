@@ -34,6 +34,21 @@ func (m *MockAMQPClient) EXPECT() *MockAMQPClientMockRecorder {
 	return m.recorder
 }
 
+// ConsumeAMQCancels mocks base method.
+func (m *MockAMQPClient) ConsumeAMQCancels() (<-chan amqp.Delivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumeAMQCancels")
+	ret0, _ := ret[0].(<-chan amqp.Delivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConsumeAMQCancels indicates an expected call of ConsumeAMQCancels.
+func (mr *MockAMQPClientMockRecorder) ConsumeAMQCancels() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeAMQCancels", reflect.TypeOf((*MockAMQPClient)(nil).ConsumeAMQCancels))
+}
+
 // ConsumeAMQMessages mocks base method.
 func (m *MockAMQPClient) ConsumeAMQMessages() (<-chan amqp.Delivery, error) {
 	m.ctrl.T.Helper()
@@ -49,6 +64,21 @@ func (mr *MockAMQPClientMockRecorder) ConsumeAMQMessages() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeAMQMessages", reflect.TypeOf((*MockAMQPClient)(nil).ConsumeAMQMessages))
 }
 
+// ConsumeAMQTasks mocks base method.
+func (m *MockAMQPClient) ConsumeAMQTasks(prefetch int) (<-chan amqp.Delivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumeAMQTasks", prefetch)
+	ret0, _ := ret[0].(<-chan amqp.Delivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConsumeAMQTasks indicates an expected call of ConsumeAMQTasks.
+func (mr *MockAMQPClientMockRecorder) ConsumeAMQTasks(prefetch interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeAMQTasks", reflect.TypeOf((*MockAMQPClient)(nil).ConsumeAMQTasks), prefetch)
+}
+
 // PublishAMQMessage mocks base method.
 func (m *MockAMQPClient) PublishAMQMessage(message []byte) error {
 	m.ctrl.T.Helper()
@@ -63,6 +93,20 @@ func (mr *MockAMQPClientMockRecorder) PublishAMQMessage(message interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PublishAMQMessage", reflect.TypeOf((*MockAMQPClient)(nil).PublishAMQMessage), message)
 }
 
+// PublishAMQTask mocks base method.
+func (m *MockAMQPClient) PublishAMQTask(message []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PublishAMQTask", message)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PublishAMQTask indicates an expected call of PublishAMQTask.
+func (mr *MockAMQPClientMockRecorder) PublishAMQTask(message interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PublishAMQTask", reflect.TypeOf((*MockAMQPClient)(nil).PublishAMQTask), message)
+}
+
 // SetupAMQExchange mocks base method.
 func (m *MockAMQPClient) SetupAMQExchange() error {
 	m.ctrl.T.Helper()
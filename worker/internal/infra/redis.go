@@ -0,0 +1,164 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"os"
+	"time"
+)
+
+const RedisKeyNotFound string = "key not found"
+
+type RedisClient interface {
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key, value string) error
+	Del(ctx context.Context, keys ...string) error
+	SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error)
+	SetTTL(ctx context.Context, key, value string, ttl time.Duration) error
+	PTTL(ctx context.Context, key string) (time.Duration, error)
+	IncrBy(ctx context.Context, key string, n int64) (int64, error)
+	SAdd(ctx context.Context, key, member string) (bool, error)
+	SIsMember(ctx context.Context, key, member string) (bool, error)
+	SCard(ctx context.Context, key string) (int64, error)
+	HSet(ctx context.Context, key, field, value string) error
+	HGetAll(ctx context.Context, key string) (map[string]string, error)
+}
+
+type redisClient struct {
+	client *redis.Client
+}
+
+// NewRedisClient builds a Redis client
+func NewRedisClient() RedisClient {
+	client := redis.NewClient(&redis.Options{
+		Addr:     os.Getenv("REDIS_HOST"),
+		Password: os.Getenv("REDIS_PASSWORD"),
+	})
+
+	return &redisClient{
+		client: client,
+	}
+}
+
+// Set sets a redis key
+func (c *redisClient) Set(ctx context.Context, key string, value string) error {
+	if err := c.client.Set(ctx, key, value, 0).Err(); err != nil {
+		return errors.New(fmt.Sprintf("error storing value in Redis: %s", err))
+	}
+
+	return nil
+}
+
+// Get gets a redis key
+func (c *redisClient) Get(ctx context.Context, key string) (string, error) {
+	value, err := c.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return "", errors.New(RedisKeyNotFound)
+	}
+
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("error getting value from Redis: %s", err))
+	}
+
+	return value, nil
+}
+
+// Del deletes redis keys, which may not exist
+func (c *redisClient) Del(ctx context.Context, keys ...string) error {
+	if err := c.client.Del(ctx, keys...).Err(); err != nil {
+		return errors.New(fmt.Sprintf("error deleting value from Redis: %s", err))
+	}
+
+	return nil
+}
+
+// SetNX sets a redis key that expires after the ttl, only if it does not exist. It reports whether the key was set.
+// A zero ttl means the key does not expire
+func (c *redisClient) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	ok, err := c.client.SetNX(ctx, key, value, ttl).Result()
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("error storing value in Redis: %s", err))
+	}
+
+	return ok, nil
+}
+
+// SetTTL sets a redis key that expires after the ttl
+func (c *redisClient) SetTTL(ctx context.Context, key, value string, ttl time.Duration) error {
+	if err := c.client.Set(ctx, key, value, ttl).Err(); err != nil {
+		return errors.New(fmt.Sprintf("error storing value in Redis: %s", err))
+	}
+
+	return nil
+}
+
+// PTTL gets the time left before a redis key expires. It is negative when the key does not exist or does not expire
+func (c *redisClient) PTTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := c.client.PTTL(ctx, key).Result()
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("error getting ttl from Redis: %s", err))
+	}
+
+	return ttl, nil
+}
+
+// IncrBy adds n to a redis counter and returns its new value
+func (c *redisClient) IncrBy(ctx context.Context, key string, n int64) (int64, error) {
+	value, err := c.client.IncrBy(ctx, key, n).Result()
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("error incrementing counter in Redis: %s", err))
+	}
+
+	return value, nil
+}
+
+// SAdd adds a member to a redis set and reports whether it was not in the set
+func (c *redisClient) SAdd(ctx context.Context, key, member string) (bool, error) {
+	added, err := c.client.SAdd(ctx, key, member).Result()
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("error adding member to Redis set: %s", err))
+	}
+
+	return added == 1, nil
+}
+
+// SIsMember checks if a member is in a redis set
+func (c *redisClient) SIsMember(ctx context.Context, key, member string) (bool, error) {
+	found, err := c.client.SIsMember(ctx, key, member).Result()
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("error checking member of Redis set: %s", err))
+	}
+
+	return found, nil
+}
+
+// SCard returns the number of members of a redis set
+func (c *redisClient) SCard(ctx context.Context, key string) (int64, error) {
+	count, err := c.client.SCard(ctx, key).Result()
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("error counting members of Redis set: %s", err))
+	}
+
+	return count, nil
+}
+
+// HSet sets a field of a redis hash
+func (c *redisClient) HSet(ctx context.Context, key, field, value string) error {
+	if err := c.client.HSet(ctx, key, field, value).Err(); err != nil {
+		return errors.New(fmt.Sprintf("error storing hash field in Redis: %s", err))
+	}
+
+	return nil
+}
+
+// HGetAll gets all the fields of a redis hash
+func (c *redisClient) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	fields, err := c.client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error getting hash from Redis: %s", err))
+	}
+
+	return fields, nil
+}
@@ -0,0 +1,128 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"worker/internal/infra"
+)
+
+const (
+	KeyNotFound = "key not found"
+	// checkpointPrefix namespaces the checkpoint keys in a store shared with other data
+	checkpointPrefix = "checkpoint:"
+)
+
+// CheckpointRepo stores the checkpoints of the crawl jobs in progress by request id, so a job can be resumed by
+// another worker when it is redelivered
+type CheckpointRepo interface {
+	Load(ctx context.Context, reqId string) ([]byte, error)
+	Save(ctx context.Context, reqId string, data []byte) error
+	Delete(ctx context.Context, reqId string) error
+}
+
+type redisCheckpointRepository struct {
+	client infra.RedisClient
+}
+
+// NewRedisCheckpointRepository builds a checkpoint repository backed by Redis, shared by all the workers
+func NewRedisCheckpointRepository(client infra.RedisClient) CheckpointRepo {
+	return &redisCheckpointRepository{
+		client: client,
+	}
+}
+
+// Load gets the checkpoint of the job
+func (r *redisCheckpointRepository) Load(ctx context.Context, reqId string) ([]byte, error) {
+	data, err := r.client.Get(ctx, checkpointPrefix+reqId)
+	if err != nil {
+		if err.Error() == infra.RedisKeyNotFound {
+			return nil, errors.New(KeyNotFound)
+		}
+
+		return nil, errors.New(fmt.Sprintf("error getting checkpoint from repo: %s", err))
+	}
+
+	return []byte(data), nil
+}
+
+// Save stores the checkpoint of the job, replacing the previous one
+func (r *redisCheckpointRepository) Save(ctx context.Context, reqId string, data []byte) error {
+	return r.client.Set(ctx, checkpointPrefix+reqId, string(data))
+}
+
+// Delete removes the checkpoint of a finished job
+func (r *redisCheckpointRepository) Delete(ctx context.Context, reqId string) error {
+	return r.client.Del(ctx, checkpointPrefix+reqId)
+}
+
+type fileCheckpointRepository struct {
+	dir string
+}
+
+// NewFileCheckpointRepository builds a checkpoint repository keeping a file per job in the directory. It only resumes
+// the jobs redelivered to a worker that can read the same directory, such as a restarted container with a volume
+func NewFileCheckpointRepository(dir string) CheckpointRepo {
+	return &fileCheckpointRepository{
+		dir: dir,
+	}
+}
+
+// Load reads the checkpoint file of the job
+func (r *fileCheckpointRepository) Load(ctx context.Context, reqId string) ([]byte, error) {
+	data, err := os.ReadFile(r.path(reqId))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, errors.New(KeyNotFound)
+		}
+
+		return nil, errors.New(fmt.Sprintf("error reading checkpoint file: %s", err))
+	}
+
+	return data, nil
+}
+
+// Save writes the checkpoint file of the job. The file is replaced atomically, so a crash while writing keeps the
+// previous checkpoint
+func (r *fileCheckpointRepository) Save(ctx context.Context, reqId string, data []byte) error {
+	if err := os.MkdirAll(r.dir, 0o755); err != nil {
+		return errors.New(fmt.Sprintf("error creating checkpoint directory: %s", err))
+	}
+
+	tmp, err := os.CreateTemp(r.dir, "*.tmp")
+	if err != nil {
+		return errors.New(fmt.Sprintf("error creating checkpoint file: %s", err))
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.New(fmt.Sprintf("error writing checkpoint file: %s", err))
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.New(fmt.Sprintf("error writing checkpoint file: %s", err))
+	}
+
+	if err := os.Rename(tmp.Name(), r.path(reqId)); err != nil {
+		return errors.New(fmt.Sprintf("error replacing checkpoint file: %s", err))
+	}
+
+	return nil
+}
+
+// Delete removes the checkpoint file of a finished job, which may not exist
+func (r *fileCheckpointRepository) Delete(ctx context.Context, reqId string) error {
+	if err := os.Remove(r.path(reqId)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.New(fmt.Sprintf("error deleting checkpoint file: %s", err))
+	}
+
+	return nil
+}
+
+// path returns the checkpoint file of the job. The request id is only used as a base name, so it cannot point outside
+// the directory
+func (r *fileCheckpointRepository) path(reqId string) string {
+	return filepath.Join(r.dir, filepath.Base(reqId)+".json")
+}
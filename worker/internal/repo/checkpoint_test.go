@@ -0,0 +1,101 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"worker/internal/infra"
+	mock_infra "worker/internal/infra/mocks"
+)
+
+func TestRedisCheckpointRepository(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mock_infra.NewMockRedisClient(ctrl)
+	repo := NewRedisCheckpointRepository(mockClient)
+
+	ctx := context.Background()
+
+	t.Run("Successful Load", func(t *testing.T) {
+		mockClient.EXPECT().Get(ctx, "checkpoint:req-id").Return(`{"tasks":[]}`, nil)
+
+		data, err := repo.Load(ctx, "req-id")
+
+		assert.NoError(t, err)
+		assert.Equal(t, []byte(`{"tasks":[]}`), data)
+	})
+
+	t.Run("Key Not Found", func(t *testing.T) {
+		mockClient.EXPECT().Get(ctx, "checkpoint:req-id").Return("", errors.New(infra.RedisKeyNotFound))
+
+		_, err := repo.Load(ctx, "req-id")
+
+		assert.EqualError(t, err, KeyNotFound)
+	})
+
+	t.Run("Error from Redis Client", func(t *testing.T) {
+		mockClient.EXPECT().Get(ctx, "checkpoint:req-id").Return("", errors.New("some error"))
+
+		_, err := repo.Load(ctx, "req-id")
+
+		assert.EqualError(t, err, "error getting checkpoint from repo: some error")
+	})
+
+	t.Run("Save", func(t *testing.T) {
+		mockClient.EXPECT().Set(ctx, "checkpoint:req-id", `{"tasks":[]}`).Return(nil)
+
+		assert.NoError(t, repo.Save(ctx, "req-id", []byte(`{"tasks":[]}`)))
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		mockClient.EXPECT().Del(ctx, "checkpoint:req-id").Return(nil)
+
+		assert.NoError(t, repo.Delete(ctx, "req-id"))
+	})
+}
+
+func TestFileCheckpointRepository(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "checkpoints")
+	repo := NewFileCheckpointRepository(dir)
+
+	t.Run("Key Not Found", func(t *testing.T) {
+		_, err := repo.Load(ctx, "req-id")
+
+		assert.EqualError(t, err, KeyNotFound)
+	})
+
+	t.Run("Save And Load", func(t *testing.T) {
+		assert.NoError(t, repo.Save(ctx, "req-id", []byte(`{"tasks":[]}`)))
+		assert.NoError(t, repo.Save(ctx, "req-id", []byte(`{"tasks":[{"url":"https://parserdigital.com/"}]}`)))
+
+		data, err := repo.Load(ctx, "req-id")
+
+		assert.NoError(t, err)
+		assert.Equal(t, []byte(`{"tasks":[{"url":"https://parserdigital.com/"}]}`), data)
+
+		// Only the checkpoint file is left, without the temporary ones
+		files, _ := os.ReadDir(dir)
+		assert.Len(t, files, 1)
+	})
+
+	t.Run("Request Id Outside The Directory", func(t *testing.T) {
+		assert.NoError(t, repo.Save(ctx, "../escaped", []byte("{}")))
+
+		_, err := os.Stat(filepath.Join(dir, "escaped.json"))
+		assert.NoError(t, err)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		assert.NoError(t, repo.Delete(ctx, "req-id"))
+		assert.NoError(t, repo.Delete(ctx, "req-id"))
+
+		_, err := repo.Load(ctx, "req-id")
+		assert.EqualError(t, err, KeyNotFound)
+	})
+}
@@ -0,0 +1,48 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"worker/internal/infra"
+)
+
+// historyPrefix namespaces the keys of the previous crawls of the sites
+const historyPrefix = "history:"
+
+// HistoryRepo stores the pages of the last crawl of each site by seed url, so the next crawl only downloads the pages
+// that changed
+type HistoryRepo interface {
+	Load(ctx context.Context, site string) ([]byte, error)
+	Save(ctx context.Context, site string, data []byte) error
+}
+
+type redisHistoryRepository struct {
+	client infra.RedisClient
+}
+
+// NewRedisHistoryRepository builds a history repository backed by Redis, shared by all the workers
+func NewRedisHistoryRepository(client infra.RedisClient) HistoryRepo {
+	return &redisHistoryRepository{
+		client: client,
+	}
+}
+
+// Load gets the last crawl of the site
+func (r *redisHistoryRepository) Load(ctx context.Context, site string) ([]byte, error) {
+	data, err := r.client.Get(ctx, historyPrefix+site)
+	if err != nil {
+		if err.Error() == infra.RedisKeyNotFound {
+			return nil, errors.New(KeyNotFound)
+		}
+
+		return nil, errors.New(fmt.Sprintf("error getting history from repo: %s", err))
+	}
+
+	return []byte(data), nil
+}
+
+// Save stores the last crawl of the site, replacing the previous one
+func (r *redisHistoryRepository) Save(ctx context.Context, site string, data []byte) error {
+	return r.client.Set(ctx, historyPrefix+site, string(data))
+}
@@ -0,0 +1,53 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"worker/internal/infra"
+	mock_infra "worker/internal/infra/mocks"
+)
+
+func TestRedisHistoryRepository(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mock_infra.NewMockRedisClient(ctrl)
+	repo := NewRedisHistoryRepository(mockClient)
+
+	ctx := context.Background()
+	site := "https://parserdigital.com/"
+
+	t.Run("Successful Load", func(t *testing.T) {
+		mockClient.EXPECT().Get(ctx, "history:"+site).Return(`{"pages":{}}`, nil)
+
+		data, err := repo.Load(ctx, site)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []byte(`{"pages":{}}`), data)
+	})
+
+	t.Run("Key Not Found", func(t *testing.T) {
+		mockClient.EXPECT().Get(ctx, "history:"+site).Return("", errors.New(infra.RedisKeyNotFound))
+
+		_, err := repo.Load(ctx, site)
+
+		assert.EqualError(t, err, KeyNotFound)
+	})
+
+	t.Run("Error from Redis Client", func(t *testing.T) {
+		mockClient.EXPECT().Get(ctx, "history:"+site).Return("", errors.New("some error"))
+
+		_, err := repo.Load(ctx, site)
+
+		assert.EqualError(t, err, "error getting history from repo: some error")
+	})
+
+	t.Run("Save", func(t *testing.T) {
+		mockClient.EXPECT().Set(ctx, "history:"+site, `{"pages":{}}`).Return(nil)
+
+		assert.NoError(t, repo.Save(ctx, site, []byte(`{"pages":{}}`)))
+	})
+}
@@ -0,0 +1,53 @@
+package repo
+
+import (
+	"context"
+	"time"
+	"worker/internal/infra"
+)
+
+// hostPrefix namespaces the keys of the request slots of the hosts
+const hostPrefix = "host:"
+
+// HostRepo spaces out the requests of all the workers to each host
+type HostRepo interface {
+	Reserve(ctx context.Context, host string, interval time.Duration) (time.Duration, error)
+	Pause(ctx context.Context, host string, pause time.Duration) error
+}
+
+type redisHostRepository struct {
+	client infra.RedisClient
+}
+
+// NewRedisHostRepository builds a host repository backed by Redis
+func NewRedisHostRepository(client infra.RedisClient) HostRepo {
+	return &redisHostRepository{
+		client: client,
+	}
+}
+
+// Reserve takes the request slot of the host for the interval. It returns zero when the slot was taken, or how long
+// until it is free when another worker holds it
+func (r *redisHostRepository) Reserve(ctx context.Context, host string, interval time.Duration) (time.Duration, error) {
+	ok, err := r.client.SetNX(ctx, hostPrefix+host, "1", interval)
+	if err != nil || ok {
+		return 0, err
+	}
+
+	wait, err := r.client.PTTL(ctx, hostPrefix+host)
+	if err != nil {
+		return 0, err
+	}
+
+	// The slot expired between both calls, so it is only worth a short wait before trying again
+	if wait <= 0 {
+		wait = time.Millisecond
+	}
+
+	return wait, nil
+}
+
+// Pause holds the request slot of the host for the pause, when the host throttles the crawler
+func (r *redisHostRepository) Pause(ctx context.Context, host string, pause time.Duration) error {
+	return r.client.SetTTL(ctx, hostPrefix+host, "paused", pause)
+}
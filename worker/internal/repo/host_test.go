@@ -0,0 +1,64 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+	mock_infra "worker/internal/infra/mocks"
+)
+
+func TestRedisHostRepository(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mock_infra.NewMockRedisClient(ctrl)
+	repo := NewRedisHostRepository(mockClient)
+
+	ctx := context.Background()
+
+	t.Run("Slot Taken", func(t *testing.T) {
+		mockClient.EXPECT().SetNX(ctx, "host:parserdigital.com", "1", time.Second).Return(true, nil)
+
+		wait, err := repo.Reserve(ctx, "parserdigital.com", time.Second)
+
+		assert.NoError(t, err)
+		assert.Zero(t, wait)
+	})
+
+	t.Run("Slot Held By Another Worker", func(t *testing.T) {
+		mockClient.EXPECT().SetNX(ctx, "host:parserdigital.com", "1", time.Second).Return(false, nil)
+		mockClient.EXPECT().PTTL(ctx, "host:parserdigital.com").Return(300*time.Millisecond, nil)
+
+		wait, err := repo.Reserve(ctx, "parserdigital.com", time.Second)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 300*time.Millisecond, wait)
+	})
+
+	t.Run("Slot Expired Meanwhile", func(t *testing.T) {
+		mockClient.EXPECT().SetNX(ctx, "host:parserdigital.com", "1", time.Second).Return(false, nil)
+		mockClient.EXPECT().PTTL(ctx, "host:parserdigital.com").Return(time.Duration(-2), nil)
+
+		wait, err := repo.Reserve(ctx, "parserdigital.com", time.Second)
+
+		assert.NoError(t, err)
+		assert.Equal(t, time.Millisecond, wait)
+	})
+
+	t.Run("Error from Redis Client", func(t *testing.T) {
+		mockClient.EXPECT().SetNX(ctx, "host:parserdigital.com", "1", time.Second).Return(false, errors.New("some error"))
+
+		_, err := repo.Reserve(ctx, "parserdigital.com", time.Second)
+
+		assert.EqualError(t, err, "some error")
+	})
+
+	t.Run("Pause", func(t *testing.T) {
+		mockClient.EXPECT().SetTTL(ctx, "host:parserdigital.com", "paused", time.Minute).Return(nil)
+
+		assert.NoError(t, repo.Pause(ctx, "parserdigital.com", time.Minute))
+	})
+}
@@ -0,0 +1,146 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"worker/internal/infra"
+)
+
+const (
+	// jobPrefix namespaces the keys of the distributed crawl jobs
+	jobPrefix = "job:"
+	// CounterPages and CounterBytes count the pages and bytes crawled in a job, to apply its limits
+	CounterPages = "pages"
+	CounterBytes = "bytes"
+	// CounterRetries counts the retries of a job, to share its retry budget across the workers
+	CounterRetries = "retries"
+	// CounterVisited, CounterFailed and CounterDisallowed count the pages of a job by what happened to them, to report
+	// its progress from any worker
+	CounterVisited    = "visited"
+	CounterFailed     = "failed"
+	CounterDisallowed = "disallowed"
+)
+
+// JobRepo holds the state of the distributed crawl jobs shared by all the workers: the visited urls, the page tasks
+// pending and done, the results of the pages, the counters of the limits and the reason the job was stopped
+type JobRepo interface {
+	Start(ctx context.Context, jobId string) (bool, error)
+	Claim(ctx context.Context, jobId, url string) (bool, error)
+	Seen(ctx context.Context, jobId, url string) (bool, error)
+	Visited(ctx context.Context, jobId string) (int64, error)
+	AddPending(ctx context.Context, jobId string, n int64) (int64, error)
+	Finish(ctx context.Context, jobId, url string) (bool, error)
+	Count(ctx context.Context, jobId, counter string, n int64) (int64, error)
+	SaveResult(ctx context.Context, jobId, url string, data []byte) error
+	Results(ctx context.Context, jobId string) (map[string][]byte, error)
+	Stop(ctx context.Context, jobId, reason string) error
+	Stopped(ctx context.Context, jobId string) (string, error)
+	Delete(ctx context.Context, jobId string) error
+}
+
+type redisJobRepository struct {
+	client infra.RedisClient
+}
+
+// NewRedisJobRepository builds a job repository backed by Redis
+func NewRedisJobRepository(client infra.RedisClient) JobRepo {
+	return &redisJobRepository{
+		client: client,
+	}
+}
+
+// key returns the redis key of a part of the job state
+func (r *redisJobRepository) key(jobId, part string) string {
+	return jobPrefix + jobId + ":" + part
+}
+
+// Start marks the job as started and reports whether it was not started before, which is false when the job is
+// delivered again to a worker
+func (r *redisJobRepository) Start(ctx context.Context, jobId string) (bool, error) {
+	return r.client.SetNX(ctx, r.key(jobId, "started"), time.Now().UTC().Format(time.RFC3339), 0)
+}
+
+// Claim adds the url to the visited set of the job and reports whether it was not visited before
+func (r *redisJobRepository) Claim(ctx context.Context, jobId, url string) (bool, error) {
+	return r.client.SAdd(ctx, r.key(jobId, "visited"), url)
+}
+
+// Seen checks if the url is in the visited set of the job
+func (r *redisJobRepository) Seen(ctx context.Context, jobId, url string) (bool, error) {
+	return r.client.SIsMember(ctx, r.key(jobId, "visited"), url)
+}
+
+// Visited returns the number of urls in the visited set of the job
+func (r *redisJobRepository) Visited(ctx context.Context, jobId string) (int64, error) {
+	return r.client.SCard(ctx, r.key(jobId, "visited"))
+}
+
+// AddPending adds n to the number of page tasks of the job that are queued or being processed, and returns it
+func (r *redisJobRepository) AddPending(ctx context.Context, jobId string, n int64) (int64, error) {
+	return r.client.IncrBy(ctx, r.key(jobId, "pending"), n)
+}
+
+// Finish adds the url to the tasks done of the job and reports whether it was not done before, so a task delivered
+// again is only counted once
+func (r *redisJobRepository) Finish(ctx context.Context, jobId, url string) (bool, error) {
+	return r.client.SAdd(ctx, r.key(jobId, "done"), url)
+}
+
+// Count adds n to a counter of the job, such as its pages or bytes, and returns it
+func (r *redisJobRepository) Count(ctx context.Context, jobId, counter string, n int64) (int64, error) {
+	return r.client.IncrBy(ctx, r.key(jobId, "count:"+counter), n)
+}
+
+// SaveResult stores the result of crawling a page of the job, replacing the previous one
+func (r *redisJobRepository) SaveResult(ctx context.Context, jobId, url string, data []byte) error {
+	return r.client.HSet(ctx, r.key(jobId, "results"), url, string(data))
+}
+
+// Results gets the results of all the pages crawled in the job by url
+func (r *redisJobRepository) Results(ctx context.Context, jobId string) (map[string][]byte, error) {
+	fields, err := r.client.HGetAll(ctx, r.key(jobId, "results"))
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error getting results from repo: %s", err))
+	}
+
+	results := make(map[string][]byte, len(fields))
+	for url, data := range fields {
+		results[url] = []byte(data)
+	}
+
+	return results, nil
+}
+
+// Stop stops the job, keeping the first reason given
+func (r *redisJobRepository) Stop(ctx context.Context, jobId, reason string) error {
+	_, err := r.client.SetNX(ctx, r.key(jobId, "stopped"), reason, 0)
+	return err
+}
+
+// Stopped returns the reason the job was stopped, or an empty string when it is running
+func (r *redisJobRepository) Stopped(ctx context.Context, jobId string) (string, error) {
+	reason, err := r.client.Get(ctx, r.key(jobId, "stopped"))
+	if err != nil {
+		if err.Error() == infra.RedisKeyNotFound {
+			return "", nil
+		}
+
+		return "", errors.New(fmt.Sprintf("error getting job state from repo: %s", err))
+	}
+
+	return reason, nil
+}
+
+// Delete removes the state of a finished job
+func (r *redisJobRepository) Delete(ctx context.Context, jobId string) error {
+	var keys []string
+	for _, part := range []string{"started", "visited", "pending", "done", "results", "stopped",
+		"count:" + CounterPages, "count:" + CounterBytes, "count:" + CounterRetries,
+		"count:" + CounterVisited, "count:" + CounterFailed, "count:" + CounterDisallowed} {
+		keys = append(keys, r.key(jobId, part))
+	}
+
+	return r.client.Del(ctx, keys...)
+}
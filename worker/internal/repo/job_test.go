@@ -0,0 +1,123 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"worker/internal/infra"
+	mock_infra "worker/internal/infra/mocks"
+)
+
+func TestRedisJobRepository(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mock_infra.NewMockRedisClient(ctrl)
+	repo := NewRedisJobRepository(mockClient)
+
+	ctx := context.Background()
+	url := "https://parserdigital.com/"
+
+	t.Run("Start", func(t *testing.T) {
+		mockClient.EXPECT().SetNX(ctx, "job:req-id:started", gomock.Any(), gomock.Any()).Return(true, nil)
+
+		started, err := repo.Start(ctx, "req-id")
+
+		assert.NoError(t, err)
+		assert.True(t, started)
+	})
+
+	t.Run("Claim And Seen", func(t *testing.T) {
+		mockClient.EXPECT().SAdd(ctx, "job:req-id:visited", url).Return(false, nil)
+		mockClient.EXPECT().SIsMember(ctx, "job:req-id:visited", url).Return(true, nil)
+
+		claimed, err := repo.Claim(ctx, "req-id", url)
+		assert.NoError(t, err)
+		assert.False(t, claimed)
+
+		seen, err := repo.Seen(ctx, "req-id", url)
+		assert.NoError(t, err)
+		assert.True(t, seen)
+	})
+
+	t.Run("Visited", func(t *testing.T) {
+		mockClient.EXPECT().SCard(ctx, "job:req-id:visited").Return(int64(3), nil)
+
+		visited, err := repo.Visited(ctx, "req-id")
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), visited)
+	})
+
+	t.Run("Pending And Finish", func(t *testing.T) {
+		mockClient.EXPECT().IncrBy(ctx, "job:req-id:pending", int64(-1)).Return(int64(2), nil)
+		mockClient.EXPECT().SAdd(ctx, "job:req-id:done", url).Return(true, nil)
+
+		pending, err := repo.AddPending(ctx, "req-id", -1)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), pending)
+
+		first, err := repo.Finish(ctx, "req-id", url)
+		assert.NoError(t, err)
+		assert.True(t, first)
+	})
+
+	t.Run("Count", func(t *testing.T) {
+		mockClient.EXPECT().IncrBy(ctx, "job:req-id:count:bytes", int64(512)).Return(int64(1024), nil)
+
+		bytes, err := repo.Count(ctx, "req-id", CounterBytes, 512)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1024), bytes)
+	})
+
+	t.Run("Results", func(t *testing.T) {
+		mockClient.EXPECT().HSet(ctx, "job:req-id:results", url, `{"tasks":[]}`).Return(nil)
+		mockClient.EXPECT().HGetAll(ctx, "job:req-id:results").Return(map[string]string{url: `{"tasks":[]}`}, nil)
+
+		assert.NoError(t, repo.SaveResult(ctx, "req-id", url, []byte(`{"tasks":[]}`)))
+
+		results, err := repo.Results(ctx, "req-id")
+		assert.NoError(t, err)
+		assert.Equal(t, map[string][]byte{url: []byte(`{"tasks":[]}`)}, results)
+	})
+
+	t.Run("Error Getting Results", func(t *testing.T) {
+		mockClient.EXPECT().HGetAll(ctx, "job:req-id:results").Return(nil, errors.New("some error"))
+
+		_, err := repo.Results(ctx, "req-id")
+
+		assert.EqualError(t, err, "error getting results from repo: some error")
+	})
+
+	t.Run("Stop And Stopped", func(t *testing.T) {
+		mockClient.EXPECT().SetNX(ctx, "job:req-id:stopped", "maxPages", gomock.Any()).Return(true, nil)
+		mockClient.EXPECT().Get(ctx, "job:req-id:stopped").Return("maxPages", nil)
+
+		assert.NoError(t, repo.Stop(ctx, "req-id", "maxPages"))
+
+		reason, err := repo.Stopped(ctx, "req-id")
+		assert.NoError(t, err)
+		assert.Equal(t, "maxPages", reason)
+	})
+
+	t.Run("Running", func(t *testing.T) {
+		mockClient.EXPECT().Get(ctx, "job:req-id:stopped").Return("", errors.New(infra.RedisKeyNotFound))
+
+		reason, err := repo.Stopped(ctx, "req-id")
+
+		assert.NoError(t, err)
+		assert.Empty(t, reason)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		mockClient.EXPECT().Del(ctx, "job:req-id:started", "job:req-id:visited", "job:req-id:pending",
+			"job:req-id:done", "job:req-id:results", "job:req-id:stopped", "job:req-id:count:pages",
+			"job:req-id:count:bytes", "job:req-id:count:retries", "job:req-id:count:visited", "job:req-id:count:failed",
+			"job:req-id:count:disallowed").Return(nil)
+
+		assert.NoError(t, repo.Delete(ctx, "req-id"))
+	})
+}
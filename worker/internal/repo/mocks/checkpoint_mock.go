@@ -0,0 +1,78 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: checkpoint.go
+
+// Package mock_repo is a generated GoMock package.
+package mock_repo
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockCheckpointRepo is a mock of CheckpointRepo interface.
+type MockCheckpointRepo struct {
+	ctrl     *gomock.Controller
+	recorder *MockCheckpointRepoMockRecorder
+}
+
+// MockCheckpointRepoMockRecorder is the mock recorder for MockCheckpointRepo.
+type MockCheckpointRepoMockRecorder struct {
+	mock *MockCheckpointRepo
+}
+
+// NewMockCheckpointRepo creates a new mock instance.
+func NewMockCheckpointRepo(ctrl *gomock.Controller) *MockCheckpointRepo {
+	mock := &MockCheckpointRepo{ctrl: ctrl}
+	mock.recorder = &MockCheckpointRepoMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockCheckpointRepo) EXPECT() *MockCheckpointRepoMockRecorder {
+	return m.recorder
+}
+
+// Delete mocks base method.
+func (m *MockCheckpointRepo) Delete(ctx context.Context, reqId string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, reqId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockCheckpointRepoMockRecorder) Delete(ctx, reqId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockCheckpointRepo)(nil).Delete), ctx, reqId)
+}
+
+// Load mocks base method.
+func (m *MockCheckpointRepo) Load(ctx context.Context, reqId string) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Load", ctx, reqId)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Load indicates an expected call of Load.
+func (mr *MockCheckpointRepoMockRecorder) Load(ctx, reqId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Load", reflect.TypeOf((*MockCheckpointRepo)(nil).Load), ctx, reqId)
+}
+
+// Save mocks base method.
+func (m *MockCheckpointRepo) Save(ctx context.Context, reqId string, data []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Save", ctx, reqId, data)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Save indicates an expected call of Save.
+func (mr *MockCheckpointRepoMockRecorder) Save(ctx, reqId, data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockCheckpointRepo)(nil).Save), ctx, reqId, data)
+}
@@ -0,0 +1,65 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: host.go
+
+// Package mock_repo is a generated GoMock package.
+package mock_repo
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockHostRepo is a mock of HostRepo interface.
+type MockHostRepo struct {
+	ctrl     *gomock.Controller
+	recorder *MockHostRepoMockRecorder
+}
+
+// MockHostRepoMockRecorder is the mock recorder for MockHostRepo.
+type MockHostRepoMockRecorder struct {
+	mock *MockHostRepo
+}
+
+// NewMockHostRepo creates a new mock instance.
+func NewMockHostRepo(ctrl *gomock.Controller) *MockHostRepo {
+	mock := &MockHostRepo{ctrl: ctrl}
+	mock.recorder = &MockHostRepoMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockHostRepo) EXPECT() *MockHostRepoMockRecorder {
+	return m.recorder
+}
+
+// Pause mocks base method.
+func (m *MockHostRepo) Pause(ctx context.Context, host string, pause time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Pause", ctx, host, pause)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Pause indicates an expected call of Pause.
+func (mr *MockHostRepoMockRecorder) Pause(ctx, host, pause interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Pause", reflect.TypeOf((*MockHostRepo)(nil).Pause), ctx, host, pause)
+}
+
+// Reserve mocks base method.
+func (m *MockHostRepo) Reserve(ctx context.Context, host string, interval time.Duration) (time.Duration, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reserve", ctx, host, interval)
+	ret0, _ := ret[0].(time.Duration)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Reserve indicates an expected call of Reserve.
+func (mr *MockHostRepoMockRecorder) Reserve(ctx, host, interval interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reserve", reflect.TypeOf((*MockHostRepo)(nil).Reserve), ctx, host, interval)
+}
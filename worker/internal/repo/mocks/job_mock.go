@@ -0,0 +1,212 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: job.go
+
+// Package mock_repo is a generated GoMock package.
+package mock_repo
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockJobRepo is a mock of JobRepo interface.
+type MockJobRepo struct {
+	ctrl     *gomock.Controller
+	recorder *MockJobRepoMockRecorder
+}
+
+// MockJobRepoMockRecorder is the mock recorder for MockJobRepo.
+type MockJobRepoMockRecorder struct {
+	mock *MockJobRepo
+}
+
+// NewMockJobRepo creates a new mock instance.
+func NewMockJobRepo(ctrl *gomock.Controller) *MockJobRepo {
+	mock := &MockJobRepo{ctrl: ctrl}
+	mock.recorder = &MockJobRepoMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockJobRepo) EXPECT() *MockJobRepoMockRecorder {
+	return m.recorder
+}
+
+// AddPending mocks base method.
+func (m *MockJobRepo) AddPending(ctx context.Context, jobId string, n int64) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddPending", ctx, jobId, n)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddPending indicates an expected call of AddPending.
+func (mr *MockJobRepoMockRecorder) AddPending(ctx, jobId, n interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddPending", reflect.TypeOf((*MockJobRepo)(nil).AddPending), ctx, jobId, n)
+}
+
+// Claim mocks base method.
+func (m *MockJobRepo) Claim(ctx context.Context, jobId, url string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Claim", ctx, jobId, url)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Claim indicates an expected call of Claim.
+func (mr *MockJobRepoMockRecorder) Claim(ctx, jobId, url interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Claim", reflect.TypeOf((*MockJobRepo)(nil).Claim), ctx, jobId, url)
+}
+
+// Count mocks base method.
+func (m *MockJobRepo) Count(ctx context.Context, jobId, counter string, n int64) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Count", ctx, jobId, counter, n)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Count indicates an expected call of Count.
+func (mr *MockJobRepoMockRecorder) Count(ctx, jobId, counter, n interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Count", reflect.TypeOf((*MockJobRepo)(nil).Count), ctx, jobId, counter, n)
+}
+
+// Delete mocks base method.
+func (m *MockJobRepo) Delete(ctx context.Context, jobId string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, jobId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockJobRepoMockRecorder) Delete(ctx, jobId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockJobRepo)(nil).Delete), ctx, jobId)
+}
+
+// Finish mocks base method.
+func (m *MockJobRepo) Finish(ctx context.Context, jobId, url string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Finish", ctx, jobId, url)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Finish indicates an expected call of Finish.
+func (mr *MockJobRepoMockRecorder) Finish(ctx, jobId, url interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Finish", reflect.TypeOf((*MockJobRepo)(nil).Finish), ctx, jobId, url)
+}
+
+// Results mocks base method.
+func (m *MockJobRepo) Results(ctx context.Context, jobId string) (map[string][]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Results", ctx, jobId)
+	ret0, _ := ret[0].(map[string][]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Results indicates an expected call of Results.
+func (mr *MockJobRepoMockRecorder) Results(ctx, jobId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Results", reflect.TypeOf((*MockJobRepo)(nil).Results), ctx, jobId)
+}
+
+// SaveResult mocks base method.
+func (m *MockJobRepo) SaveResult(ctx context.Context, jobId, url string, data []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveResult", ctx, jobId, url, data)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveResult indicates an expected call of SaveResult.
+func (mr *MockJobRepoMockRecorder) SaveResult(ctx, jobId, url, data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveResult", reflect.TypeOf((*MockJobRepo)(nil).SaveResult), ctx, jobId, url, data)
+}
+
+// Seen mocks base method.
+func (m *MockJobRepo) Seen(ctx context.Context, jobId, url string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Seen", ctx, jobId, url)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Seen indicates an expected call of Seen.
+func (mr *MockJobRepoMockRecorder) Seen(ctx, jobId, url interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Seen", reflect.TypeOf((*MockJobRepo)(nil).Seen), ctx, jobId, url)
+}
+
+// Start mocks base method.
+func (m *MockJobRepo) Start(ctx context.Context, jobId string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Start", ctx, jobId)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Start indicates an expected call of Start.
+func (mr *MockJobRepoMockRecorder) Start(ctx, jobId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Start", reflect.TypeOf((*MockJobRepo)(nil).Start), ctx, jobId)
+}
+
+// Stop mocks base method.
+func (m *MockJobRepo) Stop(ctx context.Context, jobId, reason string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stop", ctx, jobId, reason)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Stop indicates an expected call of Stop.
+func (mr *MockJobRepoMockRecorder) Stop(ctx, jobId, reason interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stop", reflect.TypeOf((*MockJobRepo)(nil).Stop), ctx, jobId, reason)
+}
+
+// Stopped mocks base method.
+func (m *MockJobRepo) Stopped(ctx context.Context, jobId string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stopped", ctx, jobId)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Stopped indicates an expected call of Stopped.
+func (mr *MockJobRepoMockRecorder) Stopped(ctx, jobId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stopped", reflect.TypeOf((*MockJobRepo)(nil).Stopped), ctx, jobId)
+}
+
+// Visited mocks base method.
+func (m *MockJobRepo) Visited(ctx context.Context, jobId string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Visited", ctx, jobId)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Visited indicates an expected call of Visited.
+func (mr *MockJobRepoMockRecorder) Visited(ctx, jobId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Visited", reflect.TypeOf((*MockJobRepo)(nil).Visited), ctx, jobId)
+}
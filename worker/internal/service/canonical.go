@@ -0,0 +1,131 @@
+package service
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"worker/internal/model"
+)
+
+// defaultPorts maps each scheme to the port that is stripped from its urls
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// canonicalizer normalizes urls so different spellings of the same page are visited and stored once
+type canonicalizer struct {
+	rules model.CanonicalRules
+}
+
+// newCanonicalizer builds a canonicalizer for the rules of a crawl job
+func newCanonicalizer(rules *model.CanonicalRules) canonicalizer {
+	c := canonicalizer{}
+	if rules != nil {
+		c.rules = *rules
+	}
+
+	return c
+}
+
+// canonicalize returns the canonical form of the url: without fragment, with lowercase scheme and host, punycode
+// host, no default port and no dot segments. Depending on the rules it also sorts the query and adds or removes the
+// trailing slash
+func (c canonicalizer) canonicalize(u *url.URL) *url.URL {
+	res := *u
+	res.Fragment = ""
+	res.RawFragment = ""
+	res.Scheme = strings.ToLower(res.Scheme)
+
+	host, port := normalizeHost(res.Hostname()), res.Port()
+	if port == defaultPorts[res.Scheme] {
+		port = ""
+	}
+
+	switch {
+	case port != "":
+		res.Host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		res.Host = "[" + host + "]"
+	default:
+		res.Host = host
+	}
+
+	path := removeDotSegments(res.EscapedPath())
+	if path == "" && res.Host != "" {
+		path = "/"
+	}
+
+	switch c.rules.TrailingSlash {
+	case model.TrailingSlashAdd:
+		if !strings.HasSuffix(path, "/") {
+			path += "/"
+		}
+	case model.TrailingSlashRemove:
+		if trimmed := strings.TrimRight(path, "/"); trimmed != "" {
+			path = trimmed
+		} else if path != "" {
+			path = "/"
+		}
+	}
+
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		res.Path, res.RawPath = unescaped, path
+	}
+
+	res.ForceQuery = false
+	if c.rules.SortQuery && res.RawQuery != "" {
+		if values, err := url.ParseQuery(res.RawQuery); err == nil {
+			res.RawQuery = values.Encode()
+		}
+	}
+
+	return &res
+}
+
+// canonicalString parses the url and returns its canonical form as a string
+func (c canonicalizer) canonicalString(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	return c.canonicalize(u).String(), nil
+}
+
+// removeDotSegments resolves the "." and ".." segments of a path as described in RFC 3986 section 5.2.4
+func removeDotSegments(path string) string {
+	if !strings.Contains(path, ".") {
+		return path
+	}
+
+	segments := strings.Split(path, "/")
+	out := make([]string, 0, len(segments))
+
+	for i, segment := range segments {
+		last := i == len(segments)-1
+
+		switch segment {
+		case ".":
+			if last {
+				out = append(out, "")
+			}
+		case "..":
+			if len(out) > 1 {
+				out = out[:len(out)-1]
+			}
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, segment)
+		}
+	}
+
+	res := strings.Join(out, "/")
+	if strings.HasPrefix(path, "/") && !strings.HasPrefix(res, "/") {
+		res = "/" + res
+	}
+
+	return res
+}
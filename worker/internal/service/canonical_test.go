@@ -0,0 +1,56 @@
+package service
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"worker/internal/model"
+)
+
+func TestCanonicalizer_CanonicalString(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    *model.CanonicalRules
+		url      string
+		expected string
+	}{
+		{"Fragment", nil, "https://parserdigital.com/about#team", "https://parserdigital.com/about"},
+		{"Scheme And Host Case", nil, "HTTPS://ParserDigital.COM/About", "https://parserdigital.com/About"},
+		{"Default Port", nil, "HTTP://parserdigital.com:80/about", "http://parserdigital.com/about"},
+		{"Default Https Port", nil, "https://parserdigital.com:443/about", "https://parserdigital.com/about"},
+		{"Other Port", nil, "https://parserdigital.com:8443/about", "https://parserdigital.com:8443/about"},
+		{"Empty Path", nil, "https://parserdigital.com", "https://parserdigital.com/"},
+		{"Dot Segments", nil, "https://parserdigital.com/a/./b/../c", "https://parserdigital.com/a/c"},
+		{"Dot Segments Above Root", nil, "https://parserdigital.com/../a", "https://parserdigital.com/a"},
+		{"IDN Host", nil, "https://Bücher.example/katalog", "https://xn--bcher-kva.example/katalog"},
+		{"Query Kept", nil, "https://parserdigital.com/?b=1&a=2", "https://parserdigital.com/?b=1&a=2"},
+		{"Query Sorted", &model.CanonicalRules{SortQuery: true}, "https://parserdigital.com/?b=1&a=2", "https://parserdigital.com/?a=2&b=1"},
+		{"Trailing Slash Kept", nil, "https://parserdigital.com/about/", "https://parserdigital.com/about/"},
+		{"Trailing Slash Removed", &model.CanonicalRules{TrailingSlash: model.TrailingSlashRemove}, "https://parserdigital.com/about/", "https://parserdigital.com/about"},
+		{"Root Slash Not Removed", &model.CanonicalRules{TrailingSlash: model.TrailingSlashRemove}, "https://parserdigital.com/", "https://parserdigital.com/"},
+		{"Trailing Slash Added", &model.CanonicalRules{TrailingSlash: model.TrailingSlashAdd}, "https://parserdigital.com/about", "https://parserdigital.com/about/"},
+		{"Escaped Path", nil, "https://parserdigital.com/a%2Fb/c%20d", "https://parserdigital.com/a%2Fb/c%20d"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			canonical, err := newCanonicalizer(tt.rules).canonicalString(tt.url)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, canonical)
+		})
+	}
+}
+
+func TestRemoveDotSegments(t *testing.T) {
+	tests := map[string]string{
+		"/a/b/c/./../../g": "/a/g",
+		"/a/..":            "/",
+		"/a/.":             "/a/",
+		"/a/b/":            "/a/b/",
+		"/file.html":       "/file.html",
+	}
+
+	for path, expected := range tests {
+		assert.Equal(t, expected, removeDotSegments(path), path)
+	}
+}
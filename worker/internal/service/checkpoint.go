@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"worker/internal/model"
+	"worker/internal/repo"
+)
+
+// checkpoint is the state of a crawl job saved while it runs, enough to resume it from another worker
+type checkpoint struct {
+	// Listed are the urls of the sitemap files, which are not fetched again when resuming
+	Listed []string `json:"listed,omitempty"`
+	// Tasks are the pages being visited and waiting in the frontier
+	Tasks        []checkpointTask                 `json:"tasks"`
+	Visited      []string                         `json:"visited"`
+	Sitemap      model.Sitemap                    `json:"sitemap"`
+	Fingerprints map[string]checkpointFingerprint `json:"fingerprints,omitempty"`
+	Stats        checkpointStats                  `json:"stats"`
+	Bytes        int64                            `json:"bytes"`
+	RetriesLeft  int                              `json:"retriesLeft"`
+	// Elapsed is the time the job has been crawling, in milliseconds, to keep enforcing its time limit
+	Elapsed int64 `json:"elapsed"`
+}
+
+type checkpointTask struct {
+	Url   string `json:"url"`
+	Depth int    `json:"depth"`
+}
+
+type checkpointFingerprint struct {
+	Canonical string `json:"canonical,omitempty"`
+	Hash      string `json:"hash"`
+	SimHash   uint64 `json:"simHash"`
+}
+
+type checkpointStats struct {
+	Visited     int `json:"visited"`
+	Failed      int `json:"failed"`
+	ErrorStatus int `json:"errorStatus"`
+	Disallowed  int `json:"disallowed"`
+}
+
+// checkpoint marshals the state of the session. The session is locked while it is copied, so the frontier, the
+// visited urls and the sitemap are consistent with each other
+func (cs *crawlSession) checkpoint(listed []string) ([]byte, error) {
+	cs.visitedMu.Lock()
+	defer cs.visitedMu.Unlock()
+	cs.sitemapPageMu.Lock()
+	defer cs.sitemapPageMu.Unlock()
+
+	cp := &checkpoint{
+		Listed:       listed,
+		Visited:      make([]string, 0, len(cs.visitedURLs)),
+		Sitemap:      *cs.sitemap,
+		Fingerprints: make(map[string]checkpointFingerprint, len(cs.fingerprints)),
+		Stats: checkpointStats{
+			Visited:     cs.stats.visited,
+			Failed:      cs.stats.failed,
+			ErrorStatus: cs.stats.errorStatus,
+			Disallowed:  cs.stats.disallowed,
+		},
+		Bytes:       cs.bytes,
+		RetriesLeft: cs.retriesLeft,
+		Elapsed:     time.Since(cs.startedAt).Milliseconds(),
+	}
+
+	for _, task := range cs.frontier.tasks() {
+		cp.Tasks = append(cp.Tasks, checkpointTask{Url: task.url, Depth: task.depth})
+	}
+	for link := range cs.visitedURLs {
+		cp.Visited = append(cp.Visited, link)
+	}
+	for link, fp := range cs.fingerprints {
+		cp.Fingerprints[link] = checkpointFingerprint{Canonical: fp.canonical, Hash: fp.hash, SimHash: fp.simHash}
+	}
+
+	return json.Marshal(cp)
+}
+
+// restore loads a checkpoint into a new session and returns the urls listed in the sitemap files. The pages being
+// visited when the checkpoint was taken are visited again unless they were already recorded, and the links of the
+// recorded pages that did not reach the frontier are pushed to it
+func (cs *crawlSession) restore(data []byte) ([]string, error) {
+	cp := &checkpoint{}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, errors.New(fmt.Sprintf("error unmarshaling checkpoint: %s", err))
+	}
+
+	sitemap := cp.Sitemap
+	if sitemap.Pages == nil {
+		sitemap.Pages = make(map[string][]string)
+	}
+	if sitemap.PageInfo == nil {
+		sitemap.PageInfo = make(map[string]model.PageInfo)
+	}
+	if sitemap.Links == nil {
+		sitemap.Links = make(map[string][]model.Link)
+	}
+	cs.sitemap = &sitemap
+
+	for _, link := range cp.Visited {
+		cs.visitedURLs[link] = true
+	}
+	for link, fp := range cp.Fingerprints {
+		cs.fingerprints[link] = fingerprint{canonical: fp.Canonical, hash: fp.Hash, simHash: fp.SimHash}
+	}
+
+	cs.stats = sessionStats{
+		visited:     cp.Stats.Visited,
+		failed:      cp.Stats.Failed,
+		errorStatus: cp.Stats.ErrorStatus,
+		disallowed:  cp.Stats.Disallowed,
+	}
+	// The pages reserved by the interrupted visits are given back
+	cs.pages = cs.stats.visited + cs.stats.failed
+	cs.bytes = cp.Bytes
+	cs.retriesLeft = cp.RetriesLeft
+	cs.startedAt = time.Now().Add(-time.Duration(cp.Elapsed) * time.Millisecond)
+
+	// pending are the links already in the frontier or not to be crawled, so they are not pushed again
+	pending := make(map[string]bool, len(sitemap.Disallowed)+len(cp.Tasks))
+	for _, link := range sitemap.Disallowed {
+		pending[link] = true
+	}
+	for _, task := range cp.Tasks {
+		if _, recorded := sitemap.PageInfo[task.Url]; recorded || pending[task.Url] {
+			continue
+		}
+		pending[task.Url] = true
+		cs.frontier.push(crawlTask{url: task.Url, depth: task.Depth})
+	}
+
+	for link, links := range sitemap.Pages {
+		for _, l := range links {
+			depth := sitemap.PageInfo[link].Depth + 1
+			if _, recorded := sitemap.PageInfo[l]; recorded || pending[l] || !cs.visitedURLs[l] {
+				cs.enqueue(l, depth)
+				continue
+			}
+			// The link was claimed when the checkpoint was taken, but it was not pushed to the frontier yet
+			pending[l] = true
+			cs.frontier.push(crawlTask{url: l, depth: depth})
+		}
+	}
+
+	return cp.Listed, nil
+}
+
+// resume restores the session from the checkpoint of the job, if there is one. It reports whether the job was resumed
+// and the urls listed in the sitemap files
+func (s *crawlService) resume(ctx context.Context, sess *crawlSession, reqId string) (bool, []string) {
+	if s.checkpoints == nil || reqId == "" {
+		return false, nil
+	}
+
+	data, err := s.checkpoints.Load(ctx, reqId)
+	if err != nil {
+		if err.Error() != repo.KeyNotFound {
+			log.Printf("error loading the checkpoint of %s, starting over: %s", reqId, err)
+		}
+		return false, nil
+	}
+
+	listed, err := sess.restore(data)
+	if err != nil {
+		log.Printf("error restoring the checkpoint of %s, starting over: %s", reqId, err)
+		return false, nil
+	}
+
+	return true, listed
+}
+
+// saveCheckpoint stores the state of the session in the checkpoint of the job
+func (s *crawlService) saveCheckpoint(ctx context.Context, sess *crawlSession, reqId string, listed []string) {
+	data, err := sess.checkpoint(listed)
+	if err != nil {
+		log.Printf("error marshaling the checkpoint of %s: %s", reqId, err)
+		return
+	}
+
+	if err := s.checkpoints.Save(ctx, reqId, data); err != nil {
+		log.Printf("error saving the checkpoint of %s: %s", reqId, err)
+	}
+}
+
+// startCheckpoints saves the checkpoint of the job at the configured interval while it crawls. The returned function
+// stops saving it and deletes it, once the job is over
+func (s *crawlService) startCheckpoints(sess *crawlSession, reqId string, listed []string) func() {
+	if s.checkpoints == nil || reqId == "" || s.config.CheckpointInterval <= 0 {
+		return func() {}
+	}
+
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(s.config.CheckpointInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.saveCheckpoint(context.Background(), sess, reqId, listed)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+
+		if err := s.checkpoints.Delete(context.Background(), reqId); err != nil {
+			log.Printf("error deleting the checkpoint of %s: %s", reqId, err)
+		}
+	}
+}
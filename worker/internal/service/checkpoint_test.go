@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+	"worker/internal/model"
+	"worker/internal/repo"
+	mock_repo "worker/internal/repo/mocks"
+	mock_service "worker/internal/service/mocks"
+)
+
+// newTestSession builds a session for the url with the default settings
+func newTestSession(url string) *crawlSession {
+	return newCrawlSession(&model.Request{Url: url}, nil, nil, retryPolicy{}, 10)
+}
+
+func TestCrawlSession_CheckpointRestore(t *testing.T) {
+	url := "https://parserdigital.com/"
+
+	sess := newTestSession(url)
+	sess.enqueue(url, 0)
+	seed, _ := sess.frontier.pop()
+	sess.addPage(url, []string{url + "career", url + "contact-us"}, nil, model.PageInfo{Status: http.StatusOK})
+	sess.addFingerprint(url, fingerprint{hash: "hash", simHash: 42})
+	sess.enqueue(url+"career", 1)
+	sess.frontier.done(seed)
+
+	// The career page is being visited, and contact-us was found by the seed but never reached the frontier
+	career, _ := sess.frontier.pop()
+	sess.enqueue(url+"people", 2)
+	sess.markDisallowed(url + "private")
+	sess.bytes = 1024
+	sess.retriesLeft = 7
+	sess.startedAt = time.Now().Add(-time.Minute)
+
+	data, err := sess.checkpoint([]string{url + "listed"})
+	assert.NoError(t, err)
+	sess.frontier.done(career)
+
+	restored := newTestSession(url)
+	listed, err := restored.restore(data)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{url + "listed"}, listed)
+	assert.Equal(t, sess.sitemap.Pages, restored.sitemap.Pages)
+	assert.Equal(t, sess.sitemap.Disallowed, restored.sitemap.Disallowed)
+	assert.Equal(t, sess.fingerprints, restored.fingerprints)
+	assert.Equal(t, sessionStats{visited: 1, disallowed: 1}, restored.stats)
+	assert.Equal(t, 1, restored.pages)
+	assert.Equal(t, int64(1024), restored.bytes)
+	assert.Equal(t, 7, restored.retriesLeft)
+	assert.InDelta(t, time.Minute, time.Since(restored.startedAt), float64(time.Second))
+
+	assert.Equal(t, []crawlTask{
+		{url: url + "career", depth: 1},
+		{url: url + "people", depth: 2},
+		{url: url + "contact-us", depth: 1},
+	}, restored.frontier.tasks())
+	for _, link := range []string{url, url + "career", url + "contact-us", url + "people"} {
+		assert.True(t, restored.seen(link), link)
+	}
+}
+
+func TestCrawlSession_Restore_ClaimedLinks(t *testing.T) {
+	url := "https://parserdigital.com/"
+
+	// The seed was crawled and career was claimed, but the checkpoint was taken before career reached the frontier
+	cp := checkpoint{
+		Tasks:   []checkpointTask{{Url: url + "people", Depth: 1}},
+		Visited: []string{url, url + "career", url + "people", url + "about", url + "private"},
+		Sitemap: model.Sitemap{
+			Pages: map[string][]string{
+				url:           {url + "career", url + "people", url + "about", url + "private", url + "contact-us"},
+				url + "about": {url},
+			},
+			PageInfo: map[string]model.PageInfo{
+				url:           {Status: http.StatusOK},
+				url + "about": {Status: http.StatusOK, Depth: 1},
+			},
+			Disallowed: []string{url + "private"},
+		},
+		Stats: checkpointStats{Visited: 2, Disallowed: 1},
+	}
+	data, err := json.Marshal(&cp)
+	assert.NoError(t, err)
+
+	restored := newTestSession(url)
+	_, err = restored.restore(data)
+	assert.NoError(t, err)
+
+	assert.ElementsMatch(t, []crawlTask{
+		{url: url + "people", depth: 1},
+		{url: url + "career", depth: 1},
+		{url: url + "contact-us", depth: 1},
+	}, restored.frontier.tasks())
+}
+
+func TestCrawlSession_Restore_Invalid(t *testing.T) {
+	_, err := newTestSession("https://parserdigital.com/").restore([]byte("{"))
+
+	assert.EqualError(t, err, "error unmarshaling checkpoint: unexpected end of JSON input")
+}
+
+func TestCrawlService_Crawl_Resume(t *testing.T) {
+	url := "https://parserdigital.com/"
+
+	mockHttp := mock_service.NewHttpMock(url)
+	mockHttp.RegisterResponders()
+	defer mockHttp.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", url+"robots.txt", httpmock.NewStringResponder(200, "User-agent: *"))
+
+	// The worker stopped after crawling the seed and how-we-work, while it was visiting contact-us
+	sess := newTestSession(url)
+	for _, link := range []string{url, url + "how-we-work", url + "contact-us", url + "career"} {
+		sess.claim(link)
+	}
+	sess.addPage(url, []string{url + "how-we-work", url + "career", url + "contact-us"}, nil, model.PageInfo{
+		Status: http.StatusOK,
+	})
+	sess.addPage(url+"how-we-work", []string{url + "cases", url + "people", url}, nil, model.PageInfo{
+		Status: http.StatusOK,
+		Depth:  1,
+	})
+	sess.frontier.push(crawlTask{url: url + "contact-us", depth: 1})
+	sess.frontier.pop()
+	sess.frontier.push(crawlTask{url: url + "career", depth: 1})
+
+	data, err := sess.checkpoint(nil)
+	assert.NoError(t, err)
+
+	checkpoints := repo.NewFileCheckpointRepository(t.TempDir())
+	assert.NoError(t, checkpoints.Save(context.Background(), "req-id", data))
+
+	config := DefaultConfig()
+	service := NewCrawlerService(config, newHTTPFetcher(config.Fetch, nil), checkpoints, nil, nil)
+	sitemap := service.Crawl(context.Background(), &model.Request{ReqId: "req-id", Url: url}, nil)
+
+	calls := httpmock.GetCallCountInfo()
+	assert.Zero(t, calls["GET "+url])
+	assert.Zero(t, calls["GET "+url+"how-we-work"])
+	assert.Equal(t, 1, calls["GET "+url+"contact-us"])
+
+	assert.Len(t, sitemap.Pages, 10)
+	assert.Equal(t, 10, sitemap.Succeeded)
+	assert.Equal(t, model.OutcomeSucceeded, sitemap.Outcome)
+
+	_, err = checkpoints.Load(context.Background(), "req-id")
+	assert.EqualError(t, err, repo.KeyNotFound)
+}
+
+func TestCrawlService_Crawl_Checkpoints(t *testing.T) {
+	url := "https://parserdigital.com/"
+
+	mockHttp := mock_service.NewHttpMock(url)
+	mockHttp.RegisterResponders()
+	defer mockHttp.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", url+"robots.txt", httpmock.NewStringResponder(200, "User-agent: *"))
+	httpmock.RegisterResponder("GET", url+"career", func(req *http.Request) (*http.Response, error) {
+		time.Sleep(50 * time.Millisecond)
+		return httpmock.NewStringResponse(http.StatusOK, "<html>career</html>"), nil
+	})
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	checkpoints := mock_repo.NewMockCheckpointRepo(ctrl)
+
+	t.Run("Saved While Crawling", func(t *testing.T) {
+		var saved []byte
+
+		checkpoints.EXPECT().Load(gomock.Any(), "req-id").Return(nil, errors.New(repo.KeyNotFound))
+		checkpoints.EXPECT().Save(gomock.Any(), "req-id", gomock.Any()).
+			DoAndReturn(func(ctx context.Context, reqId string, data []byte) error {
+				saved = data
+				return nil
+			}).MinTimes(1)
+		checkpoints.EXPECT().Delete(gomock.Any(), "req-id").Return(nil)
+
+		config := DefaultConfig()
+		config.CheckpointInterval = 10 * time.Millisecond
+		service := NewCrawlerService(config, newHTTPFetcher(config.Fetch, nil), checkpoints, nil, nil)
+		sitemap := service.Crawl(context.Background(), &model.Request{ReqId: "req-id", Url: url}, nil)
+
+		assert.Equal(t, model.OutcomeSucceeded, sitemap.Outcome)
+
+		cp := &checkpoint{}
+		assert.NoError(t, json.Unmarshal(saved, cp))
+		assert.Contains(t, cp.Visited, url)
+		assert.Contains(t, cp.Sitemap.Pages, url)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		checkpoints.EXPECT().Load(gomock.Any(), "req-id").Return(nil, errors.New(repo.KeyNotFound))
+
+		config := DefaultConfig()
+		config.CheckpointInterval = 0
+		service := NewCrawlerService(config, newHTTPFetcher(config.Fetch, nil), checkpoints, nil, nil)
+		sitemap := service.Crawl(context.Background(), &model.Request{ReqId: "req-id", Url: url}, nil)
+
+		assert.Equal(t, model.OutcomeSucceeded, sitemap.Outcome)
+	})
+}
@@ -0,0 +1,235 @@
+package service
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the settings of the crawler engine
+type Config struct {
+	// Workers is the number of pages fetched simultaneously by a crawl job
+	Workers int
+	// MaxConnsPerHost is the maximum number of simultaneous connections to a single host
+	MaxConnsPerHost int
+	// RequestsPerSecond is the rate of requests allowed to a single host, unless its robots crawl delay is slower.
+	// A zero value only enforces the crawl delay
+	RequestsPerSecond float64
+	// Burst is the number of requests that can be sent to a host at once before the rate applies
+	Burst int
+	// MaxThrottleRetries is the number of times a request is sent again after a 429 or 503 response
+	MaxThrottleRetries int
+	// MaxBackoff is the longest pause applied to a host that throttles the crawler without a Retry-After header
+	MaxBackoff time.Duration
+	// MaxRetries is the number of times a request is sent again after a connection reset, a timeout or a 5xx response
+	MaxRetries int
+	// MaxJobRetries is the number of retries allowed for a whole crawl job
+	MaxJobRetries int
+	// RetryBaseDelay and RetryMaxDelay bound the exponential backoff between retries
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	// HeadProbe sends a HEAD request before downloading a page, to skip the resources that are not HTML
+	HeadProbe bool
+	// MaxBodySize is the maximum size in bytes of a page, after decompressing it. A zero value means no limit
+	MaxBodySize int64
+	// MaxLinksPerPage is the maximum number of links kept from a single page. A zero value means no limit
+	MaxLinksPerPage int
+	// MaxRedirectChain is the number of redirects a page can go through before its chain is reported as too long.
+	// Redirects are still followed up to the MaxRedirects of the fetcher
+	MaxRedirectChain int
+	// NearDuplicateDistance is the maximum number of different bits between the SimHashes of two pages considered
+	// near duplicates. Zero only groups the pages with the same SimHash
+	NearDuplicateDistance int
+	// CheckpointInterval is how often the state of a crawl job is saved to resume it if the worker stops. A zero value
+	// disables the checkpoints
+	CheckpointInterval time.Duration
+	// Fetch holds the settings of the HTTP client, which can be overridden per crawl job
+	Fetch FetchConfig
+}
+
+// DefaultConfig returns the settings used when they are not configured
+func DefaultConfig() Config {
+	return Config{
+		Workers:               10,
+		MaxConnsPerHost:       4,
+		RequestsPerSecond:     4,
+		Burst:                 4,
+		MaxThrottleRetries:    3,
+		MaxBackoff:            2 * time.Minute,
+		MaxRetries:            2,
+		MaxJobRetries:         100,
+		RetryBaseDelay:        500 * time.Millisecond,
+		RetryMaxDelay:         10 * time.Second,
+		MaxBodySize:           10 * 1024 * 1024,
+		MaxLinksPerPage:       1000,
+		MaxRedirectChain:      3,
+		NearDuplicateDistance: 3,
+		CheckpointInterval:    30 * time.Second,
+		Fetch: FetchConfig{
+			UserAgent:      userAgent + "/1.0",
+			ConnectTimeout: 10 * time.Second,
+			ReadTimeout:    30 * time.Second,
+			Timeout:        time.Minute,
+			MaxRedirects:   10,
+		},
+	}
+}
+
+// NewConfigFromEnv builds the crawler settings from the environment, falling back to the defaults
+func NewConfigFromEnv() Config {
+	cfg := DefaultConfig()
+
+	cfg.Workers = envInt("CRAWLER_WORKERS", cfg.Workers)
+	cfg.MaxConnsPerHost = envInt("CRAWLER_MAX_CONNS_PER_HOST", cfg.MaxConnsPerHost)
+	cfg.RequestsPerSecond = envFloat("CRAWLER_REQUESTS_PER_SECOND", cfg.RequestsPerSecond)
+	cfg.Burst = envInt("CRAWLER_BURST", cfg.Burst)
+	cfg.MaxThrottleRetries = envInt("CRAWLER_MAX_THROTTLE_RETRIES", cfg.MaxThrottleRetries)
+	cfg.MaxBackoff = envDuration("CRAWLER_MAX_BACKOFF", cfg.MaxBackoff)
+	cfg.MaxRetries = envNonNegativeInt("CRAWLER_MAX_RETRIES", cfg.MaxRetries)
+	cfg.MaxJobRetries = envNonNegativeInt("CRAWLER_MAX_JOB_RETRIES", cfg.MaxJobRetries)
+	cfg.RetryBaseDelay = envDuration("CRAWLER_RETRY_BASE_DELAY", cfg.RetryBaseDelay)
+	cfg.RetryMaxDelay = envDuration("CRAWLER_RETRY_MAX_DELAY", cfg.RetryMaxDelay)
+	cfg.HeadProbe = envBool("CRAWLER_HEAD_PROBE", cfg.HeadProbe)
+	cfg.MaxBodySize = int64(envNonNegativeInt("CRAWLER_MAX_BODY_SIZE", int(cfg.MaxBodySize)))
+	cfg.MaxLinksPerPage = envNonNegativeInt("CRAWLER_MAX_LINKS_PER_PAGE", cfg.MaxLinksPerPage)
+	cfg.MaxRedirectChain = envNonNegativeInt("CRAWLER_MAX_REDIRECT_CHAIN", cfg.MaxRedirectChain)
+	cfg.NearDuplicateDistance = envNonNegativeInt("CRAWLER_NEAR_DUPLICATE_DISTANCE", cfg.NearDuplicateDistance)
+	cfg.CheckpointInterval = envDuration("CRAWLER_CHECKPOINT_INTERVAL", cfg.CheckpointInterval)
+
+	cfg.Fetch.UserAgent = envString("CRAWLER_USER_AGENT", cfg.Fetch.UserAgent)
+	cfg.Fetch.Headers = envHeaders("CRAWLER_HEADERS")
+	cfg.Fetch.ConnectTimeout = envDuration("CRAWLER_CONNECT_TIMEOUT", cfg.Fetch.ConnectTimeout)
+	cfg.Fetch.ReadTimeout = envDuration("CRAWLER_READ_TIMEOUT", cfg.Fetch.ReadTimeout)
+	cfg.Fetch.Timeout = envDuration("CRAWLER_TIMEOUT", cfg.Fetch.Timeout)
+	cfg.Fetch.Proxy = os.Getenv("CRAWLER_PROXY")
+	cfg.Fetch.AllowedProxies = envList("CRAWLER_ALLOWED_PROXIES")
+	cfg.Fetch.CAFile = os.Getenv("CRAWLER_CA_FILE")
+	cfg.Fetch.CertFile = os.Getenv("CRAWLER_CERT_FILE")
+	cfg.Fetch.KeyFile = os.Getenv("CRAWLER_KEY_FILE")
+	cfg.Fetch.MaxRedirects = envNonNegativeInt("CRAWLER_MAX_REDIRECTS", cfg.Fetch.MaxRedirects)
+
+	return cfg
+}
+
+// envString reads a string from the environment
+func envString(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	return fallback
+}
+
+// envHeaders reads a list of headers separated by "|" from the environment, such as "Accept-Language: en|X-Team: seo"
+func envHeaders(key string) map[string]string {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+
+	headers := make(map[string]string)
+	for _, header := range strings.Split(value, "|") {
+		name, val, ok := strings.Cut(header, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			log.Printf("invalid header in %s: %q", key, header)
+			continue
+		}
+		headers[strings.TrimSpace(name)] = strings.TrimSpace(val)
+	}
+
+	return headers
+}
+
+// envList reads a list of values separated by "," from the environment
+func envList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// envBool reads a boolean such as "true" or "0" from the environment
+func envBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("invalid value for %s: %q, using %t", key, value, fallback)
+		return fallback
+	}
+
+	return b
+}
+
+// envInt reads a positive integer from the environment
+func envInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("invalid value for %s: %q, using %d", key, value, fallback)
+		return fallback
+	}
+
+	return n
+}
+
+// envNonNegativeInt reads an integer that can be zero from the environment
+func envNonNegativeInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Printf("invalid value for %s: %q, using %d", key, value, fallback)
+		return fallback
+	}
+
+	return n
+}
+
+// envFloat reads a non-negative number from the environment
+func envFloat(key string, fallback float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		log.Printf("invalid value for %s: %q, using %v", key, value, fallback)
+		return fallback
+	}
+
+	return n
+}
+
+// envDuration reads a duration such as "90s" or "2m" from the environment
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		log.Printf("invalid value for %s: %q, using %s", key, value, fallback)
+		return fallback
+	}
+
+	return d
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// charsetPrescanSize is the number of bytes of the body prescanned for a byte order mark or a meta charset, as the
+// HTML spec does
+const charsetPrescanSize = 1024
+
+// errBodyTooLarge is returned when reading a response body over the configured maximum size
+var errBodyTooLarge = errors.New("response body too large")
+
+// getMediaType returns the lowercase media type of the response without its parameters, such as "text/html"
+func getMediaType(res *http.Response) string {
+	contentType := res.Header.Get("Content-Type")
+	if contentType == "" {
+		return ""
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, _, _ = strings.Cut(contentType, ";")
+	}
+
+	return strings.ToLower(strings.TrimSpace(mediaType))
+}
+
+// isHTML checks if the media type is a document the crawler can parse. Responses without a Content-Type are assumed to
+// be HTML as browsers do for most sites
+func isHTML(mediaType string) bool {
+	switch mediaType {
+	case "", "text/html", "application/xhtml+xml":
+		return true
+	}
+
+	return false
+}
+
+// checkContentLength fails when the response announces a body larger than maxSize. A zero maxSize means no limit
+func checkContentLength(res *http.Response, maxSize int64) error {
+	if maxSize > 0 && res.ContentLength > maxSize {
+		return errors.New(fmt.Sprintf("%s: %d bytes, the maximum is %d", errBodyTooLarge, res.ContentLength, maxSize))
+	}
+
+	return nil
+}
+
+// maxBytesReader fails with errBodyTooLarge once more than max bytes are read, instead of silently truncating the body
+// as io.LimitReader does
+type maxBytesReader struct {
+	r   io.Reader
+	max int64
+	n   int64
+}
+
+func (m *maxBytesReader) Read(p []byte) (int, error) {
+	if m.n > m.max {
+		return 0, errBodyTooLarge
+	}
+
+	// One byte over the maximum is read to tell a body of exactly max bytes from a larger one
+	if remaining := m.max - m.n + 1; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+
+	n, err := m.r.Read(p)
+	m.n += int64(n)
+	if m.n > m.max {
+		return n - int(m.n-m.max), errBodyTooLarge
+	}
+
+	return n, err
+}
+
+// limitBody bounds the bytes read from the reader to maxSize. A zero maxSize means no limit
+func limitBody(r io.Reader, maxSize int64) io.Reader {
+	if maxSize <= 0 {
+		return r
+	}
+
+	return &maxBytesReader{r: r, max: maxSize}
+}
+
+// transcodeBody determines the character encoding of an HTML body following the HTML spec, from its byte order mark,
+// the charset of the Content-Type header or a meta tag in its first bytes, and returns a reader converting it to UTF-8
+// along with the name of the encoding. Bodies without any declaration are assumed to be windows-1252 unless they are
+// valid UTF-8
+func transcodeBody(r io.Reader, contentType string) (io.Reader, string, error) {
+	br := bufio.NewReaderSize(r, charsetPrescanSize)
+
+	start, err := br.Peek(charsetPrescanSize)
+	if err != nil && err != io.EOF {
+		return nil, "", err
+	}
+
+	enc, name, _ := charset.DetermineEncoding(start, contentType)
+
+	// The byte order mark is removed from the converted body
+	return transform.NewReader(br, unicode.BOMOverride(enc.NewDecoder())), name, nil
+}
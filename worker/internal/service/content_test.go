@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"worker/internal/model"
+	mock_service "worker/internal/service/mocks"
+)
+
+func TestGetMediaType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		mediaType   string
+		html        bool
+	}{
+		{"", "", true},
+		{"text/html", "text/html", true},
+		{"text/HTML; charset=utf-8", "text/html", true},
+		{"application/xhtml+xml", "application/xhtml+xml", true},
+		{"application/pdf", "application/pdf", false},
+		{"image/png;", "image/png", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			res := &http.Response{Header: http.Header{}}
+			res.Header.Set("Content-Type", tt.contentType)
+
+			mediaType := getMediaType(res)
+
+			assert.Equal(t, tt.mediaType, mediaType)
+			assert.Equal(t, tt.html, isHTML(mediaType))
+		})
+	}
+}
+
+func TestLimitBody(t *testing.T) {
+	body, err := io.ReadAll(limitBody(strings.NewReader("0123456789"), 10))
+	assert.NoError(t, err)
+	assert.Equal(t, "0123456789", string(body))
+
+	body, err = io.ReadAll(limitBody(strings.NewReader("0123456789a"), 10))
+	assert.ErrorIs(t, err, errBodyTooLarge)
+	assert.Equal(t, "0123456789", string(body))
+}
+
+func TestTranscodeBody(t *testing.T) {
+	latin1, _ := charmap.Windows1252.NewEncoder().String("<title>Café</title>")
+	shiftJIS, _ := japanese.ShiftJIS.NewEncoder().String("<meta charset=\"Shift_JIS\"><title>日本語</title>")
+	utf16, _ := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder().String("<title>Café</title>")
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		charset     string
+		want        string
+	}{
+		{"Header", "text/html; charset=ISO-8859-1", latin1, "windows-1252", "<title>Café</title>"},
+		{"Meta", "text/html", shiftJIS, "shift_jis", "<meta charset=\"Shift_JIS\"><title>日本語</title>"},
+		{"BOM Over Header", "text/html; charset=windows-1252", utf16, "utf-16le", "<title>Café</title>"},
+		{"Header Over Meta", "text/html; charset=utf-8", `<meta charset="windows-1252"><title>Café</title>`,
+			"utf-8", `<meta charset="windows-1252"><title>Café</title>`},
+		{"Undeclared UTF-8", "", "<title>Café</title>", "utf-8", "<title>Café</title>"},
+		{"Undeclared", "", latin1, "windows-1252", "<title>Café</title>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, charset, err := transcodeBody(strings.NewReader(tt.body), tt.contentType)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.charset, charset)
+
+			body, err := io.ReadAll(r)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, string(body))
+		})
+	}
+}
+
+func TestCrawlService_Crawl_Content(t *testing.T) {
+	url := "https://parserdigital.com/"
+
+	pdfResponder := func(req *http.Request) (*http.Response, error) {
+		res := httpmock.NewStringResponse(http.StatusOK, "%PDF-1.4")
+		res.Header.Set("Content-Type", "application/pdf")
+		return res, nil
+	}
+
+	t.Run("Non HTML Resource", func(t *testing.T) {
+		mockHttp := mock_service.NewHttpMock(url)
+		mockHttp.RegisterResponders()
+		defer mockHttp.DeactivateAndReset()
+
+		httpmock.RegisterResponder("GET", url+"robots.txt", httpmock.NewStringResponder(200, "User-agent: *"))
+		httpmock.RegisterResponder("GET", url+"career", pdfResponder)
+
+		sitemap := newTestCrawlerService().Crawl(context.Background(), &model.Request{Url: url}, nil)
+
+		assert.Contains(t, sitemap.Pages, url+"career")
+		assert.Nil(t, sitemap.Pages[url+"career"])
+		assert.NotContains(t, sitemap.Pages, url+"apply")
+		assert.Equal(t, map[string]string{url + "career": "application/pdf"}, sitemap.Resources)
+	})
+
+	t.Run("Head Probe", func(t *testing.T) {
+		mockHttp := mock_service.NewHttpMock(url)
+		mockHttp.RegisterResponders()
+		defer mockHttp.DeactivateAndReset()
+
+		httpmock.RegisterResponder("GET", url+"robots.txt", httpmock.NewStringResponder(200, "User-agent: *"))
+		httpmock.RegisterResponder("HEAD", url+"career", pdfResponder)
+		httpmock.RegisterResponder("GET", url+"career", pdfResponder)
+		httpmock.RegisterNoResponder(httpmock.NewStringResponder(http.StatusMethodNotAllowed, ""))
+
+		config := DefaultConfig()
+		config.HeadProbe = true
+		sitemap := NewCrawlerService(config, newHTTPFetcher(config.Fetch, nil), nil, nil, nil).Crawl(context.Background(), &model.Request{Url: url}, nil)
+
+		assert.Equal(t, 0, httpmock.GetCallCountInfo()["GET "+url+"career"])
+		assert.Equal(t, map[string]string{url + "career": "application/pdf"}, sitemap.Resources)
+		assert.Contains(t, sitemap.Pages, url+"how-we-work")
+	})
+
+	t.Run("Max Body Size", func(t *testing.T) {
+		mockHttp := mock_service.NewHttpMock(url)
+		mockHttp.RegisterResponders()
+		defer mockHttp.DeactivateAndReset()
+
+		httpmock.RegisterResponder("GET", url+"robots.txt", httpmock.NewStringResponder(200, "User-agent: *"))
+		httpmock.RegisterResponder("GET", url+"career", httpmock.NewStringResponder(http.StatusOK,
+			"<html><body>"+strings.Repeat("<p>Dummy text</p>", 1000)+"</body></html>"))
+
+		config := DefaultConfig()
+		config.MaxBodySize = 1024
+		sitemap := NewCrawlerService(config, newHTTPFetcher(config.Fetch, nil), nil, nil, nil).Crawl(context.Background(), &model.Request{Url: url}, nil)
+
+		assert.NotContains(t, sitemap.Pages, url+"career")
+		assert.Equal(t, []model.PageError{{
+			Url:   url + "career",
+			Error: "error parsing document: response body too large",
+		}}, sitemap.Errors)
+
+		// The response is still described, without any links
+		info := sitemap.PageInfo[url+"career"]
+		assert.Equal(t, http.StatusOK, info.Status)
+		assert.Equal(t, "error parsing document: response body too large", info.Error)
+		assert.NotContains(t, sitemap.Links, url+"career")
+		assert.NotContains(t, sitemap.Pages, url+"apply")
+	})
+
+	t.Run("Charset", func(t *testing.T) {
+		mockHttp := mock_service.NewHttpMock(url)
+		mockHttp.RegisterResponders()
+		defer mockHttp.DeactivateAndReset()
+
+		body, _ := japanese.ShiftJIS.NewEncoder().String(
+			`<html><head><meta charset="shift_jis"><title>採用情報</title></head><a href="/apply">応募</a></html>`)
+
+		httpmock.RegisterResponder("GET", url+"robots.txt", httpmock.NewStringResponder(200, "User-agent: *"))
+		httpmock.RegisterResponder("GET", url+"career", httpmock.NewStringResponder(http.StatusOK, body))
+
+		sitemap := newTestCrawlerService().Crawl(context.Background(), &model.Request{Url: url}, nil)
+
+		assert.Equal(t, "採用情報", sitemap.PageInfo[url+"career"].Title)
+		assert.Equal(t, "shift_jis", sitemap.PageInfo[url+"career"].Charset)
+		assert.Equal(t, "windows-1252", sitemap.PageInfo[url].Charset)
+		assert.Equal(t, []string{url + "apply"}, sitemap.Pages[url+"career"])
+	})
+
+	t.Run("Max Links Per Page", func(t *testing.T) {
+		mockHttp := mock_service.NewHttpMock(url)
+		mockHttp.RegisterResponders()
+		defer mockHttp.DeactivateAndReset()
+
+		httpmock.RegisterResponder("GET", url+"robots.txt", httpmock.NewStringResponder(200, "User-agent: *"))
+
+		config := DefaultConfig()
+		config.MaxLinksPerPage = 2
+		sitemap := NewCrawlerService(config, newHTTPFetcher(config.Fetch, nil), nil, nil, nil).Crawl(context.Background(), &model.Request{Url: url}, nil)
+
+		assert.Equal(t, []string{url + "how-we-work", url + "career"}, sitemap.Pages[url])
+		assert.NotContains(t, sitemap.Pages, url+"contact-us")
+	})
+}
@@ -1,245 +1,652 @@
 package service
 
 import (
-	"compress/gzip"
-	"compress/lzw"
-	"compress/zlib"
+	"context"
 	"errors"
 	"fmt"
-	"github.com/dsnet/compress/brotli"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
-	"strconv"
-	"strings"
+	"sort"
 	"sync"
 	"time"
 	"worker/internal/model"
-
-	"github.com/PuerkitoBio/goquery"
+	"worker/internal/repo"
 )
 
 type CrawlerService interface {
-	Crawl(url string) *model.Sitemap
+	Crawl(ctx context.Context, req *model.Request, events chan<- model.Event) *model.Sitemap
+	CrawlTask(ctx context.Context, task *model.PageTask, events chan<- model.Event)
 }
 
+// crawlService holds the resources shared by all the crawl jobs. The state of each job lives in a crawlSession
 type crawlService struct {
-	visitedURLs   map[string]bool
-	sitemap       *model.Sitemap
-	visitedMu     sync.Mutex
-	sitemapPageMu sync.Mutex
+	config  Config
+	fetcher Fetcher
+	// checkpoints, history and fleet are nil when the jobs are not checkpointed, the sites are crawled from scratch
+	// every time and the jobs are not distributed
+	checkpoints repo.CheckpointRepo
+	history     repo.HistoryRepo
+	fleet       *Fleet
+	robots      *robotsCache
+	hosts       *hostLimiter
+	polite      *hostScheduler
+	taskJobs    *taskJobCache
 }
 
-// NewCrawlerService builds a service and injects its dependencies
-func NewCrawlerService() CrawlerService {
-	return &crawlService{
-		visitedURLs: make(map[string]bool),
-		sitemap: &model.Sitemap{
-			Pages: make(map[string][]string),
-		},
+// NewCrawlerService builds a service and injects its dependencies, of which the repositories and the fleet are optional
+func NewCrawlerService(config Config, fetcher Fetcher, checkpoints repo.CheckpointRepo, history repo.HistoryRepo, fleet *Fleet) CrawlerService {
+	s := &crawlService{
+		config:      config,
+		fetcher:     fetcher,
+		checkpoints: checkpoints,
+		history:     history,
+		fleet:       fleet,
+		robots:      newRobotsCache(),
+		hosts:       newHostLimiter(config.MaxConnsPerHost),
+		polite:      newHostScheduler(config.RequestsPerSecond, config.Burst, config.MaxBackoff),
+		taskJobs:    newTaskJobCache(),
+	}
+
+	if fleet != nil {
+		s.polite.fleet = fleet.Hosts
 	}
+
+	return s
 }
 
-// Crawl visits the url and all the links within the same domain and returns the sitemap for the website
-func (s *crawlService) Crawl(url string) *model.Sitemap {
-	const robots = "robots.txt"
+// Crawl visits the url and all the links in scope and returns the sitemap for the website, sending its pages to the
+// events channel as it goes unless it is nil
+func (s *crawlService) Crawl(ctx context.Context, req *model.Request, events chan<- model.Event) *model.Sitemap {
+	if ctx.Err() != nil {
+		log.Printf("crawl of %s cancelled before it started", req.Url)
+		return &model.Sitemap{Pages: make(map[string][]string), Outcome: model.OutcomeCancelled}
+	}
+
+	sess, seed, err := s.newSession(req)
+	if err != nil {
+		return failedSitemap(req.Url, err)
+	}
+	defer sess.fetcher.Close()
+	sess.events = events
+	// Only the recrawls send conditional requests and report the changes since the last crawl
+	if req.Recrawl {
+		sess.previous = s.loadHistory(ctx, cacheKey(req))
+	}
+
+	if req.Distributed {
+		if s.fleet != nil && req.ReqId != "" {
+			return s.crawlDistributed(ctx, req, sess, seed)
+		}
+		log.Printf("crawl of %s cannot be distributed without a fleet, crawling it in this worker", req.Url)
+	}
+
+	resumed, listed := s.resume(ctx, sess, req.ReqId)
+	if resumed {
+		log.Printf("resuming crawl of %s from its checkpoint: %d pages visited, %d failed", req.Url,
+			sess.stats.visited, sess.stats.failed)
+	}
+
+	if sess.limits.MaxSeconds > 0 {
+		// A resumed job only has the time left from its previous runs
+		remaining := time.Duration(sess.limits.MaxSeconds)*time.Second - time.Since(sess.startedAt)
+		timer := time.AfterFunc(remaining, func() {
+			sess.stop(model.LimitMaxSeconds)
+		})
+		defer timer.Stop()
+	}
 
-	subdomain := s.getSubdomain(url)
-	delay := s.getDelay(subdomain, robots)
+	// Cancelling the job discards the pages waiting in the frontier, and the context aborts the requests in flight
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Done():
+			sess.frontier.close()
+		case <-finished:
+		}
+	}()
 
-	s.crawl(url, subdomain, delay)
+	if !resumed {
+		listed = s.getSitemapURLs(ctx, sess, seed)
+	}
 
-	return s.sitemap
+	stopCheckpoints := s.startCheckpoints(sess, req.ReqId, listed)
+	s.crawl(ctx, sess, seed.String(), listed)
+	stopCheckpoints()
+
+	return s.finish(req, sess, seed, listed, ctx.Err() != nil)
 }
 
-// getSubdomain parses the url and gets only the subdomain
-func (s *crawlService) getSubdomain(urlStr string) string {
-	parsedURL, err := url.Parse(urlStr)
+// newSession builds the session of a crawl job from its request, with the canonical seed url
+func (s *crawlService) newSession(req *model.Request) (*crawlSession, *url.URL, error) {
+	parsedURL, err := url.Parse(req.Url)
 	if err != nil {
-		log.Printf("error parsing url: %s", err)
-		return ""
+		log.Printf("error parsing url %s: %s", req.Url, err)
+		return nil, nil, errors.New(fmt.Sprintf("error parsing url: %s", err))
+	}
+	seed := newCanonicalizer(req.Canonical).canonicalize(parsedURL)
+
+	scope, err := NewScope(seed, req.Scope)
+	if err != nil {
+		log.Printf("error building scope for %s: %s", req.Url, err)
+		return nil, nil, err
+	}
+
+	fetcher, err := s.fetcher.WithOptions(req.Fetch)
+	if err != nil {
+		log.Printf("error configuring the fetcher for %s: %s", req.Url, err)
+		return nil, nil, err
+	}
+
+	retry, maxJobRetries := newRetryPolicy(s.config, req.Retry)
+
+	sess := newCrawlSession(req, scope, fetcher, retry, maxJobRetries)
+	// The robots rules are matched against the user agent the job identifies itself with
+	sess.agent = productToken(fetcher.UserAgent())
+
+	return sess, seed, nil
+}
+
+// finish completes the sitemap of a crawl job once its pages are crawled: it compares the pages with the sitemap
+// files, groups the duplicates, decides the outcome and sorts the lists
+func (s *crawlService) finish(req *model.Request, sess *crawlSession, seed *url.URL, listed []string, cancelled bool) *model.Sitemap {
+	if len(listed) > 0 {
+		sess.sitemap.Orphans, sess.sitemap.MissingFromSitemap = compareSitemap(seed.String(), listed, sess.sitemap.Pages)
+	}
+
+	sess.sitemap.Duplicates = findDuplicates(sess.fingerprints, s.config.NearDuplicateDistance)
+	sess.setOutcome(seed.String(), cancelled)
+
+	if sess.previous != nil {
+		sess.sitemap.Changes = sess.previous.compare(sess.sitemap, sess.sitemap.Truncated || cancelled)
+	}
+	s.saveHistory(sess, cacheKey(req))
+
+	sort.Slice(sess.sitemap.Errors, func(i, j int) bool {
+		return sess.sitemap.Errors[i].Url < sess.sitemap.Errors[j].Url
+	})
+	sort.Strings(sess.sitemap.Noindex)
+	sort.Slice(sess.sitemap.RedirectIssues, func(i, j int) bool {
+		return sess.sitemap.RedirectIssues[i].Url < sess.sitemap.RedirectIssues[j].Url
+	})
+
+	log.Printf("crawl of %s finished as %s in %s: %d pages visited, %d failed, %d disallowed, truncated by: %q",
+		req.Url, sess.sitemap.Outcome, time.Since(sess.startedAt), sess.stats.visited, sess.stats.failed,
+		sess.stats.disallowed, sess.sitemap.TruncatedBy)
+
+	return sess.sitemap
+}
+
+// failedSitemap is the result of a job that could not start, reporting the error on its url
+func failedSitemap(url string, err error) *model.Sitemap {
+	return &model.Sitemap{
+		Pages:   make(map[string][]string),
+		Outcome: model.OutcomeFailed,
+		Errors:  []model.PageError{{Url: url, Error: err.Error()}},
+	}
+}
+
+// getOrigin returns the scheme and host of the url, which identify the site its robots file belongs to
+func (s *crawlService) getOrigin(u *url.URL) string {
+	return u.Scheme + "://" + u.Host
+}
+
+// getRobots returns the robots rules for the site of the url. Every site is resolved once per session, and shared
+// between the sessions with the same user agent through the robots cache
+func (s *crawlService) getRobots(ctx context.Context, sess *crawlSession, u *url.URL) *robots {
+	origin := s.getOrigin(u)
+
+	// The lock only guards the map, the fetch runs in the entry's once so other hosts are not blocked
+	sess.robotsMu.Lock()
+	entry, ok := sess.robots[origin]
+	if !ok {
+		entry = &sessionRobots{}
+		sess.robots[origin] = entry
 	}
+	sess.robotsMu.Unlock()
+
+	entry.once.Do(func() {
+		rules, ok := s.robots.get(origin, sess.agent)
+		if !ok {
+			rules = s.fetchRobots(ctx, sess.fetcher, origin, sess.agent)
+			// Unreachable robots files are not cached so the next job tries again
+			if !rules.disallowAll {
+				s.robots.set(origin, sess.agent, rules)
+			}
+		}
+		entry.rules = rules
+	})
 
-	return parsedURL.Scheme + "://" + parsedURL.Hostname()
+	return entry.rules
 }
 
-// getDelay parses the robots file for the url to check how often it can be requested/crawled
-func (s *crawlService) getDelay(url, robots string) int {
-	resp, err := http.Get(fmt.Sprintf("%s/%s", url, robots))
+// fetchRobots requests and parses the robots file for the site to check which pages the agent can crawl and how often.
+// A missing robots file allows everything, while an unreachable one disallows everything as stated in RFC 9309
+func (s *crawlService) fetchRobots(ctx context.Context, fetcher Fetcher, origin, agent string) *robots {
+	const robotsFile = "robots.txt"
+
+	resp, err := fetcher.Get(ctx, fmt.Sprintf("%s/%s", origin, robotsFile))
 	if err != nil {
 		log.Printf("error getting robots file: %s", err)
-		return 0
+		return disallowAllRobots()
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("error reading robots file: %s", err)
-		return 0
+	switch {
+	case resp.StatusCode >= http.StatusInternalServerError:
+		log.Printf("robots file unreachable, status code: %d", resp.StatusCode)
+		return disallowAllRobots()
+	case resp.StatusCode >= http.StatusBadRequest:
+		return allowAllRobots()
 	}
 
-	lines := strings.Split(string(body), "\n")
-	for _, line := range lines {
-		parts := strings.SplitN(line, ":", 2)
-		if len(parts) != 2 || !strings.EqualFold(strings.TrimSpace(parts[0]), "Crawl-delay") {
-			continue
-		}
+	rules := parseRobots(resp.Body, agent)
+	if len(rules.sitemaps) > 0 {
+		log.Printf("sitemaps found in robots file: %v", rules.sitemaps)
+	}
 
-		delay, err := strconv.Atoi(strings.TrimSpace(parts[1]))
-		if err != nil {
-			log.Printf("error converting crawl-delay value: %s", err)
-			return 0
-		}
+	return rules
+}
 
-		return delay
-	}
+// crawl goes through the website with a fixed pool of workers fed by the frontier, and builds its sitemap based on the
+// links found in scope. The seed and the pages listed in the sitemap files start the frontier
+func (s *crawlService) crawl(ctx context.Context, sess *crawlSession, seed string, listed []string) {
+	sess.enqueueSeeds(seed, listed)
+
+	var wg sync.WaitGroup
+	for i := 0; i < s.config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				task, ok := sess.frontier.pop()
+				if !ok {
+					return
+				}
 
-	return 0
+				s.crawlPage(ctx, sess, task)
+				sess.frontier.done(task)
+			}
+		}()
+	}
+	wg.Wait()
 }
 
-// crawl recursively goes through the website and builds its sitemap based on the links found in the same subdomain
-func (s *crawlService) crawl(urlStr, subdomain string, delay int) {
-	if !strings.Contains(urlStr, subdomain) {
+// crawlPage visits a page from the frontier, stores its links in the sitemap and pushes the new ones to the frontier
+func (s *crawlService) crawlPage(ctx context.Context, sess *crawlSession, task crawlTask) {
+	urlStr := task.url
+
+	parsedURL, err := url.Parse(urlStr)
+	if err != nil {
+		log.Printf("error parsing url %s: %s", urlStr, err)
+		return
+	}
+
+	if !sess.scope.InScope(parsedURL) {
+		return
+	}
+
+	rules := s.getRobots(ctx, sess, parsedURL)
+	if !rules.allowed(parsedURL) {
+		log.Printf("skipping %s, disallowed by robots file", urlStr)
+		sess.markDisallowed(urlStr)
+		return
+	}
+
+	if !sess.reservePage() {
+		sess.stop(model.LimitMaxPages)
 		return
 	}
 
-	res, doc, err := s.visit(urlStr, delay)
+	release := s.hosts.acquire(parsedURL.Host)
+	p, err := s.visit(ctx, sess, parsedURL, rules.delay)
+	release()
+	// The pages in flight when the job is cancelled are not failures
+	if err != nil && ctx.Err() != nil {
+		return
+	}
 	if err != nil {
 		log.Printf("error visiting the page %s: %s", urlStr, err)
+
+		info := model.PageInfo{Depth: task.depth}
+		if p != nil {
+			info = p.info(task.depth)
+			s.checkRedirects(sess, urlStr, info.Redirects)
+		}
+		sess.markFailed(urlStr, info, err)
+		return
+	}
+	defer p.res.Body.Close()
+
+	if p.notModified {
+		s.reusePage(sess, task, p)
+		return
+	}
+
+	info := p.info(task.depth)
+	s.checkRedirects(sess, urlStr, info.Redirects)
+
+	// Redirected pages are stored under their final url, linked from the requested one
+	if len(info.Redirects) > 0 && p.res.Request != nil {
+		finalURL := sess.canonical.canonicalize(p.res.Request.URL)
+		if final := finalURL.String(); final != urlStr {
+			sess.addRedirect(urlStr, final, model.PageInfo{
+				Status:    info.Redirects[0].Status,
+				FinalUrl:  info.FinalUrl,
+				Depth:     task.depth,
+				Redirects: info.Redirects,
+			})
+
+			if !sess.scope.InScope(finalURL) || !sess.claim(final) {
+				return
+			}
+			if !s.getRobots(ctx, sess, finalURL).allowed(finalURL) {
+				log.Printf("skipping %s, disallowed by robots file", final)
+				sess.markDisallowed(final)
+				return
+			}
+
+			urlStr, info.Redirects = final, nil
+		}
+	}
+
+	if info.Status >= http.StatusBadRequest {
+		sess.markErrorStatus(urlStr, info.Status)
+	}
+
+	directives := parseDirectives(p.doc, p.res, sess.agent)
+	info.Noindex, info.Nofollow = directives.noindex, directives.nofollow
+
+	// A redirect that is not followed links to its Location, even when its body is not HTML
+	found := s.getLocationLink(sess, p.res, urlStr)
+	if p.doc == nil && len(found) == 0 {
+		log.Printf("skipping the links of %s, %q is not HTML", urlStr, p.mediaType)
+		sess.addResource(urlStr, info)
 		return
 	}
-	defer res.Body.Close()
 
-	links := s.getLinks(doc, res, subdomain, urlStr)
-	s.sitemapPageMu.Lock()
-	s.sitemap.Pages[urlStr] = links
-	s.sitemapPageMu.Unlock()
+	if p.doc != nil {
+		found = append(found, s.getLinks(sess, p.doc, p.res, urlStr)...)
+		s.addFingerprint(sess, p, urlStr, &info)
+	}
+
+	var links []string
+	if directives.nofollow && !sess.directives.IgnoreMetaRobots {
+		log.Printf("skipping the links of %s, nofollow page", urlStr)
+	} else {
+		links = s.followLinks(sess, found)
+	}
+	sess.addPage(urlStr, links, found, info)
 
 	log.Printf("links found in %s: %v", urlStr, links)
 
-	// Process found links in page in parallel
-	var wg sync.WaitGroup
+	if sess.addBytes(p.size) {
+		sess.stop(model.LimitMaxBytes)
+		return
+	}
+
 	for _, link := range links {
-		if strings.Contains(link, subdomain) {
-			wg.Add(1)
-			go func(link string) {
-				defer wg.Done()
-				if !s.visitedLink(link) {
-					s.crawl(link, subdomain, delay)
-				}
-			}(link)
-		}
+		sess.enqueue(link, task.depth+1)
 	}
-	wg.Wait()
 }
 
-// visit requests a page and returns its document representation
-func (s *crawlService) visit(urlStr string, delay int) (*http.Response, *goquery.Document, error) {
-	// Wait for crawl delay from robots.txt
-	time.Sleep(time.Duration(delay) * time.Second)
+// addFingerprint records the canonical link and content hashes of a page in its metadata. Only the successful pages
+// with some text are compared to find duplicates
+func (s *crawlService) addFingerprint(sess *crawlSession, p *page, urlStr string, info *model.PageInfo) {
+	text := p.doc.text
+	if text == "" {
+		return
+	}
 
-	res, err := http.Get(urlStr)
-	if err != nil {
-		return nil, nil, errors.New(fmt.Sprintln("error getting url:", err))
+	fp := fingerprint{
+		canonical: s.getCanonicalLink(sess, p.doc, getBase(p.doc, p.res, urlStr)),
+		hash:      contentHash(text),
+		simHash:   simHash(text),
+	}
+	info.Canonical, info.ContentHash, info.SimHash = fp.canonical, fp.hash, formatSimHash(fp.simHash)
+
+	if p.res.StatusCode >= http.StatusOK && p.res.StatusCode < http.StatusMultipleChoices {
+		sess.addFingerprint(urlStr, fp)
+	}
+}
+
+// checkRedirects reports the loops, long chains and https to http downgrades in the redirects of a requested url
+func (s *crawlService) checkRedirects(sess *crawlSession, urlStr string, hops []model.RedirectHop) {
+	if issues := redirectIssues(hops, s.config.MaxRedirectChain); len(issues) > 0 {
+		log.Printf("redirect issues in %s: %v", urlStr, issues)
+		sess.addRedirectIssues(urlStr, issues)
+	}
+}
+
+// page is the result of visiting a url. The document is nil when the url is not an HTML page
+type page struct {
+	res       *http.Response
+	doc       *document
+	mediaType string
+	charset   string
+	size      int64
+	elapsed   time.Duration
+	// notModified is set when the server answered a conditional request with a 304
+	notModified bool
+}
+
+// info returns the metadata of the page, found at the given depth from the seed
+func (p *page) info(depth int) model.PageInfo {
+	info := model.PageInfo{
+		Status:        p.res.StatusCode,
+		ContentType:   p.mediaType,
+		Charset:       p.charset,
+		ContentLength: p.size,
+		ResponseTime:  p.elapsed.Milliseconds(),
+		Depth:         depth,
+		Redirects:     redirectChain(p.res),
+		ETag:          p.res.Header.Get("ETag"),
+		LastModified:  p.res.Header.Get("Last-Modified"),
+	}
+
+	if p.res.Request != nil {
+		info.FinalUrl = p.res.Request.URL.String()
+	}
+
+	// Resources are not downloaded, so their length is the announced one
+	if p.doc == nil && p.res.ContentLength > 0 {
+		info.ContentLength = p.res.ContentLength
+	}
+
+	if p.doc != nil {
+		info.Title = p.doc.title
 	}
 
-	body, err := s.decompress(res)
+	return info
+}
+
+// visit requests a page and extracts its document, only downloading the HTML pages up to the configured size. The
+// response is returned along with the error when it was received
+func (s *crawlService) visit(ctx context.Context, sess *crawlSession, u *url.URL, crawlDelay time.Duration) (*page, error) {
+	// The pages of the last crawl are requested conditionally, without probing them
+	_, conditional := sess.previous.page(u.String())
+	if s.config.HeadProbe && !conditional {
+		p, err := s.probe(ctx, sess, u, crawlDelay)
+		if p != nil || err != nil {
+			return p, err
+		}
+	}
+
+	res, elapsed, err := s.fetch(ctx, sess, http.MethodGet, u, crawlDelay)
 	if err != nil {
-		return nil, nil, errors.New(fmt.Sprintln("error decompressing document:", err))
+		err = errors.New(fmt.Sprintf("error getting url: %s", err))
+		// The client returns the last redirect, already closed, when it stops following a chain
+		if res != nil {
+			return &page{res: res, elapsed: elapsed}, err
+		}
+		return nil, err
+	}
+
+	if conditional && res.StatusCode == http.StatusNotModified {
+		return &page{res: res, elapsed: elapsed, notModified: true}, nil
+	}
+
+	if mediaType := getMediaType(res); !isHTML(mediaType) {
+		return &page{res: res, mediaType: mediaType, elapsed: elapsed}, nil
 	}
 
-	doc, err := goquery.NewDocumentFromReader(body)
+	if err := checkContentLength(res, s.config.MaxBodySize); err != nil {
+		res.Body.Close()
+		return nil, errors.New(fmt.Sprintf("error getting url: %s", err))
+	}
+
+	counter := &countingReader{ReadCloser: res.Body}
+	res.Body = counter
+
+	body, err := decompress(res)
 	if err != nil {
-		return nil, nil, errors.New(fmt.Sprintln("error parsing document:", err))
+		res.Body.Close()
+		// The response is kept so its status and type are recorded with the error
+		return &page{res: res, mediaType: getMediaType(res), elapsed: elapsed},
+			errors.New(fmt.Sprintf("error decompressing document: %s", err))
 	}
+	res.Body = body
 
-	s.markVisited(urlStr)
+	utf8Body, charset, err := transcodeBody(limitBody(body, s.config.MaxBodySize), res.Header.Get("Content-Type"))
+	if err != nil {
+		res.Body.Close()
+		return &page{res: res, mediaType: getMediaType(res), size: counter.n, elapsed: elapsed},
+			errors.New(fmt.Sprintf("error parsing document: %s", err))
+	}
 
-	return res, doc, nil
-}
+	doc, err := parseDocument(utf8Body, sess.agent)
+	if err != nil {
+		res.Body.Close()
+		return &page{res: res, mediaType: getMediaType(res), charset: charset, size: counter.n, elapsed: elapsed},
+			errors.New(fmt.Sprintf("error parsing document: %s", err))
+	}
 
-// visitedLink checks if the link has been already crawled
-func (s *crawlService) visitedLink(link string) bool {
-	s.visitedMu.Lock()
-	defer s.visitedMu.Unlock()
-	return s.visitedURLs[link]
+	return &page{
+		res:       res,
+		doc:       doc,
+		mediaType: getMediaType(res),
+		charset:   charset,
+		size:      counter.n,
+		elapsed:   elapsed,
+	}, nil
 }
 
-// markVisited mark the link as visited to avoid duplicates
-func (s *crawlService) markVisited(link string) {
-	s.visitedMu.Lock()
-	s.visitedURLs[link] = true
-	s.visitedMu.Unlock()
-}
+// probe requests the headers of the url to skip downloading the resources that are not HTML or are too large. It
+// returns a nil page when the url has to be downloaded, including when the server does not support HEAD requests
+func (s *crawlService) probe(ctx context.Context, sess *crawlSession, u *url.URL, crawlDelay time.Duration) (*page, error) {
+	res, elapsed, err := s.fetch(ctx, sess, http.MethodHead, u, crawlDelay)
+	if err != nil {
+		log.Printf("error probing %s: %s", u, err)
+		return nil, nil
+	}
+	res.Body.Close()
 
-// decompress takes the "Content-Encoding" header and applies the decompression using each algorithm found
-func (s *crawlService) decompress(res *http.Response) (io.ReadCloser, error) {
-	encoding := res.Header["Content-Encoding"]
-	body := res.Body
-	var encErr error
+	if res.StatusCode != http.StatusOK {
+		return nil, nil
+	}
 
-	for _, enc := range encoding {
-		switch enc {
-		case "br":
-			body, encErr = brotli.NewReader(body, nil)
-		case "gzip":
-			body, encErr = gzip.NewReader(body)
-		case "compress":
-			body = lzw.NewReader(body, lzw.LSB, 8)
-		case "deflate":
-			body, encErr = zlib.NewReader(body)
-		}
+	if mediaType := getMediaType(res); !isHTML(mediaType) {
+		return &page{res: res, mediaType: mediaType, elapsed: elapsed}, nil
 	}
 
-	if encErr != nil {
-		return nil, errors.New(fmt.Sprintf("error decompressing: %s", encErr))
+	if err := checkContentLength(res, s.config.MaxBodySize); err != nil {
+		return nil, errors.New(fmt.Sprintf("error getting url: %s", err))
 	}
 
-	return body, nil
+	return nil, nil
 }
 
-// getLinks returns the links found in a document
-func (s *crawlService) getLinks(doc *goquery.Document, res *http.Response, subdomain, urlStr string) (links []string) {
-	doc.Find("a").Each(func(index int, element *goquery.Selection) {
-		href, exists := element.Attr("href")
-		if !exists {
-			return
+// fetch requests the url when the politeness of the host allows it, sending it again when the host throttles the
+// crawler or the error is transient, and returns the time it took to receive the headers of the last response
+func (s *crawlService) fetch(ctx context.Context, sess *crawlSession, method string, u *url.URL, crawlDelay time.Duration) (*http.Response, time.Duration, error) {
+	// The GET requests of the pages of the last crawl send their validators
+	send := sess.fetcher.Get
+	if method == http.MethodHead {
+		send = sess.fetcher.Head
+	} else if prev, ok := sess.previous.page(u.String()); ok {
+		send = func(ctx context.Context, url string) (*http.Response, error) {
+			return sess.fetcher.GetIfChanged(ctx, url, prev.Info.ETag, prev.Info.LastModified)
 		}
+	}
+
+	throttles, retries := 0, 0
 
-		linkURL, err := url.Parse(href)
-		if err != nil {
-			log.Printf("error resolving relative url to absolute url: %s", err)
-			return
+	for {
+		if err := s.polite.wait(ctx, u.Host, crawlDelay); err != nil {
+			return nil, 0, err
 		}
 
-		absoluteURL := res.Request.URL.ResolveReference(linkURL)
-		link := absoluteURL.String()
+		start := time.Now()
+		res, err := send(ctx, u.String())
+		elapsed := time.Since(start)
+		if err == nil && isThrottled(res) {
+			res.Body.Close()
 
-		// Ensure the link belongs to the same subdomain
-		if !strings.Contains(link, subdomain) || link == urlStr {
-			return
+			retryAfter := parseRetryAfter(res.Header.Get("Retry-After"), time.Now())
+			pause := s.polite.throttled(u.Host, retryAfter, time.Duration(sess.limits.MaxSeconds)*time.Second)
+			log.Printf("%s throttled the crawler with status %d, pausing its requests for %s", u.Host, res.StatusCode, pause)
+
+			if throttles >= s.config.MaxThrottleRetries {
+				return nil, 0, errors.New(fmt.Sprintf("throttled by the host with status %d", res.StatusCode))
+			}
+			throttles++
+			continue
 		}
 
-		links = s.appendSet(links, link)
+		if !isRetryable(res, err) || ctx.Err() != nil {
+			if err == nil {
+				s.polite.succeeded(u.Host)
+			}
+			return res, elapsed, err
+		}
 
-	})
+		if err == nil {
+			res.Body.Close()
+			err = errors.New(fmt.Sprintf("server error with status %d", res.StatusCode))
+		}
 
-	return
-}
+		if retries >= sess.retry.maxRetries || !sess.takeRetry() {
+			if retries > 0 {
+				return nil, 0, errors.New(fmt.Sprintf("%s after %d retries", err, retries))
+			}
+			return nil, 0, err
+		}
 
-// appendSet appends to the slice only if the link is not already added
-func (s *crawlService) appendSet(links []string, link string) []string {
-	exists := false
-	for _, l := range links {
-		if l == link {
-			exists = true
-			break
+		delay := sess.retry.delay(retries)
+		log.Printf("retrying %s in %s: %s", u, delay, err)
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, 0, err
 		}
+		retries++
 	}
+}
+
+// countingReader counts the bytes read from the underlying reader
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
 
-	if !exists {
-		links = append(links, link)
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// followLinks returns the urls of the links whose kind is followed by the crawl job, skipping the rel="nofollow" ones
+// unless the job ignores them. A url found in several elements is only followed once
+func (s *crawlService) followLinks(sess *crawlSession, found []model.Link) (links []string) {
+	followed := make(map[string]bool)
+	for _, link := range found {
+		if link.Nofollow && !sess.directives.IgnoreNofollowLinks {
+			continue
+		}
+		if sess.follow[link.Kind] && !followed[link.Url] {
+			followed[link.Url] = true
+			links = append(links, link.Url)
+		}
 	}
 
 	return links
@@ -1,12 +1,23 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"github.com/jarcoal/httpmock"
 	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/url"
 	"testing"
 	"worker/internal/model"
 	mock_service "worker/internal/service/mocks"
 )
 
+// newTestCrawlerService builds a service whose fetcher goes through the default transport mocked by httpmock
+func newTestCrawlerService() CrawlerService {
+	config := DefaultConfig()
+	return NewCrawlerService(config, newHTTPFetcher(config.Fetch, nil), nil, nil, nil)
+}
+
 func TestCrawlService_Crawl_Success(t *testing.T) {
 	url := "https://parserdigital.com/"
 	mockHttp := mock_service.NewHttpMock(url)
@@ -43,18 +54,374 @@ func TestCrawlService_Crawl_Success(t *testing.T) {
 		},
 	}
 
-	mockSitemap := &model.Sitemap{
-		Pages: make(map[string][]string),
-	}
+	service := newTestCrawlerService()
+
+	sitemap := service.Crawl(context.Background(), &model.Request{Url: url}, nil)
 
-	service := &crawlService{
-		visitedURLs: make(map[string]bool),
-		sitemap:     mockSitemap,
+	assert.Equal(t, expected.Pages, sitemap.Pages)
+
+	assert.Len(t, sitemap.PageInfo, len(expected.Pages))
+	for page, depth := range map[string]int{url: 0, url + "career": 1, url + "visit": 2} {
+		info := sitemap.PageInfo[page]
+		assert.Equal(t, 200, info.Status)
+		assert.Equal(t, page, info.FinalUrl)
+		assert.Equal(t, depth, info.Depth)
+		assert.Greater(t, info.ContentLength, int64(0))
 	}
 
-	sitemap := service.Crawl(url)
+	mockHttp.DeactivateAndReset()
+}
 
-	assert.Equal(t, sitemap, expected)
+func TestCrawlService_Crawl_PageInfo(t *testing.T) {
+	url := "https://parserdigital.com/"
+	mockHttp := mock_service.NewHttpMock(url)
+	mockHttp.RegisterResponders()
+	defer mockHttp.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", url+"robots.txt", httpmock.NewStringResponder(200, "User-agent: *"))
+	httpmock.RegisterResponder("GET", url+"career", func(req *http.Request) (*http.Response, error) {
+		res := httpmock.NewStringResponse(http.StatusOK, `<html><head><title>
+	Join   us </title></head><body>Dummy text</body></html>`)
+		res.Header.Set("Content-Type", "text/html; charset=utf-8")
+		return res, nil
+	})
+	httpmock.RegisterResponder("GET", url+"contact-us", httpmock.NewStringResponder(http.StatusNotFound, "Not found"))
+	httpmock.RegisterResponder("GET", url+"how-we-work", httpmock.NewErrorResponder(errors.New("unsupported protocol")))
+
+	sitemap := newTestCrawlerService().Crawl(context.Background(), &model.Request{Url: url}, nil)
+
+	career := sitemap.PageInfo[url+"career"]
+	assert.Equal(t, http.StatusOK, career.Status)
+	assert.Equal(t, "text/html", career.ContentType)
+	assert.Equal(t, "Join us", career.Title)
+	assert.Equal(t, 1, career.Depth)
+
+	assert.Equal(t, http.StatusNotFound, sitemap.PageInfo[url+"contact-us"].Status)
+
+	failed := sitemap.PageInfo[url+"how-we-work"]
+	assert.Equal(t, 0, failed.Status)
+	assert.Equal(t, 1, failed.Depth)
+	assert.Contains(t, failed.Error, "unsupported protocol")
+	assert.NotContains(t, sitemap.Pages, url+"how-we-work")
+}
+
+func TestCrawlService_Crawl_Disallowed(t *testing.T) {
+	url := "https://parserdigital.com/"
+	mockHttp := mock_service.NewHttpMock(url)
+	mockHttp.RegisterResponders()
+	httpmock.RegisterResponder("GET", url+"robots.txt", httpmock.NewStringResponder(200, `User-agent: *
+Disallow: /career
+Disallow: /contact-us$`))
+
+	service := newTestCrawlerService()
+
+	sitemap := service.Crawl(context.Background(), &model.Request{Url: url}, nil)
+
+	assert.NotContains(t, sitemap.Pages, url+"career")
+	assert.NotContains(t, sitemap.Pages, url+"contact-us")
+	assert.Contains(t, sitemap.Pages, url+"how-we-work")
+	assert.ElementsMatch(t, []string{url + "career", url + "contact-us"}, sitemap.Disallowed)
 
 	mockHttp.DeactivateAndReset()
 }
+
+func TestCrawlService_Crawl_DisallowedUserAgent(t *testing.T) {
+	url := "https://parserdigital.com/"
+	mockHttp := mock_service.NewHttpMock(url)
+	mockHttp.RegisterResponders()
+	defer mockHttp.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", url+"robots.txt", httpmock.NewStringResponder(200, `User-agent: *
+Disallow:
+
+User-agent: SeoBot
+Disallow: /career`))
+
+	service := newTestCrawlerService()
+
+	// The job is matched to the group of its own user agent, and its rules are cached apart from the default agent
+	seoBot := service.Crawl(context.Background(), &model.Request{
+		Url:   url,
+		Fetch: &model.FetchOptions{UserAgent: "SeoBot/2.0 (+https://parserdigital.com/bot)"},
+	}, nil)
+	crawler := service.Crawl(context.Background(), &model.Request{Url: url}, nil)
+
+	assert.Equal(t, []string{url + "career"}, seoBot.Disallowed)
+	assert.Contains(t, crawler.Pages, url+"career")
+	assert.Empty(t, crawler.Disallowed)
+	assert.Equal(t, 2, httpmock.GetCallCountInfo()["GET "+url+"robots.txt"])
+}
+
+func TestCrawlService_Crawl_IsolatedSessions(t *testing.T) {
+	url := "https://parserdigital.com/"
+	mockHttp := mock_service.NewHttpMock(url)
+	mockHttp.RegisterResponders()
+	httpmock.RegisterResponder("GET", url+"robots.txt", httpmock.NewStringResponder(200, "User-agent: *"))
+
+	service := newTestCrawlerService()
+
+	first := service.Crawl(context.Background(), &model.Request{Url: url}, nil)
+	second := service.Crawl(context.Background(), &model.Request{Url: url}, nil)
+
+	assert.Len(t, first.Pages, 10)
+	assert.Equal(t, first.Pages, second.Pages)
+	assert.Len(t, second.PageInfo, 10)
+	assert.NotSame(t, first, second)
+
+	// robots.txt is requested once and then reused from the cache
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["GET "+url+"robots.txt"])
+
+	mockHttp.DeactivateAndReset()
+}
+
+func TestCrawlService_Crawl_Limits(t *testing.T) {
+	url := "https://parserdigital.com/"
+	mockHttp := mock_service.NewHttpMock(url)
+	mockHttp.RegisterResponders()
+	httpmock.RegisterResponder("GET", url+"robots.txt", httpmock.NewStringResponder(200, "User-agent: *"))
+	defer mockHttp.DeactivateAndReset()
+
+	service := newTestCrawlerService()
+
+	t.Run("Max Depth", func(t *testing.T) {
+		sitemap := service.Crawl(context.Background(), &model.Request{Url: url, Limits: &model.Limits{MaxDepth: 1}}, nil)
+
+		assert.Len(t, sitemap.Pages, 4)
+		assert.Contains(t, sitemap.Pages, url+"career")
+		assert.NotContains(t, sitemap.Pages, url+"apply")
+		assert.True(t, sitemap.Truncated)
+		assert.Equal(t, model.LimitMaxDepth, sitemap.TruncatedBy)
+	})
+
+	t.Run("Max Pages", func(t *testing.T) {
+		sitemap := service.Crawl(context.Background(), &model.Request{Url: url, Limits: &model.Limits{MaxPages: 3}}, nil)
+
+		assert.Len(t, sitemap.Pages, 3)
+		assert.Contains(t, sitemap.Pages, url)
+		assert.True(t, sitemap.Truncated)
+		assert.Equal(t, model.LimitMaxPages, sitemap.TruncatedBy)
+	})
+
+	t.Run("Max Bytes", func(t *testing.T) {
+		sitemap := service.Crawl(context.Background(), &model.Request{Url: url, Limits: &model.Limits{MaxBytes: 1}}, nil)
+
+		assert.Len(t, sitemap.Pages, 1)
+		assert.True(t, sitemap.Truncated)
+		assert.Equal(t, model.LimitMaxBytes, sitemap.TruncatedBy)
+	})
+
+	t.Run("Not Truncated", func(t *testing.T) {
+		sitemap := service.Crawl(context.Background(), &model.Request{Url: url, Limits: &model.Limits{MaxDepth: 2, MaxPages: 10}}, nil)
+
+		assert.Len(t, sitemap.Pages, 10)
+		assert.False(t, sitemap.Truncated)
+		assert.Empty(t, sitemap.TruncatedBy)
+	})
+}
+
+func TestCrawlService_Crawl_Outcome(t *testing.T) {
+	url := "https://parserdigital.com/"
+
+	setup := func() *mock_service.HttpMock {
+		mockHttp := mock_service.NewHttpMock(url)
+		mockHttp.RegisterResponders()
+		httpmock.RegisterResponder("GET", url+"robots.txt", httpmock.NewStringResponder(200, "User-agent: *"))
+		return mockHttp
+	}
+
+	t.Run("Succeeded", func(t *testing.T) {
+		mockHttp := setup()
+		defer mockHttp.DeactivateAndReset()
+
+		sitemap := newTestCrawlerService().Crawl(context.Background(), &model.Request{Url: url}, nil)
+
+		assert.Equal(t, model.OutcomeSucceeded, sitemap.Outcome)
+		assert.Equal(t, 10, sitemap.Attempted)
+		assert.Equal(t, 10, sitemap.Succeeded)
+		assert.Empty(t, sitemap.Errors)
+	})
+
+	t.Run("Partial", func(t *testing.T) {
+		mockHttp := setup()
+		defer mockHttp.DeactivateAndReset()
+
+		httpmock.RegisterResponder("GET", url+"career", httpmock.NewStringResponder(http.StatusNotFound, "Not found"))
+		httpmock.RegisterResponder("GET", url+"how-we-work", httpmock.NewErrorResponder(errors.New("unsupported protocol")))
+
+		sitemap := newTestCrawlerService().Crawl(context.Background(), &model.Request{Url: url}, nil)
+
+		assert.Equal(t, model.OutcomePartial, sitemap.Outcome)
+		assert.Equal(t, 6, sitemap.Attempted)
+		assert.Equal(t, 4, sitemap.Succeeded)
+		assert.Len(t, sitemap.Errors, 2)
+		assert.Equal(t, model.PageError{Url: url + "career", Error: "error status code: 404"}, sitemap.Errors[0])
+		assert.Equal(t, url+"how-we-work", sitemap.Errors[1].Url)
+		assert.Contains(t, sitemap.Errors[1].Error, "unsupported protocol")
+	})
+
+	t.Run("Seed Failed", func(t *testing.T) {
+		mockHttp := setup()
+		defer mockHttp.DeactivateAndReset()
+
+		httpmock.RegisterResponder("GET", url, httpmock.NewErrorResponder(errors.New("connection refused")))
+
+		sitemap := newTestCrawlerService().Crawl(context.Background(), &model.Request{Url: url}, nil)
+
+		assert.Equal(t, model.OutcomeFailed, sitemap.Outcome)
+		assert.Equal(t, 1, sitemap.Attempted)
+		assert.Equal(t, 0, sitemap.Succeeded)
+		assert.Len(t, sitemap.Errors, 1)
+		assert.Equal(t, url, sitemap.Errors[0].Url)
+	})
+
+	t.Run("Seed Error Status", func(t *testing.T) {
+		mockHttp := setup()
+		defer mockHttp.DeactivateAndReset()
+
+		httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(http.StatusGone,
+			`<html><a href="/career">Join us</a></html>`))
+
+		sitemap := newTestCrawlerService().Crawl(context.Background(), &model.Request{Url: url}, nil)
+
+		assert.Equal(t, model.OutcomeFailed, sitemap.Outcome)
+		assert.Equal(t, 4, sitemap.Attempted)
+		assert.Equal(t, 3, sitemap.Succeeded)
+		assert.Equal(t, []model.PageError{{Url: url, Error: "error status code: 410"}}, sitemap.Errors)
+	})
+
+	t.Run("Seed Disallowed", func(t *testing.T) {
+		mockHttp := setup()
+		defer mockHttp.DeactivateAndReset()
+
+		httpmock.RegisterResponder("GET", url+"robots.txt", httpmock.NewStringResponder(200, "User-agent: *\nDisallow: /"))
+
+		sitemap := newTestCrawlerService().Crawl(context.Background(), &model.Request{Url: url}, nil)
+
+		assert.Equal(t, model.OutcomeFailed, sitemap.Outcome)
+		assert.Equal(t, 0, sitemap.Attempted)
+		assert.Equal(t, []model.PageError{{Url: url, Error: "disallowed by robots file"}}, sitemap.Errors)
+	})
+
+	t.Run("Invalid Request", func(t *testing.T) {
+		sitemap := newTestCrawlerService().Crawl(context.Background(), &model.Request{Url: "/career"}, nil)
+
+		assert.Equal(t, model.OutcomeFailed, sitemap.Outcome)
+		assert.Equal(t, []model.PageError{{
+			Url:   "/career",
+			Error: "error building scope: no host in url /career",
+		}}, sitemap.Errors)
+	})
+}
+
+func TestCrawlService_Crawl_Events(t *testing.T) {
+	url := "https://parserdigital.com/"
+	mockHttp := mock_service.NewHttpMock(url)
+	mockHttp.RegisterResponders()
+	defer mockHttp.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", url+"robots.txt", httpmock.NewStringResponder(200, "User-agent: *"))
+	httpmock.RegisterResponder("GET", url+"career", httpmock.NewErrorResponder(errors.New("unsupported protocol")))
+
+	events := make(chan model.Event, 100)
+	sitemap := newTestCrawlerService().Crawl(context.Background(), &model.Request{Url: url}, events)
+	close(events)
+
+	discovered := make(map[string]bool)
+	fetched := make(map[string][]string)
+	var failed []string
+	var progress []model.Progress
+	for event := range events {
+		switch event.Type {
+		case model.EventPageDiscovered:
+			discovered[event.Page.Url] = true
+		case model.EventPageFetched:
+			assert.True(t, discovered[event.Page.Url], "fetched before discovered: %s", event.Page.Url)
+			assert.NotNil(t, event.Page.Info)
+			fetched[event.Page.Url] = event.Page.Links
+		case model.EventPageFailed:
+			failed = append(failed, event.Page.Url)
+			assert.Contains(t, event.Page.Info.Error, "unsupported protocol")
+		}
+		progress = append(progress, event.Progress)
+	}
+
+	assert.Equal(t, sitemap.Pages, map[string][]string(fetched))
+	assert.Equal(t, []string{url + "career"}, failed)
+	// Events are sent by several goroutines, so the complete counts are not always in the last one
+	assert.Contains(t, progress, model.Progress{
+		Discovered: len(discovered),
+		Visited:    sitemap.Succeeded,
+		Failed:     1,
+	})
+}
+
+func TestCrawlService_Crawl_Cancelled(t *testing.T) {
+	url := "https://parserdigital.com/"
+
+	t.Run("During The Crawl", func(t *testing.T) {
+		mockHttp := mock_service.NewHttpMock(url)
+		mockHttp.RegisterResponders()
+		defer mockHttp.DeactivateAndReset()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		httpmock.RegisterResponder("GET", url+"robots.txt", httpmock.NewStringResponder(200, "User-agent: *"))
+		httpmock.RegisterResponder("GET", url+"career", func(req *http.Request) (*http.Response, error) {
+			cancel()
+			return httpmock.NewStringResponse(http.StatusOK, `<a href="/apply">Apply</a>`), nil
+		})
+
+		sitemap := newTestCrawlerService().Crawl(ctx, &model.Request{Url: url}, nil)
+
+		assert.Equal(t, model.OutcomeCancelled, sitemap.Outcome)
+		assert.Contains(t, sitemap.Pages, url)
+		assert.NotContains(t, sitemap.Pages, url+"apply")
+		assert.Empty(t, sitemap.Errors)
+	})
+
+	t.Run("Before The Crawl", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		sitemap := newTestCrawlerService().Crawl(ctx, &model.Request{Url: url}, nil)
+
+		assert.Equal(t, model.OutcomeCancelled, sitemap.Outcome)
+		assert.Empty(t, sitemap.Pages)
+		assert.Zero(t, sitemap.Attempted)
+	})
+}
+
+func TestCrawlService_GetRobots_Concurrent(t *testing.T) {
+	slow, _ := url.Parse("https://parserdigital.com/career")
+	fast, _ := url.Parse("https://blog.parserdigital.com/")
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	release := make(chan struct{})
+	httpmock.RegisterResponder("GET", "https://parserdigital.com/robots.txt", func(req *http.Request) (*http.Response, error) {
+		<-release
+		return httpmock.NewStringResponse(200, "User-agent: *\nDisallow: /career"), nil
+	})
+	httpmock.RegisterResponder("GET", "https://blog.parserdigital.com/robots.txt", httpmock.NewStringResponder(200, "User-agent: *"))
+
+	service := newTestCrawlerService().(*crawlService)
+	sess, _, err := service.newSession(&model.Request{Url: slow.String()})
+	assert.NoError(t, err)
+
+	results := make(chan *robots, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			results <- service.getRobots(context.Background(), sess, slow)
+		}()
+	}
+
+	// Another host is not blocked while the robots file of the first one is being fetched
+	assert.True(t, service.getRobots(context.Background(), sess, fast).allowed(fast))
+
+	close(release)
+	for i := 0; i < 3; i++ {
+		assert.False(t, (<-results).allowed(slow))
+	}
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["GET https://parserdigital.com/robots.txt"])
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+)
+
+// colonDirectives are the robots directives that have a value after a colon, which must not be taken for the user
+// agent prefix of an X-Robots-Tag header
+var colonDirectives = map[string]bool{
+	"unavailable_after": true,
+	"max-snippet":       true,
+	"max-image-preview": true,
+	"max-video-preview": true,
+}
+
+// pageDirectives are the robots directives of a page, from its robots meta tags and X-Robots-Tag headers
+type pageDirectives struct {
+	noindex  bool
+	nofollow bool
+}
+
+// parseDirectives reads the directives for the agent from the robots meta tags of the document and the X-Robots-Tag
+// headers of the response. Directives addressed to other user agents are ignored, and only the headers are read for
+// the resources that have no document
+func parseDirectives(doc *document, res *http.Response, agent string) pageDirectives {
+	var d pageDirectives
+
+	for _, value := range res.Header.Values("X-Robots-Tag") {
+		if name, rest, ok := strings.Cut(value, ":"); ok && !strings.Contains(name, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if !colonDirectives[name] {
+				if name != strings.ToLower(agent) {
+					continue
+				}
+				value = rest
+			}
+		}
+		d.add(value)
+	}
+
+	if doc == nil {
+		return d
+	}
+
+	for _, content := range doc.robots {
+		d.add(content)
+	}
+
+	return d
+}
+
+// add applies a comma separated list of directives such as "noindex, nofollow"
+func (d *pageDirectives) add(directives string) {
+	for _, directive := range strings.Split(directives, ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "noindex":
+			d.noindex = true
+		case "nofollow":
+			d.nofollow = true
+		case "none":
+			d.noindex, d.nofollow = true, true
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strings"
+	"testing"
+	"worker/internal/model"
+	mock_service "worker/internal/service/mocks"
+)
+
+func TestParseDirectives(t *testing.T) {
+	tests := []struct {
+		name       string
+		agent      string
+		header     []string
+		meta       string
+		directives pageDirectives
+	}{
+		{"None", userAgent, nil, "", pageDirectives{}},
+		{"Meta Robots", userAgent, nil, `<meta name="robots" content="noindex, nofollow">`, pageDirectives{true, true}},
+		{"Meta Crawler", userAgent, nil, `<meta name="ParserCrawler" content="nofollow">`, pageDirectives{false, true}},
+		{"Meta Other Crawler", userAgent, nil, `<meta name="googlebot" content="noindex">`, pageDirectives{}},
+		{"Meta Job Agent", "SeoBot", nil, `<meta name="seobot" content="noindex"><meta name="ParserCrawler" content="nofollow">`,
+			pageDirectives{true, false}},
+		{"Header", userAgent, []string{"noindex"}, "", pageDirectives{true, false}},
+		{"Header None", userAgent, []string{"none"}, "", pageDirectives{true, true}},
+		{"Header Crawler", userAgent, []string{"parsercrawler: nofollow", "googlebot: noindex"}, "", pageDirectives{false, true}},
+		{"Header Job Agent", "SeoBot", []string{"parsercrawler: nofollow", "SeoBot: noindex"}, "", pageDirectives{true, false}},
+		{"Header Colon Directive", userAgent, []string{"unavailable_after: 25 Jun 2010 15:00:00 PST, noindex"}, "",
+			pageDirectives{true, false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := &http.Response{Header: http.Header{"X-Robots-Tag": tt.header}}
+			doc, err := parseDocument(strings.NewReader("<html><head>"+tt.meta+"</head></html>"), tt.agent)
+			assert.NoError(t, err)
+
+			assert.Equal(t, tt.directives, parseDirectives(doc, res, tt.agent))
+		})
+	}
+}
+
+func TestCrawlService_Crawl_Directives(t *testing.T) {
+	url := "https://parserdigital.com/"
+
+	setup := func() *mock_service.HttpMock {
+		mockHttp := mock_service.NewHttpMock(url)
+		mockHttp.RegisterResponders()
+		httpmock.RegisterResponder("GET", url+"robots.txt", httpmock.NewStringResponder(200, "User-agent: *"))
+		httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(http.StatusOK, `<html>
+	<head><base href="/en/"></head>
+	<body>
+		<a href="how-we-work">How we work</a>
+		<a href="/career" rel="nofollow">Join us</a>
+		<a href="/contact-us">Contact us</a>
+	</body>
+</html>`))
+		httpmock.RegisterResponder("GET", url+"en/how-we-work", httpmock.NewStringResponder(http.StatusOK,
+			`<html><head><meta name="robots" content="noindex"></head><body>Dummy text</body></html>`))
+		httpmock.RegisterResponder("GET", url+"contact-us", httpmock.NewStringResponder(http.StatusOK,
+			`<html><body><a href="/form">Form</a></body></html>`).HeaderSet(http.Header{"X-Robots-Tag": {"nofollow"}}))
+		return mockHttp
+	}
+
+	t.Run("Respected", func(t *testing.T) {
+		mockHttp := setup()
+		defer mockHttp.DeactivateAndReset()
+
+		sitemap := newTestCrawlerService().Crawl(context.Background(), &model.Request{Url: url}, nil)
+
+		assert.Equal(t, []string{url + "en/how-we-work", url + "contact-us"}, sitemap.Pages[url])
+		assert.True(t, sitemap.Links[url][1].Nofollow)
+		assert.NotContains(t, sitemap.Pages, url+"career")
+
+		assert.Equal(t, []string{url + "en/how-we-work"}, sitemap.Noindex)
+		assert.True(t, sitemap.PageInfo[url+"en/how-we-work"].Noindex)
+
+		assert.True(t, sitemap.PageInfo[url+"contact-us"].Nofollow)
+		assert.Nil(t, sitemap.Pages[url+"contact-us"])
+		assert.NotContains(t, sitemap.Pages, url+"form")
+	})
+
+	t.Run("Ignored", func(t *testing.T) {
+		mockHttp := setup()
+		defer mockHttp.DeactivateAndReset()
+
+		sitemap := newTestCrawlerService().Crawl(context.Background(), &model.Request{
+			Url:        url,
+			Directives: &model.DirectivesPolicy{IgnoreNofollowLinks: true, IgnoreMetaRobots: true},
+		}, nil)
+
+		assert.Contains(t, sitemap.Pages, url+"career")
+		assert.Contains(t, sitemap.Pages, url+"form")
+		assert.Equal(t, []string{url + "en/how-we-work"}, sitemap.Noindex)
+	})
+}
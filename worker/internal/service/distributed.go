@@ -0,0 +1,464 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+	"worker/internal/infra"
+	"worker/internal/model"
+	"worker/internal/repo"
+)
+
+const (
+	// drainPollInterval is how often the worker that received a distributed job checks if its frontier is drained
+	drainPollInterval = 500 * time.Millisecond
+	// taskJobIdle is how long a worker keeps a distributed job after crawling its last page task, when the worker does
+	// not see the job finish
+	taskJobIdle = time.Minute
+)
+
+// Fleet holds the state shared by the workers to crawl the distributed jobs together, and to keep the politeness of
+// the hosts across all of them
+type Fleet struct {
+	Jobs  repo.JobRepo
+	Hosts repo.HostRepo
+	Tasks infra.AMQPClient
+}
+
+// sharedJob connects a session to the state of a distributed job, so its visited urls, frontier and limits are shared
+// by all the workers crawling it. Errors of the shared state are logged, dropping the links that cannot be claimed.
+// The state is read and written with the context of the job, so a cancelled job stops waiting for it
+type sharedJob struct {
+	ctx   context.Context
+	req   model.Request
+	jobs  repo.JobRepo
+	tasks infra.AMQPClient
+}
+
+// newSharedJob connects to the shared state of the distributed job of the request
+func (s *crawlService) newSharedJob(ctx context.Context, req *model.Request) *sharedJob {
+	return &sharedJob{
+		ctx:   ctx,
+		req:   *req,
+		jobs:  s.fleet.Jobs,
+		tasks: s.fleet.Tasks,
+	}
+}
+
+// claim adds the link to the visited urls of the job and reports whether it was not visited before
+func (j *sharedJob) claim(link string) bool {
+	claimed, err := j.jobs.Claim(j.ctx, j.req.ReqId, link)
+	if err != nil {
+		log.Printf("error claiming %s in job %s: %s", link, j.req.ReqId, err)
+		return false
+	}
+
+	return claimed
+}
+
+// seen checks if the link is in the visited urls of the job
+func (j *sharedJob) seen(link string) bool {
+	seen, err := j.jobs.Seen(j.ctx, j.req.ReqId, link)
+	if err != nil {
+		log.Printf("error checking %s in job %s: %s", link, j.req.ReqId, err)
+		return false
+	}
+
+	return seen
+}
+
+// progress returns the progress of the job across all the workers: the urls in its visited urls and the counters of
+// its pages. The parts that cannot be read are reported as zero
+func (j *sharedJob) progress() model.Progress {
+	var progress model.Progress
+
+	visited, err := j.jobs.Visited(j.ctx, j.req.ReqId)
+	if err != nil {
+		log.Printf("error counting the visited urls of job %s: %s", j.req.ReqId, err)
+	}
+	progress.Discovered = int(visited)
+
+	progress.Visited = int(j.count(repo.CounterVisited, 0))
+	progress.Failed = int(j.count(repo.CounterFailed, 0))
+	progress.Disallowed = int(j.count(repo.CounterDisallowed, 0))
+
+	return progress
+}
+
+// push publishes the page task for any worker to crawl it. It is counted as pending before it is published, so the
+// frontier of the job is never drained while the task is queued
+func (j *sharedJob) push(task crawlTask) {
+	body, err := json.Marshal(&model.PageTask{Request: j.req, Url: task.url, Depth: task.depth})
+	if err != nil {
+		log.Printf("error marshaling page task: %s", err)
+		return
+	}
+
+	if _, err := j.jobs.AddPending(j.ctx, j.req.ReqId, 1); err != nil {
+		log.Printf("error counting page task %s of job %s: %s", task.url, j.req.ReqId, err)
+		return
+	}
+
+	if err := j.tasks.PublishAMQTask(body); err != nil {
+		log.Printf("error publishing page task %s of job %s: %s", task.url, j.req.ReqId, err)
+		// The task was counted, so it is uncounted even when the job is cancelled meanwhile
+		if _, err := j.jobs.AddPending(context.Background(), j.req.ReqId, -1); err != nil {
+			log.Printf("error counting page task %s of job %s: %s", task.url, j.req.ReqId, err)
+		}
+	}
+}
+
+// count adds n to a counter of the job and returns it. The counter is reported as zero when it cannot be read, so the
+// limits do not stop the job because of an error
+func (j *sharedJob) count(counter string, n int64) int64 {
+	value, err := j.jobs.Count(j.ctx, j.req.ReqId, counter, n)
+	if err != nil {
+		log.Printf("error counting %s of job %s: %s", counter, j.req.ReqId, err)
+		return 0
+	}
+
+	return value
+}
+
+// stop stops the job for all the workers, which skip its remaining page tasks. It does not use the context of the job,
+// since a cancelled job is stopped too
+func (j *sharedJob) stop(reason string) {
+	if err := j.jobs.Stop(context.Background(), j.req.ReqId, reason); err != nil {
+		log.Printf("error stopping job %s: %s", j.req.ReqId, err)
+	}
+}
+
+// crawlDistributed publishes the seed and the pages listed in the sitemap files as page tasks, waits until the workers
+// drain the frontier of the job and merges the results of all the pages into the sitemap. A job delivered again only
+// waits for the tasks already published. Cancelling the context stops the job for all the workers. The events of the
+// fetched and failed pages are sent by the workers crawling them, while this one only sends the discovered seeds
+func (s *crawlService) crawlDistributed(ctx context.Context, req *model.Request, sess *crawlSession, seed *url.URL) *model.Sitemap {
+	jobId := req.ReqId
+	sess.shared = s.newSharedJob(ctx, req)
+
+	started, err := s.fleet.Jobs.Start(ctx, jobId)
+	if err != nil {
+		log.Printf("error starting distributed crawl of %s: %s", req.Url, err)
+		return failedSitemap(req.Url, errors.New(fmt.Sprintf("error starting distributed job: %s", err)))
+	}
+
+	if sess.limits.MaxSeconds > 0 {
+		timer := time.AfterFunc(time.Duration(sess.limits.MaxSeconds)*time.Second, func() {
+			sess.shared.stop(model.LimitMaxSeconds)
+		})
+		defer timer.Stop()
+	}
+
+	listed := s.getSitemapURLs(ctx, sess, seed)
+	if started {
+		sess.enqueueSeeds(seed.String(), listed)
+	} else {
+		log.Printf("distributed crawl of %s delivered again, waiting for its page tasks", req.Url)
+	}
+
+	// The job is still drained, merged and deleted once it is cancelled, so the calls below do not use its context
+	cancelled := s.waitDrained(ctx, sess)
+
+	if err := s.mergeResults(sess, jobId); err != nil {
+		log.Printf("error merging the results of %s: %s", req.Url, err)
+	}
+
+	if reason, err := s.fleet.Jobs.Stopped(context.Background(), jobId); err != nil {
+		log.Printf("error getting the state of job %s: %s", jobId, err)
+	} else if reason != "" && reason != model.OutcomeCancelled {
+		sess.truncate(reason)
+	}
+
+	if err := s.fleet.Jobs.Delete(context.Background(), jobId); err != nil {
+		log.Printf("error deleting the state of job %s: %s", jobId, err)
+	}
+
+	return s.finish(req, sess, seed, listed, cancelled)
+}
+
+// waitDrained waits until no page task of the job is queued or being processed. When the context is cancelled the job
+// is stopped, and it keeps waiting for the tasks in flight so their results are not lost. It reports whether the job
+// was cancelled
+func (s *crawlService) waitDrained(ctx context.Context, sess *crawlSession) bool {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	cancelled := false
+	for {
+		pending, err := s.fleet.Jobs.AddPending(context.Background(), sess.shared.req.ReqId, 0)
+		if err != nil {
+			log.Printf("error getting the pending tasks of job %s: %s", sess.shared.req.ReqId, err)
+		} else if pending <= 0 {
+			return cancelled
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if !cancelled {
+				cancelled = true
+				sess.shared.stop(model.OutcomeCancelled)
+			}
+			// The tasks left are skipped, so it only waits for the ones in flight
+			<-ticker.C
+		}
+	}
+}
+
+// CrawlTask crawls a page of a distributed job and stores its result for the worker that received the job, sending the
+// events of the page to the events channel unless it is nil. The links found are published as new page tasks. Tasks of
+// stopped jobs are skipped, and a task delivered again only counts once towards draining the frontier. The pages are
+// not requested conditionally, since the history of the site is only loaded by the worker that received the job
+func (s *crawlService) CrawlTask(ctx context.Context, task *model.PageTask, events chan<- model.Event) {
+	if s.fleet == nil {
+		log.Printf("skipping page task %s, the worker has no fleet", task.Url)
+		return
+	}
+
+	jobId := task.Request.ReqId
+	stopped := s.crawlTask(ctx, task, events)
+
+	// The worker drops the job once it is over, which it knows when it is stopped or when its last task is done
+	if drained := s.finishTask(jobId, task.Url); stopped || drained {
+		s.taskJobs.drop(jobId)
+	}
+}
+
+// crawlTask crawls the page of a task with the session of its job in the worker, and reports whether the job was
+// stopped or cancelled
+func (s *crawlService) crawlTask(ctx context.Context, task *model.PageTask, events chan<- model.Event) bool {
+	jobId := task.Request.ReqId
+
+	if ctx.Err() != nil {
+		log.Printf("skipping page task %s, job %s was cancelled", task.Url, jobId)
+		return true
+	}
+
+	reason, err := s.fleet.Jobs.Stopped(ctx, jobId)
+	if err != nil {
+		log.Printf("error getting the state of job %s: %s", jobId, err)
+	}
+	if reason != "" {
+		log.Printf("skipping page task %s, job %s was stopped: %s", task.Url, jobId, reason)
+		return true
+	}
+
+	job, err := s.taskJobs.acquire(jobId, func() (*crawlSession, error) {
+		sess, _, err := s.newSession(&task.Request)
+		return sess, err
+	})
+	if err != nil {
+		return false
+	}
+	defer s.taskJobs.release(jobId)
+
+	sess := job.newTaskSession(&task.Request)
+	sess.shared = s.newSharedJob(ctx, &task.Request)
+	sess.events = events
+
+	s.crawlPage(ctx, sess, crawlTask{url: task.Url, depth: task.Depth})
+
+	// The result of a page is the state of its session, in the same format as the checkpoints
+	data, err := sess.checkpoint(nil)
+	if err != nil {
+		log.Printf("error marshaling the result of %s: %s", task.Url, err)
+		return false
+	}
+	if err := s.fleet.Jobs.SaveResult(ctx, jobId, task.Url, data); err != nil {
+		log.Printf("error saving the result of %s: %s", task.Url, err)
+	}
+
+	return false
+}
+
+// finishTask marks the page task as done, removing it from the pending tasks of the job the first time, and reports
+// whether no task of the job is left. It does not use the context of the job, since the worker that received a
+// cancelled job waits for its tasks to be done
+func (s *crawlService) finishTask(jobId, link string) bool {
+	ctx := context.Background()
+
+	first, err := s.fleet.Jobs.Finish(ctx, jobId, link)
+	if err != nil {
+		log.Printf("error finishing page task %s of job %s: %s", link, jobId, err)
+		return false
+	}
+
+	if !first {
+		return false
+	}
+
+	pending, err := s.fleet.Jobs.AddPending(ctx, jobId, -1)
+	if err != nil {
+		log.Printf("error counting page task %s of job %s: %s", link, jobId, err)
+		return false
+	}
+
+	return pending <= 0
+}
+
+// taskJob is a distributed job whose page tasks run in the worker. Its session is built once, with the fetcher and the
+// settings of the job, and every task gets a session of its own from it for its result
+type taskJob struct {
+	sess     *crawlSession
+	running  int
+	lastUsed time.Time
+	finished bool
+}
+
+// newTaskSession builds the session of a page task, sharing the fetcher and the settings of the session of the job
+func (j *taskJob) newTaskSession(req *model.Request) *crawlSession {
+	sess := newCrawlSession(req, j.sess.scope, j.sess.fetcher, j.sess.retry, j.sess.retriesLeft)
+	sess.agent = j.sess.agent
+
+	return sess
+}
+
+// taskJobCache keeps the distributed jobs whose page tasks run in the worker by request id, until they are over
+type taskJobCache struct {
+	jobs map[string]*taskJob
+	mu   sync.Mutex
+	now  func() time.Time
+}
+
+// newTaskJobCache builds an empty cache of distributed jobs
+func newTaskJobCache() *taskJobCache {
+	return &taskJobCache{
+		jobs: make(map[string]*taskJob),
+		now:  time.Now,
+	}
+}
+
+// acquire returns the job for one of its page tasks to run, building its session the first time. The jobs left idle
+// for longer than taskJobIdle are dropped meanwhile
+func (c *taskJobCache) acquire(jobId string, build func() (*crawlSession, error)) (*taskJob, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for id, job := range c.jobs {
+		if job.running == 0 && now.Sub(job.lastUsed) > taskJobIdle {
+			c.remove(id, job)
+		}
+	}
+
+	job, ok := c.jobs[jobId]
+	if !ok {
+		sess, err := build()
+		if err != nil {
+			return nil, err
+		}
+		job = &taskJob{sess: sess}
+		c.jobs[jobId] = job
+	}
+	job.running++
+	job.lastUsed = now
+
+	return job, nil
+}
+
+// release marks a page task of the job as done, dropping the job when it is over and none of its tasks are running
+func (c *taskJobCache) release(jobId string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	job, ok := c.jobs[jobId]
+	if !ok {
+		return
+	}
+
+	job.running--
+	job.lastUsed = c.now()
+	if job.finished && job.running <= 0 {
+		c.remove(jobId, job)
+	}
+}
+
+// drop marks the job as over, dropping it now if none of its tasks are running or otherwise when the last one is done
+func (c *taskJobCache) drop(jobId string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	job, ok := c.jobs[jobId]
+	if !ok {
+		return
+	}
+
+	job.finished = true
+	if job.running <= 0 {
+		c.remove(jobId, job)
+	}
+}
+
+// remove deletes the job and closes its fetcher. It must be called with the lock held
+func (c *taskJobCache) remove(jobId string, job *taskJob) {
+	delete(c.jobs, jobId)
+	job.sess.fetcher.Close()
+}
+
+// mergeResults adds the results of all the pages of the distributed job to the session
+func (s *crawlService) mergeResults(sess *crawlSession, jobId string) error {
+	results, err := s.fleet.Jobs.Results(context.Background(), jobId)
+	if err != nil {
+		return err
+	}
+
+	for link, data := range results {
+		if err := sess.merge(data); err != nil {
+			log.Printf("error merging the result of %s: %s", link, err)
+		}
+	}
+
+	return nil
+}
+
+// merge adds the result of a page task, which is the checkpoint of the session that crawled it, to the session. Its
+// events were already sent by the worker that crawled it
+func (cs *crawlSession) merge(data []byte) error {
+	cp := &checkpoint{}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return errors.New(fmt.Sprintf("error unmarshaling page result: %s", err))
+	}
+
+	cs.sitemapPageMu.Lock()
+	result, sitemap := cp.Sitemap, cs.sitemap
+	for link, links := range result.Pages {
+		sitemap.Pages[link] = links
+	}
+	for link, info := range result.PageInfo {
+		sitemap.PageInfo[link] = info
+	}
+	for link, found := range result.Links {
+		sitemap.Links[link] = found
+	}
+	for link, contentType := range result.Resources {
+		if sitemap.Resources == nil {
+			sitemap.Resources = make(map[string]string)
+		}
+		sitemap.Resources[link] = contentType
+	}
+	sitemap.Noindex = append(sitemap.Noindex, result.Noindex...)
+	sitemap.Disallowed = append(sitemap.Disallowed, result.Disallowed...)
+	sitemap.Errors = append(sitemap.Errors, result.Errors...)
+	sitemap.RedirectIssues = append(sitemap.RedirectIssues, result.RedirectIssues...)
+	if result.Truncated && !sitemap.Truncated {
+		sitemap.Truncated, sitemap.TruncatedBy = true, result.TruncatedBy
+	}
+
+	for link, fp := range cp.Fingerprints {
+		cs.fingerprints[link] = fingerprint{canonical: fp.Canonical, hash: fp.Hash, simHash: fp.SimHash}
+	}
+
+	cs.stats.visited += cp.Stats.Visited
+	cs.stats.failed += cp.Stats.Failed
+	cs.stats.errorStatus += cp.Stats.ErrorStatus
+	cs.stats.disallowed += cp.Stats.Disallowed
+	cs.bytes += cp.Bytes
+	cs.sitemapPageMu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,418 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+	mock_infra "worker/internal/infra/mocks"
+	"worker/internal/model"
+	"worker/internal/repo"
+	mock_service "worker/internal/service/mocks"
+)
+
+// memoryJobRepo holds the state of the distributed jobs in memory, as Redis would for all the workers
+type memoryJobRepo struct {
+	visited  map[string]bool
+	done     map[string]bool
+	pending  int64
+	counters map[string]int64
+	results  map[string][]byte
+	stopped  string
+	mu       sync.Mutex
+}
+
+func newMemoryJobRepo() *memoryJobRepo {
+	return &memoryJobRepo{
+		visited:  make(map[string]bool),
+		done:     make(map[string]bool),
+		counters: make(map[string]int64),
+		results:  make(map[string][]byte),
+	}
+}
+
+func (r *memoryJobRepo) Start(ctx context.Context, jobId string) (bool, error) {
+	return true, nil
+}
+
+func (r *memoryJobRepo) Claim(ctx context.Context, jobId, url string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	claimed := !r.visited[url]
+	r.visited[url] = true
+	return claimed, nil
+}
+
+func (r *memoryJobRepo) Seen(ctx context.Context, jobId, url string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.visited[url], nil
+}
+
+func (r *memoryJobRepo) Visited(ctx context.Context, jobId string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return int64(len(r.visited)), nil
+}
+
+func (r *memoryJobRepo) AddPending(ctx context.Context, jobId string, n int64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending += n
+	return r.pending, nil
+}
+
+func (r *memoryJobRepo) Finish(ctx context.Context, jobId, url string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	first := !r.done[url]
+	r.done[url] = true
+	return first, nil
+}
+
+func (r *memoryJobRepo) Count(ctx context.Context, jobId, counter string, n int64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counters[counter] += n
+	return r.counters[counter], nil
+}
+
+func (r *memoryJobRepo) SaveResult(ctx context.Context, jobId, url string, data []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results[url] = data
+	return nil
+}
+
+func (r *memoryJobRepo) Results(ctx context.Context, jobId string) (map[string][]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	results := make(map[string][]byte, len(r.results))
+	for url, data := range r.results {
+		results[url] = data
+	}
+	return results, nil
+}
+
+func (r *memoryJobRepo) Stop(ctx context.Context, jobId, reason string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopped == "" {
+		r.stopped = reason
+	}
+	return nil
+}
+
+func (r *memoryJobRepo) Stopped(ctx context.Context, jobId string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stopped, nil
+}
+
+func (r *memoryJobRepo) Delete(ctx context.Context, jobId string) error {
+	return nil
+}
+
+// newTestFleet builds a fleet whose page tasks are crawled by a pool of services, as if they were different workers,
+// sending the events of the pages to the events channel unless it is nil
+func newTestFleet(ctrl *gomock.Controller, jobs *memoryJobRepo, workers int, events chan<- model.Event) (*Fleet, func(s CrawlerService)) {
+	tasks := mock_infra.NewMockAMQPClient(ctrl)
+	fleet := &Fleet{Jobs: jobs, Tasks: tasks}
+
+	var services []CrawlerService
+	var next int
+	var mu sync.Mutex
+	tasks.EXPECT().PublishAMQTask(gomock.Any()).DoAndReturn(func(body []byte) error {
+		task := &model.PageTask{}
+		if err := json.Unmarshal(body, task); err != nil {
+			return err
+		}
+
+		mu.Lock()
+		worker := services[next%len(services)]
+		next++
+		mu.Unlock()
+
+		go worker.CrawlTask(context.Background(), task, events)
+		return nil
+	}).AnyTimes()
+
+	return fleet, func(s CrawlerService) {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(services) < workers {
+			services = append(services, s)
+		}
+	}
+}
+
+func TestCrawlService_Crawl_Distributed(t *testing.T) {
+	url := "https://parserdigital.com/"
+
+	mockHttp := mock_service.NewHttpMock(url)
+	mockHttp.RegisterResponders()
+	defer mockHttp.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", url+"robots.txt", httpmock.NewStringResponder(200, "User-agent: *"))
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	t.Run("Crawled By All The Workers", func(t *testing.T) {
+		httpmock.ZeroCallCounters()
+
+		jobs := newMemoryJobRepo()
+		fleet, join := newTestFleet(ctrl, jobs, 3, nil)
+
+		config := DefaultConfig()
+		var services []CrawlerService
+		for i := 0; i < 3; i++ {
+			service := NewCrawlerService(config, newHTTPFetcher(config.Fetch, nil), nil, nil, fleet)
+			services = append(services, service)
+			join(service)
+		}
+
+		req := &model.Request{ReqId: "req-id", Url: url, Distributed: true}
+		sitemap := services[0].Crawl(context.Background(), req, nil)
+
+		assert.Len(t, sitemap.Pages, 10)
+		assert.Equal(t, 10, sitemap.Attempted)
+		assert.Equal(t, 10, sitemap.Succeeded)
+		assert.Equal(t, model.OutcomeSucceeded, sitemap.Outcome)
+		assert.False(t, sitemap.Truncated)
+		assert.Equal(t, []string{url + "how-we-work", url + "career", url + "contact-us"}, sitemap.Pages[url])
+
+		// Every page is fetched once across the fleet
+		calls := httpmock.GetCallCountInfo()
+		for page := range sitemap.Pages {
+			assert.Equal(t, 1, calls["GET "+page], page)
+		}
+		assert.Zero(t, jobs.pending)
+	})
+
+	t.Run("Page Limit Shared", func(t *testing.T) {
+		jobs := newMemoryJobRepo()
+		fleet, join := newTestFleet(ctrl, jobs, 2, nil)
+
+		config := DefaultConfig()
+		service := NewCrawlerService(config, newHTTPFetcher(config.Fetch, nil), nil, nil, fleet)
+		join(service)
+		join(NewCrawlerService(config, newHTTPFetcher(config.Fetch, nil), nil, nil, fleet))
+
+		req := &model.Request{ReqId: "req-id", Url: url, Distributed: true, Limits: &model.Limits{MaxPages: 4}}
+		sitemap := service.Crawl(context.Background(), req, nil)
+
+		assert.Len(t, sitemap.Pages, 4)
+		assert.True(t, sitemap.Truncated)
+		assert.Equal(t, model.LimitMaxPages, sitemap.TruncatedBy)
+		assert.Equal(t, model.LimitMaxPages, jobs.stopped)
+	})
+
+	t.Run("Events Sent By The Workers", func(t *testing.T) {
+		jobs := newMemoryJobRepo()
+		taskEvents := make(chan model.Event, 100)
+		fleet, join := newTestFleet(ctrl, jobs, 2, taskEvents)
+
+		config := DefaultConfig()
+		service := NewCrawlerService(config, newHTTPFetcher(config.Fetch, nil), nil, nil, fleet)
+		join(service)
+		join(NewCrawlerService(config, newHTTPFetcher(config.Fetch, nil), nil, nil, fleet))
+
+		// The worker that received the job only sends the seed it discovered, the pages are sent as they are crawled
+		events := make(chan model.Event, 100)
+		service.Crawl(context.Background(), &model.Request{ReqId: "req-id", Url: url, Distributed: true}, events)
+		close(events)
+		close(taskEvents)
+
+		for event := range events {
+			assert.Equal(t, model.EventPageDiscovered, event.Type)
+		}
+
+		// The progress is shared by the workers, so it reaches the pages of the whole job
+		var fetched, visited int
+		for event := range taskEvents {
+			if event.Type == model.EventPageFetched {
+				fetched++
+				if event.Progress.Visited > visited {
+					visited = event.Progress.Visited
+				}
+			}
+		}
+
+		assert.Equal(t, 10, fetched)
+		assert.Equal(t, 10, visited)
+		assert.Equal(t, int64(10), jobs.counters[repo.CounterVisited])
+	})
+
+	t.Run("Retry Budget Shared", func(t *testing.T) {
+		httpmock.ZeroCallCounters()
+		pages := []string{"how-we-work", "career", "contact-us"}
+		for _, page := range pages {
+			httpmock.RegisterResponder("GET", url+page, httpmock.NewStringResponder(http.StatusInternalServerError, "Error"))
+		}
+		defer func() {
+			mockHttp.RegisterResponders()
+			httpmock.RegisterResponder("GET", url+"robots.txt", httpmock.NewStringResponder(200, "User-agent: *"))
+		}()
+
+		jobs := newMemoryJobRepo()
+		fleet, join := newTestFleet(ctrl, jobs, 2, nil)
+
+		config := DefaultConfig()
+		config.RetryBaseDelay = time.Millisecond
+		config.RetryMaxDelay = time.Millisecond
+		service := NewCrawlerService(config, newHTTPFetcher(config.Fetch, nil), nil, nil, fleet)
+		join(service)
+		join(NewCrawlerService(config, newHTTPFetcher(config.Fetch, nil), nil, nil, fleet))
+
+		// Each page task has its own session, but the job has a single budget of one retry
+		maxTotalRetries := 1
+		sitemap := service.Crawl(context.Background(), &model.Request{
+			ReqId:       "req-id",
+			Url:         url,
+			Distributed: true,
+			Retry:       &model.RetryOptions{MaxTotalRetries: &maxTotalRetries},
+		}, nil)
+
+		calls := 0
+		for _, page := range pages {
+			calls += httpmock.GetCallCountInfo()["GET "+url+page]
+		}
+		assert.Equal(t, 4, calls)
+		assert.Len(t, sitemap.Errors, 3)
+	})
+
+	t.Run("Without Fleet", func(t *testing.T) {
+		config := DefaultConfig()
+		service := NewCrawlerService(config, newHTTPFetcher(config.Fetch, nil), nil, nil, nil)
+
+		sitemap := service.Crawl(context.Background(), &model.Request{ReqId: "req-id", Url: url, Distributed: true}, nil)
+
+		assert.Len(t, sitemap.Pages, 10)
+		assert.Equal(t, model.OutcomeSucceeded, sitemap.Outcome)
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		jobs := newMemoryJobRepo()
+		fleet, join := newTestFleet(ctrl, jobs, 1, nil)
+
+		config := DefaultConfig()
+		service := NewCrawlerService(config, newHTTPFetcher(config.Fetch, nil), nil, nil, fleet)
+		join(service)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		httpmock.RegisterResponder("GET", url+"career", func(req *http.Request) (*http.Response, error) {
+			cancel()
+			return httpmock.NewStringResponse(http.StatusOK, "<html>career</html>"), nil
+		})
+
+		sitemap := service.Crawl(ctx, &model.Request{ReqId: "req-id", Url: url, Distributed: true}, nil)
+
+		assert.Equal(t, model.OutcomeCancelled, sitemap.Outcome)
+		assert.Equal(t, model.OutcomeCancelled, jobs.stopped)
+		assert.Less(t, len(sitemap.Pages), 10)
+		assert.Zero(t, jobs.pending)
+	})
+}
+
+func TestCrawlService_CrawlTask_Cancelled(t *testing.T) {
+	url := "https://parserdigital.com/"
+	mockHttp := mock_service.NewHttpMock(url)
+	mockHttp.RegisterResponders()
+	defer mockHttp.DeactivateAndReset()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	jobs := newMemoryJobRepo()
+	jobs.pending = 1
+	config := DefaultConfig()
+	service := NewCrawlerService(config, newHTTPFetcher(config.Fetch, nil), nil, nil,
+		&Fleet{Jobs: jobs, Tasks: mock_infra.NewMockAMQPClient(ctrl)})
+
+	// The task of a cancelled job is skipped, but still counted as done so the job is drained
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	service.CrawlTask(ctx, &model.PageTask{
+		Request: model.Request{ReqId: "req-id", Url: url, Distributed: true},
+		Url:     url + "career",
+		Depth:   1,
+	}, nil)
+
+	assert.Zero(t, httpmock.GetTotalCallCount())
+	assert.Empty(t, jobs.results)
+	assert.Zero(t, jobs.pending)
+}
+
+// closeCounter counts how many times the fetcher is closed
+type closeCounter struct {
+	Fetcher
+	closed int
+}
+
+func (f *closeCounter) Close() {
+	f.closed++
+}
+
+func TestTaskJobCache(t *testing.T) {
+	now := time.Date(2023, 11, 1, 10, 0, 0, 0, time.UTC)
+	cache := newTaskJobCache()
+	cache.now = func() time.Time { return now }
+
+	var built []*closeCounter
+	build := func() (*crawlSession, error) {
+		fetcher := &closeCounter{}
+		built = append(built, fetcher)
+		return &crawlSession{fetcher: fetcher}, nil
+	}
+
+	t.Run("Built Once Per Job", func(t *testing.T) {
+		first, err := cache.acquire("job", build)
+		assert.NoError(t, err)
+		second, err := cache.acquire("job", build)
+		assert.NoError(t, err)
+
+		assert.Same(t, first, second)
+		assert.Len(t, built, 1)
+	})
+
+	t.Run("Dropped Once Its Tasks Are Done", func(t *testing.T) {
+		cache.drop("job")
+		cache.release("job")
+		assert.Contains(t, cache.jobs, "job")
+		assert.Zero(t, built[0].closed)
+
+		cache.release("job")
+		assert.NotContains(t, cache.jobs, "job")
+		assert.Equal(t, 1, built[0].closed)
+	})
+
+	t.Run("Dropped When Idle", func(t *testing.T) {
+		_, err := cache.acquire("idle", build)
+		assert.NoError(t, err)
+		cache.release("idle")
+
+		now = now.Add(2 * taskJobIdle)
+		_, err = cache.acquire("other", build)
+		assert.NoError(t, err)
+
+		assert.NotContains(t, cache.jobs, "idle")
+		assert.Equal(t, 1, built[1].closed)
+		assert.Contains(t, cache.jobs, "other")
+	})
+
+	t.Run("Build Error", func(t *testing.T) {
+		_, err := cache.acquire("invalid", func() (*crawlSession, error) {
+			return nil, errors.New("some error")
+		})
+
+		assert.Error(t, err)
+		assert.NotContains(t, cache.jobs, "invalid")
+	})
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// document is what the crawler reads from an HTML page, extracted in a single pass of the tokenizer without building
+// its DOM
+type document struct {
+	// base is the href of the first <base> element
+	base string
+	// title is the text of the first <title> element with the whitespace collapsed
+	title string
+	// canonical is the href of the first <link rel="canonical"> element
+	canonical string
+	// robots are the contents of the robots meta tags addressed to all crawlers or to the agent of the crawler
+	robots []string
+	// links are the urls of the link elements, in document order and before they are resolved
+	links []rawLink
+	// text is the visible text of the page in lowercase with the whitespace collapsed
+	text string
+}
+
+// parseDocument tokenizes an HTML page and extracts its base url, title, canonical link, robots meta tags for the agent,
+// links and text. Attributes are only read for the elements the crawler looks at
+func parseDocument(r io.Reader, agent string) (*document, error) {
+	doc := &document{}
+	z := html.NewTokenizer(r)
+
+	var (
+		words    []string
+		title    []string
+		inTitle  bool
+		hasTitle bool
+		hasBase  bool
+		// hidden counts the open elements whose content is not visible text
+		hidden int
+	)
+
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				return nil, err
+			}
+
+			doc.title = strings.Join(title, " ")
+			doc.text = strings.Join(words, " ")
+			return doc, nil
+
+		case html.TextToken:
+			switch {
+			case inTitle:
+				title = append(title, strings.Fields(string(z.Text()))...)
+			case hidden == 0:
+				words = append(words, strings.Fields(strings.ToLower(string(z.Text())))...)
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			tag := string(name)
+
+			if tt == html.StartTagToken {
+				switch {
+				case tag == "title":
+					inTitle = !hasTitle
+					hasTitle = true
+					hidden++
+				case textlessElements[tag]:
+					hidden++
+				}
+			}
+
+			if !hasAttr {
+				continue
+			}
+
+			switch {
+			case tag == "base" && !hasBase:
+				if href, ok := tagAttrs(z)["href"]; ok {
+					doc.base, hasBase = href, true
+				}
+			case tag == "meta":
+				attrs := tagAttrs(z)
+				if name := attrs["name"]; strings.EqualFold(name, "robots") || strings.EqualFold(name, agent) {
+					doc.robots = append(doc.robots, attrs["content"])
+				}
+			case linkElements[tag]:
+				attrs := tagAttrs(z)
+				if tag == "link" && doc.canonical == "" && hasRel(attrs["rel"], "canonical") {
+					doc.canonical = strings.TrimSpace(attrs["href"])
+				}
+				doc.links = append(doc.links, elementLinks(tag, attrs)...)
+			}
+
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			tag := string(name)
+			if (tag == "title" || textlessElements[tag]) && hidden > 0 {
+				hidden--
+			}
+			if tag == "title" {
+				inTitle = false
+			}
+		}
+	}
+}
+
+// tagAttrs returns the attributes of the current tag of the tokenizer. Only the first of repeated attributes is kept,
+// as browsers do
+func tagAttrs(z *html.Tokenizer) map[string]string {
+	attrs := make(map[string]string)
+	for {
+		key, value, more := z.TagAttr()
+		if _, ok := attrs[string(key)]; !ok {
+			attrs[string(key)] = string(value)
+		}
+		if !more {
+			return attrs
+		}
+	}
+}
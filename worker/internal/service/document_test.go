@@ -0,0 +1,56 @@
+package service
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"worker/internal/model"
+)
+
+func TestParseDocument(t *testing.T) {
+	doc, err := parseDocument(strings.NewReader(`<!DOCTYPE html>
+<html>
+	<head>
+		<title>Parser  &amp;
+			Digital</title>
+		<base href="/en/">
+		<base href="/es/">
+		<meta name="ROBOTS" content="noindex">
+		<meta name="description" content="nofollow">
+		<meta name="parsercrawler" content="nofollow">
+		<link rel="Canonical" href=" /home ">
+		<link rel="stylesheet" href="/style.css">
+		<script src="/app.js">var x = "<a href='/fake'>";</script>
+		<style>a { color: red }</style>
+	</head>
+	<body>
+		<h1>Hello   World</h1>
+		<a href="/career" rel="nofollow" href="/other">Join &amp; grow</a>
+		<noscript><a href="/hidden">Hidden</a></noscript>
+		<template><p>Template</p></template>
+		<svg><title>Icon</title></svg>
+		<img src="/logo.png"/>
+		<p>Parser
+		Digital</p>
+	</body>
+</html>`), userAgent)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "Parser & Digital", doc.title)
+	assert.Equal(t, "/en/", doc.base)
+	assert.Equal(t, "/home", doc.canonical)
+	assert.Equal(t, []string{"noindex", "nofollow"}, doc.robots)
+	assert.Equal(t, []rawLink{
+		{href: "/style.css", element: "link", kind: model.LinkAsset},
+		{href: "/app.js", element: "script", kind: model.LinkAsset},
+		{href: "/career", element: "a", kind: model.LinkNavigation, nofollow: true},
+		{href: "/logo.png", element: "img", kind: model.LinkAsset},
+	}, doc.links)
+	assert.Equal(t, "hello world join & grow parser digital", doc.text)
+}
+
+func TestParseDocument_Empty(t *testing.T) {
+	doc, err := parseDocument(strings.NewReader(""), userAgent)
+	assert.NoError(t, err)
+	assert.Equal(t, &document{}, doc)
+}
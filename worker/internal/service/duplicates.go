@@ -0,0 +1,248 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"net/url"
+	"sort"
+	"strings"
+	"worker/internal/model"
+)
+
+// shingleSize is the number of consecutive words hashed together as a feature of the SimHash
+const shingleSize = 3
+
+// textlessElements are skipped when reading the text of a page, along with its title
+var textlessElements = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"noscript": true,
+	"template": true,
+}
+
+// fingerprint identifies the content of a page to find its duplicates
+type fingerprint struct {
+	canonical string
+	hash      string
+	simHash   uint64
+}
+
+// getCanonicalLink returns the canonical form of the <link rel="canonical"> of the document, or an empty string when it
+// has none
+func (s *crawlService) getCanonicalLink(sess *crawlSession, doc *document, base *url.URL) string {
+	if doc.canonical == "" {
+		return ""
+	}
+
+	u, err := base.Parse(doc.canonical)
+	if err != nil {
+		return ""
+	}
+
+	return sess.canonical.canonicalize(u).String()
+}
+
+// contentHash returns the SHA-256 of the text in hex
+func contentHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// simHash returns the 64 bits SimHash of the text, built from its shingles of consecutive words. Similar texts have
+// hashes that differ in few bits
+func simHash(text string) uint64 {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return 0
+	}
+
+	var weights [64]int
+	for i := 0; i == 0 || i+shingleSize <= len(words); i++ {
+		end := i + shingleSize
+		if end > len(words) {
+			end = len(words)
+		}
+
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:end], " ")))
+		feature := h.Sum64()
+
+		for bit := 0; bit < 64; bit++ {
+			if feature&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	var hash uint64
+	for bit, weight := range weights {
+		if weight > 0 {
+			hash |= 1 << bit
+		}
+	}
+
+	return hash
+}
+
+// formatSimHash returns the SimHash in hex, since 64 bits numbers do not fit in JSON numbers
+func formatSimHash(hash uint64) string {
+	return fmt.Sprintf("%016x", hash)
+}
+
+// findDuplicates groups the pages that declare the same canonical url, have the same content hash, or have SimHashes
+// that differ in at most maxDistance bits. Only groups of two or more pages are returned
+func findDuplicates(fingerprints map[string]fingerprint, maxDistance int) []model.DuplicateCluster {
+	urls := make([]string, 0, len(fingerprints))
+	for u := range fingerprints {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+
+	// Union find over the indexes of the sorted urls
+	parent := make([]int, len(urls))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	union := func(i, j int) {
+		if ri, rj := find(i), find(j); ri != rj {
+			parent[rj] = ri
+		}
+	}
+
+	index := make(map[string]int, len(urls))
+	for i, u := range urls {
+		index[u] = i
+	}
+
+	byCanonical := make(map[string]int)
+	byHash := make(map[string]int)
+	for i, u := range urls {
+		fp := fingerprints[u]
+
+		if fp.canonical != "" {
+			if j, ok := byCanonical[fp.canonical]; ok {
+				union(j, i)
+			} else {
+				byCanonical[fp.canonical] = i
+			}
+			if j, ok := index[fp.canonical]; ok {
+				union(j, i)
+			}
+		}
+
+		if j, ok := byHash[fp.hash]; ok {
+			union(j, i)
+		} else {
+			byHash[fp.hash] = i
+		}
+	}
+
+	// The pages with the same SimHash are grouped first, so only the distinct hashes are compared
+	var hashes []uint64
+	var owners []int
+	bySimHash := make(map[uint64]int)
+	for i, u := range urls {
+		simHash := fingerprints[u].simHash
+		if j, ok := bySimHash[simHash]; ok {
+			union(j, i)
+			continue
+		}
+		bySimHash[simHash] = i
+		hashes, owners = append(hashes, simHash), append(owners, i)
+	}
+	nearDuplicates(hashes, maxDistance, func(a, b int) {
+		union(owners[a], owners[b])
+	})
+
+	groups := make(map[int][]string)
+	for i, u := range urls {
+		root := find(i)
+		groups[root] = append(groups[root], u)
+	}
+
+	var clusters []model.DuplicateCluster
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		clusters = append(clusters, newDuplicateCluster(group, fingerprints))
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i].Urls[0] < clusters[j].Urls[0]
+	})
+
+	return clusters
+}
+
+// nearDuplicates calls union for the pairs of hashes that differ in at most maxDistance bits. The hashes are split in
+// maxDistance+1 bands, so two hashes that close have at least one band in common, and only the hashes that share a band
+// are compared
+func nearDuplicates(hashes []uint64, maxDistance int, union func(i, j int)) {
+	if maxDistance >= 64 {
+		for i := 1; i < len(hashes); i++ {
+			union(0, i)
+		}
+		return
+	}
+
+	bands := maxDistance + 1
+	width := 64 / bands
+	for band := 0; band < bands; band++ {
+		shift := band * width
+		mask := uint64(1)<<width - 1
+		if band == bands-1 {
+			// The last band takes the bits left over
+			mask = ^uint64(0) >> shift
+		}
+
+		buckets := make(map[uint64][]int)
+		for i, hash := range hashes {
+			key := hash >> shift & mask
+			for _, j := range buckets[key] {
+				if bits.OnesCount64(hash^hashes[j]) <= maxDistance {
+					union(j, i)
+				}
+			}
+			buckets[key] = append(buckets[key], i)
+		}
+	}
+}
+
+// newDuplicateCluster describes a group of duplicate pages, with the canonical url they agree on if any
+func newDuplicateCluster(urls []string, fingerprints map[string]fingerprint) model.DuplicateCluster {
+	cluster := model.DuplicateCluster{Urls: urls, Exact: true}
+
+	agree := true
+	for _, u := range urls {
+		fp := fingerprints[u]
+		if fp.hash != fingerprints[urls[0]].hash {
+			cluster.Exact = false
+		}
+
+		switch {
+		case fp.canonical == "":
+		case cluster.Canonical == "":
+			cluster.Canonical = fp.canonical
+		case cluster.Canonical != fp.canonical:
+			agree = false
+		}
+	}
+
+	if !agree {
+		cluster.Canonical = ""
+	}
+
+	return cluster
+}
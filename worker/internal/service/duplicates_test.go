@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"math/bits"
+	"math/rand"
+	"net/http"
+	"strings"
+	"testing"
+	"worker/internal/model"
+	mock_service "worker/internal/service/mocks"
+)
+
+func TestSimHash(t *testing.T) {
+	text := "we are a software consultancy building digital products for clients all around the world with " +
+		"teams in europe and latin america working on web mobile and data projects"
+	similar := strings.Replace(text, "clients", "customers", 1)
+	different := "the quick brown fox jumps over the lazy dog while the cat watches from the window of the house"
+
+	assert.Equal(t, simHash(text), simHash(text))
+	assert.Less(t, bits.OnesCount64(simHash(text)^simHash(similar)), bits.OnesCount64(simHash(text)^simHash(different)))
+	assert.Greater(t, bits.OnesCount64(simHash(text)^simHash(different)), 3)
+}
+
+func TestFindDuplicates(t *testing.T) {
+	url := "https://parserdigital.com/"
+	fingerprints := map[string]fingerprint{
+		url + "a":          {hash: "1", simHash: 0b0000},
+		url + "a?utm=mail": {hash: "1", simHash: 0b0000},
+		url + "b":          {canonical: url + "b", hash: "2", simHash: 0xff00},
+		url + "b?page=1":   {canonical: url + "b", hash: "3", simHash: 0x00ff},
+		url + "c":          {hash: "4", simHash: 0xf0f0f0},
+		url + "c-copy":     {hash: "5", simHash: 0xf0f0f1},
+		url + "d":          {hash: "6", simHash: 0xffffffff},
+	}
+
+	assert.Equal(t, []model.DuplicateCluster{
+		{Exact: true, Urls: []string{url + "a", url + "a?utm=mail"}},
+		{Canonical: url + "b", Urls: []string{url + "b", url + "b?page=1"}},
+		{Urls: []string{url + "c", url + "c-copy"}},
+	}, findDuplicates(fingerprints, 3))
+}
+
+func TestNearDuplicates(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	hashes := make([]uint64, 200)
+	for i := range hashes {
+		if i%2 == 1 {
+			// Flip a few bits of the previous hash so there are pairs at every distance
+			hashes[i] = hashes[i-1] ^ 1<<random.Intn(64) ^ 1<<random.Intn(64) ^ 1<<random.Intn(64)
+			continue
+		}
+		hashes[i] = random.Uint64()
+	}
+
+	for _, maxDistance := range []int{0, 1, 2, 3, 5, 30, 64} {
+		expected := make(map[[2]int]bool)
+		for i := range hashes {
+			for j := 0; j < i; j++ {
+				if bits.OnesCount64(hashes[i]^hashes[j]) <= maxDistance {
+					expected[[2]int{j, i}] = true
+				}
+			}
+		}
+
+		found := make(map[[2]int]bool)
+		nearDuplicates(hashes, maxDistance, func(i, j int) {
+			found[[2]int{i, j}] = true
+		})
+
+		if maxDistance >= 64 {
+			assert.Len(t, found, len(hashes)-1)
+			continue
+		}
+		assert.Equal(t, expected, found, "distance %d", maxDistance)
+	}
+}
+
+func TestCrawlService_Crawl_Duplicates(t *testing.T) {
+	url := "https://parserdigital.com/"
+	mockHttp := mock_service.NewHttpMock(url)
+	mockHttp.RegisterResponders()
+	defer mockHttp.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", url+"robots.txt", httpmock.NewStringResponder(200, "User-agent: *"))
+	httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(http.StatusOK, `<html><body>
+		<a href="/career">Join us</a>
+		<a href="/career?utm_source=home">Join us</a>
+	</body></html>`))
+	for _, page := range []string{"career", "career?utm_source=home"} {
+		httpmock.RegisterResponder("GET", url+page, httpmock.NewStringResponder(http.StatusOK, `<html>
+	<head><link rel="canonical" href="/career"></head>
+	<body><h1>Join us</h1></body>
+</html>`))
+	}
+
+	sitemap := newTestCrawlerService().Crawl(context.Background(), &model.Request{Url: url}, nil)
+
+	assert.Equal(t, []model.DuplicateCluster{{
+		Canonical: url + "career",
+		Exact:     true,
+		Urls:      []string{url + "career", url + "career?utm_source=home"},
+	}}, sitemap.Duplicates)
+
+	info := sitemap.PageInfo[url+"career?utm_source=home"]
+	assert.Equal(t, url+"career", info.Canonical)
+	assert.Len(t, info.ContentHash, 64)
+	assert.Len(t, info.SimHash, 16)
+}
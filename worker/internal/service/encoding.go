@@ -0,0 +1,127 @@
+package service
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/lzw"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/dsnet/compress/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// decodedBody reads a response body through a stack of decoders. Closing it closes every decoder, from the outermost
+// one, and then the response body
+type decodedBody struct {
+	io.Reader
+	closers []io.Closer
+}
+
+// Close closes the decoders and the response body, returning the first error found
+func (b *decodedBody) Close() error {
+	var err error
+	for i := len(b.closers) - 1; i >= 0; i-- {
+		if closeErr := b.closers[i].Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+// contentEncodings returns the lowercase content codings of the response in the order they were applied. The header
+// can be repeated and hold comma-separated lists, and the identity coding is skipped
+func contentEncodings(header http.Header) []string {
+	var encodings []string
+	for _, value := range header.Values("Content-Encoding") {
+		for _, enc := range strings.Split(value, ",") {
+			enc = strings.ToLower(strings.TrimSpace(enc))
+			if enc != "" && enc != "identity" {
+				encodings = append(encodings, enc)
+			}
+		}
+	}
+
+	return encodings
+}
+
+// decompress undoes the content codings of the response body, starting from the last one applied. The returned body
+// closes every decoder and the response body. On error the decoders already opened are closed, but the response body
+// is left to the caller
+func decompress(res *http.Response) (io.ReadCloser, error) {
+	encodings := contentEncodings(res.Header)
+	if len(encodings) == 0 {
+		return res.Body, nil
+	}
+
+	body := &decodedBody{Reader: res.Body, closers: []io.Closer{res.Body}}
+	for i := len(encodings) - 1; i >= 0; i-- {
+		decoder, err := newDecoder(encodings[i], body.Reader)
+		if err != nil {
+			(&decodedBody{closers: body.closers[1:]}).Close()
+			return nil, err
+		}
+
+		body.Reader = decoder
+		body.closers = append(body.closers, decoder)
+	}
+
+	return body, nil
+}
+
+// newDecoder returns a reader decoding the content coding from r
+func newDecoder(encoding string, r io.Reader) (io.ReadCloser, error) {
+	var (
+		decoder io.ReadCloser
+		err     error
+	)
+
+	switch encoding {
+	case "br":
+		decoder, err = brotli.NewReader(r, nil)
+	case "gzip", "x-gzip":
+		decoder, err = gzip.NewReader(r)
+	case "deflate":
+		decoder, err = newDeflateReader(r)
+	case "compress", "x-compress":
+		decoder = lzw.NewReader(r, lzw.LSB, 8)
+	case "zstd":
+		var zr *zstd.Decoder
+		// A single goroutine is enough to decode a page, and avoids starting several for each of them
+		zr, err = zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err == nil {
+			decoder = zr.IOReadCloser()
+		}
+	default:
+		return nil, errors.New(fmt.Sprintf("unsupported content encoding %q", encoding))
+	}
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error decoding %s: %s", encoding, err))
+	}
+
+	return decoder, nil
+}
+
+// newDeflateReader reads a deflate coded body. The coding is defined as zlib wrapped data, but some servers send the
+// raw deflate stream, which is detected from the zlib header
+func newDeflateReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+
+	header, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if len(header) == 2 && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+
+	return flate.NewReader(br), nil
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"github.com/jarcoal/httpmock"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"testing"
+	"worker/internal/model"
+	mock_service "worker/internal/service/mocks"
+)
+
+// brotliPage is "<html><title>brotli</title></html>" encoded with brotli, which has no encoder available
+var brotliPage = []byte("\x1b!\x00\x00\xc4mlN\xc7\x11\xdf\xf0\t\x82\x105!\x8dL\x02\x8fL+\n%A\xd5\xf1\xed\x1b\x19,\xe2\x03")
+
+// encode applies the codings to data in the given order
+func encode(t *testing.T, data []byte, encodings ...string) []byte {
+	for _, enc := range encodings {
+		var buf bytes.Buffer
+		var w io.WriteCloser
+		switch enc {
+		case "gzip":
+			w = gzip.NewWriter(&buf)
+		case "zlib":
+			w = zlib.NewWriter(&buf)
+		case "flate":
+			w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+		case "zstd":
+			w, _ = zstd.NewWriter(&buf)
+		default:
+			t.Fatalf("unknown test encoding %s", enc)
+		}
+		w.Write(data)
+		w.Close()
+		data = buf.Bytes()
+	}
+
+	return data
+}
+
+// closeTracker records if the body was closed
+type closeTracker struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeTracker) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestContentEncodings(t *testing.T) {
+	header := http.Header{}
+	header.Add("Content-Encoding", "gzip, Identity,BR")
+	header.Add("Content-Encoding", " zstd ")
+
+	assert.Equal(t, []string{"gzip", "br", "zstd"}, contentEncodings(header))
+	assert.Nil(t, contentEncodings(http.Header{}))
+}
+
+func TestDecompress(t *testing.T) {
+	html := []byte("<html><title>stacked</title></html>")
+
+	tests := []struct {
+		name     string
+		encoding []string
+		body     []byte
+		want     string
+		err      string
+	}{
+		{"Plain", nil, html, string(html), ""},
+		{"Identity", []string{"identity"}, html, string(html), ""},
+		{"Gzip", []string{"gzip"}, encode(t, html, "gzip"), string(html), ""},
+		{"X-Gzip", []string{"x-gzip"}, encode(t, html, "gzip"), string(html), ""},
+		{"Deflate", []string{"deflate"}, encode(t, html, "zlib"), string(html), ""},
+		{"Raw Deflate", []string{"deflate"}, encode(t, html, "flate"), string(html), ""},
+		{"Zstd", []string{"zstd"}, encode(t, html, "zstd"), string(html), ""},
+		{"Brotli", []string{"br"}, brotliPage, "<html><title>brotli</title></html>", ""},
+		{"Stacked", []string{"gzip, zstd"}, encode(t, html, "gzip", "zstd"), string(html), ""},
+		{"Stacked Headers", []string{"br", "gzip"}, encode(t, brotliPage, "gzip"),
+			"<html><title>brotli</title></html>", ""},
+		{"Unknown", []string{"gzip, lzma"}, html, "", `unsupported content encoding "lzma"`},
+		{"Invalid", []string{"gzip"}, html, "", "error decoding gzip: gzip: invalid header"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := &closeTracker{Reader: bytes.NewReader(tt.body)}
+			res := &http.Response{Header: http.Header{}, Body: raw}
+			for _, enc := range tt.encoding {
+				res.Header.Add("Content-Encoding", enc)
+			}
+
+			body, err := decompress(res)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				assert.False(t, raw.closed)
+				return
+			}
+			assert.NoError(t, err)
+
+			got, err := io.ReadAll(body)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+
+			assert.NoError(t, body.Close())
+			assert.True(t, raw.closed)
+		})
+	}
+}
+
+func TestCrawlService_Crawl_Encoding(t *testing.T) {
+	url := "https://parserdigital.com/"
+
+	mockHttp := mock_service.NewHttpMock(url)
+	mockHttp.RegisterResponders()
+	defer mockHttp.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", url+"robots.txt", httpmock.NewStringResponder(200, "User-agent: *"))
+	httpmock.RegisterResponder("GET", url+"career", httpmock.NewBytesResponder(http.StatusOK,
+		encode(t, []byte(`<html><a href="/apply">Apply</a></html>`), "gzip", "zstd")).
+		HeaderSet(http.Header{"Content-Encoding": {"gzip", "zstd"}}))
+	httpmock.RegisterResponder("GET", url+"contact-us", httpmock.NewStringResponder(http.StatusOK, "compressed").
+		HeaderSet(http.Header{"Content-Encoding": {"lzma"}}))
+
+	sitemap := newTestCrawlerService().Crawl(context.Background(), &model.Request{Url: url}, nil)
+
+	assert.Equal(t, []string{url + "apply"}, sitemap.Pages[url+"career"])
+	assert.NotContains(t, sitemap.Pages, url+"contact-us")
+	assert.Equal(t, http.StatusOK, sitemap.PageInfo[url+"contact-us"].Status)
+	assert.Equal(t, []model.PageError{{
+		Url:   url + "contact-us",
+		Error: `error decompressing document: unsupported content encoding "lzma"`,
+	}}, sitemap.Errors)
+}
@@ -0,0 +1,292 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+	"worker/internal/model"
+)
+
+// Fetcher sends the HTTP requests of the crawler
+type Fetcher interface {
+	Get(ctx context.Context, url string) (*http.Response, error)
+	Head(ctx context.Context, url string) (*http.Response, error)
+	GetIfChanged(ctx context.Context, url, etag, lastModified string) (*http.Response, error)
+	WithOptions(opts *model.FetchOptions) (Fetcher, error)
+	UserAgent() string
+	Close()
+}
+
+// FetchConfig holds the settings of the HTTP client used by the fetcher
+type FetchConfig struct {
+	// UserAgent is the User-Agent header sent with every request
+	UserAgent string
+	// Headers are extra headers sent with every request
+	Headers map[string]string
+	// ConnectTimeout bounds the time to establish a connection
+	ConnectTimeout time.Duration
+	// ReadTimeout bounds the time waiting for the response headers once the request is sent
+	ReadTimeout time.Duration
+	// Timeout bounds the whole request, including redirects and reading the body
+	Timeout time.Duration
+	// Proxy is the url of the HTTP proxy the requests go through. The HTTP_PROXY and HTTPS_PROXY env vars are used
+	// when it is empty
+	Proxy string
+	// AllowedProxies are the proxies a crawl job can ask to go through instead of the worker one. Jobs cannot set a
+	// proxy when it is empty
+	AllowedProxies []string
+	// CAFile is a PEM bundle of certificate authorities trusted along with the system ones
+	CAFile string
+	// CertFile and KeyFile are the PEM client certificate and key presented to the servers that request them
+	CertFile string
+	KeyFile  string
+	// MaxRedirects is the number of redirects followed. Redirects are not followed when it is zero
+	MaxRedirects int
+}
+
+type httpFetcher struct {
+	config FetchConfig
+	client *http.Client
+	// cloned is the transport built for the options of a job, closed along with the fetcher
+	cloned *http.Transport
+}
+
+// NewFetcher builds a fetcher on an HTTP client configured with the settings
+func NewFetcher(config FetchConfig) (Fetcher, error) {
+	transport := &http.Transport{
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+
+	if err := configureTransport(transport, config); err != nil {
+		return nil, err
+	}
+
+	if err := configureTLS(transport, config); err != nil {
+		return nil, err
+	}
+
+	return newHTTPFetcher(config, transport), nil
+}
+
+// newHTTPFetcher builds a fetcher sending the requests through the transport. A nil transport uses the default one
+func newHTTPFetcher(config FetchConfig, transport http.RoundTripper) *httpFetcher {
+	return &httpFetcher{
+		config: config,
+		client: &http.Client{
+			Transport:     transport,
+			Timeout:       config.Timeout,
+			CheckRedirect: redirectPolicy(config.MaxRedirects),
+		},
+	}
+}
+
+// Get requests the url with the configured headers. The request is aborted when the context is cancelled
+func (f *httpFetcher) Get(ctx context.Context, url string) (*http.Response, error) {
+	return f.do(ctx, http.MethodGet, url, nil)
+}
+
+// Head requests the headers of the url, without its body
+func (f *httpFetcher) Head(ctx context.Context, url string) (*http.Response, error) {
+	return f.do(ctx, http.MethodHead, url, nil)
+}
+
+// GetIfChanged requests the url with the validators of a previous response, so the server answers with a 304 when
+// the page did not change. Empty validators are not sent
+func (f *httpFetcher) GetIfChanged(ctx context.Context, url, etag, lastModified string) (*http.Response, error) {
+	conditions := make(map[string]string)
+	if etag != "" {
+		conditions["If-None-Match"] = etag
+	}
+	if lastModified != "" {
+		conditions["If-Modified-Since"] = lastModified
+	}
+
+	return f.do(ctx, http.MethodGet, url, conditions)
+}
+
+// do sends a request with the configured headers and the given ones
+func (f *httpFetcher) do(ctx context.Context, method, url string, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range f.config.Headers {
+		req.Header.Set(key, value)
+	}
+	if f.config.UserAgent != "" {
+		req.Header.Set("User-Agent", f.config.UserAgent)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	return f.client.Do(req)
+}
+
+// WithOptions returns a fetcher for a crawl job, overriding the worker settings with the options of the request.
+// The TLS settings can only be configured per worker, and the proxy of a job must be one of the allowed proxies. The
+// fetcher must be closed when the job finishes
+func (f *httpFetcher) WithOptions(opts *model.FetchOptions) (Fetcher, error) {
+	if opts == nil {
+		return f, nil
+	}
+
+	config := f.config
+	if opts.UserAgent != "" {
+		config.UserAgent = opts.UserAgent
+	}
+	if len(opts.Headers) > 0 {
+		config.Headers = make(map[string]string, len(f.config.Headers)+len(opts.Headers))
+		for key, value := range f.config.Headers {
+			config.Headers[key] = value
+		}
+		for key, value := range opts.Headers {
+			config.Headers[key] = value
+		}
+	}
+	if opts.ConnectTimeout > 0 {
+		config.ConnectTimeout = time.Duration(opts.ConnectTimeout) * time.Second
+	}
+	if opts.ReadTimeout > 0 {
+		config.ReadTimeout = time.Duration(opts.ReadTimeout) * time.Second
+	}
+	if opts.Timeout > 0 {
+		config.Timeout = time.Duration(opts.Timeout) * time.Second
+	}
+	if opts.Proxy != "" {
+		if !allowedProxy(f.config.AllowedProxies, opts.Proxy) {
+			return nil, errors.New(fmt.Sprintf("proxy %s is not allowed", opts.Proxy))
+		}
+		config.Proxy = opts.Proxy
+	}
+	if opts.MaxRedirects != nil {
+		config.MaxRedirects = *opts.MaxRedirects
+	}
+
+	t, ok := f.client.Transport.(*http.Transport)
+	if !ok {
+		return newHTTPFetcher(config, f.client.Transport), nil
+	}
+
+	t = t.Clone()
+	if err := configureTransport(t, config); err != nil {
+		return nil, err
+	}
+
+	fetcher := newHTTPFetcher(config, t)
+	fetcher.cloned = t
+
+	return fetcher, nil
+}
+
+// UserAgent returns the User-Agent header sent with the requests
+func (f *httpFetcher) UserAgent() string {
+	return f.config.UserAgent
+}
+
+// Close closes the idle connections of the transport built for the options of a job. The connections of the worker
+// transport are kept for the next jobs
+func (f *httpFetcher) Close() {
+	if f.cloned != nil {
+		f.cloned.CloseIdleConnections()
+	}
+}
+
+// allowedProxy checks if the proxy is in the list of allowed proxies
+func allowedProxy(allowed []string, proxy string) bool {
+	for _, p := range allowed {
+		if p == proxy {
+			return true
+		}
+	}
+
+	return false
+}
+
+// configureTransport applies the connection settings to the transport
+func configureTransport(t *http.Transport, config FetchConfig) error {
+	dialer := &net.Dialer{
+		Timeout:   config.ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	t.DialContext = dialer.DialContext
+	t.ResponseHeaderTimeout = config.ReadTimeout
+
+	t.Proxy = http.ProxyFromEnvironment
+	if config.Proxy != "" {
+		proxyURL, err := url.Parse(config.Proxy)
+		if err != nil {
+			return errors.New(fmt.Sprintf("error parsing proxy url: %s", err))
+		}
+		t.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	return nil
+}
+
+// configureTLS loads the certificate authorities and the client certificate into the transport
+func configureTLS(t *http.Transport, config FetchConfig) error {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if config.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return errors.New(fmt.Sprintf("error reading ca bundle: %s", err))
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New(fmt.Sprintf("error reading ca bundle: no certificates found in %s", config.CAFile))
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.CertFile != "" || config.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return errors.New(fmt.Sprintf("error loading client certificate: %s", err))
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	t.TLSClientConfig = tlsConfig
+
+	return nil
+}
+
+// redirectPolicy follows up to maxRedirects redirects and stops at the first loop. When maxRedirects is zero the
+// redirect response is returned as it is
+func redirectPolicy(maxRedirects int) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if maxRedirects <= 0 {
+			return http.ErrUseLastResponse
+		}
+
+		if len(via) >= maxRedirects {
+			return errors.New(fmt.Sprintf("stopped after %d redirects", maxRedirects))
+		}
+
+		for _, prev := range via {
+			if prev.URL.String() == req.URL.String() {
+				return errors.New(fmt.Sprintf("redirect loop back to %s", req.URL))
+			}
+		}
+
+		return nil
+	}
+}
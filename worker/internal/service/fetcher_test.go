@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+	"worker/internal/model"
+)
+
+func TestHttpFetcher_Get(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/headers":
+			w.Header().Set("X-User-Agent", r.UserAgent())
+			w.Header().Set("X-Team", r.Header.Get("X-Team"))
+			w.Header().Set("X-Lang", r.Header.Get("Accept-Language"))
+		case "/redirect":
+			http.Redirect(w, r, "/headers", http.StatusMovedPermanently)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/chain":
+			n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+			http.Redirect(w, r, fmt.Sprintf("/chain?n=%d", n+1), http.StatusFound)
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		case "/conditional":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("X-Modified-Since", r.Header.Get("If-Modified-Since"))
+		}
+	}))
+	defer server.Close()
+
+	config := DefaultConfig().Fetch
+	config.Headers = map[string]string{"X-Team": "seo", "Accept-Language": "en"}
+
+	fetcher, err := NewFetcher(config)
+	assert.NoError(t, err)
+
+	t.Run("User Agent And Headers", func(t *testing.T) {
+		res, err := fetcher.Get(context.Background(), server.URL+"/headers")
+		assert.NoError(t, err)
+		res.Body.Close()
+
+		assert.Equal(t, "ParserCrawler/1.0", res.Header.Get("X-User-Agent"))
+		assert.Equal(t, "seo", res.Header.Get("X-Team"))
+		assert.Equal(t, "en", res.Header.Get("X-Lang"))
+	})
+
+	t.Run("Conditional Request", func(t *testing.T) {
+		res, err := fetcher.GetIfChanged(context.Background(), server.URL+"/conditional", `"v1"`, "")
+		assert.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, http.StatusNotModified, res.StatusCode)
+
+		lastModified := "Wed, 01 Nov 2023 10:00:00 GMT"
+		res, err = fetcher.GetIfChanged(context.Background(), server.URL+"/conditional", `"v2"`, lastModified)
+		assert.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, lastModified, res.Header.Get("X-Modified-Since"))
+	})
+
+	t.Run("Job Options", func(t *testing.T) {
+		jobFetcher, err := fetcher.WithOptions(&model.FetchOptions{
+			UserAgent: "ParserCrawler/2.0",
+			Headers:   map[string]string{"X-Team": "marketing"},
+		})
+		assert.NoError(t, err)
+
+		res, err := jobFetcher.Get(context.Background(), server.URL+"/headers")
+		assert.NoError(t, err)
+		res.Body.Close()
+
+		assert.Equal(t, "ParserCrawler/2.0", res.Header.Get("X-User-Agent"))
+		assert.Equal(t, "marketing", res.Header.Get("X-Team"))
+		assert.Equal(t, "en", res.Header.Get("X-Lang"))
+	})
+
+	t.Run("Job Proxy", func(t *testing.T) {
+		_, err := fetcher.WithOptions(&model.FetchOptions{Proxy: "http://proxy:3128"})
+		assert.ErrorContains(t, err, "proxy http://proxy:3128 is not allowed")
+
+		config := DefaultConfig().Fetch
+		config.AllowedProxies = []string{"http://proxy:3128"}
+		allowing, err := NewFetcher(config)
+		assert.NoError(t, err)
+
+		jobFetcher, err := allowing.WithOptions(&model.FetchOptions{Proxy: "http://proxy:3128"})
+		assert.NoError(t, err)
+		defer jobFetcher.Close()
+
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		proxy, err := jobFetcher.(*httpFetcher).cloned.Proxy(req)
+		assert.NoError(t, err)
+		assert.Equal(t, "http://proxy:3128", proxy.String())
+	})
+
+	t.Run("Redirects", func(t *testing.T) {
+		res, err := fetcher.Get(context.Background(), server.URL+"/redirect")
+		assert.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+
+		_, err = fetcher.Get(context.Background(), server.URL+"/loop")
+		assert.ErrorContains(t, err, "redirect loop back to "+server.URL+"/loop")
+
+		res, err = fetcher.Get(context.Background(), server.URL+"/chain")
+		assert.ErrorContains(t, err, "stopped after 10 redirects")
+		assert.Equal(t, http.StatusFound, res.StatusCode)
+		assert.Len(t, redirectChain(res), 10)
+
+		noRedirects := 0
+		jobFetcher, err := fetcher.WithOptions(&model.FetchOptions{MaxRedirects: &noRedirects})
+		assert.NoError(t, err)
+
+		res, err = jobFetcher.Get(context.Background(), server.URL+"/redirect")
+		assert.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, http.StatusMovedPermanently, res.StatusCode)
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		config := DefaultConfig().Fetch
+		config.Timeout = 50 * time.Millisecond
+
+		fetcher, err := NewFetcher(config)
+		assert.NoError(t, err)
+
+		_, err = fetcher.Get(context.Background(), server.URL+"/slow")
+		assert.Error(t, err)
+	})
+}
+
+func TestNewFetcher_CAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	untrusted, err := NewFetcher(DefaultConfig().Fetch)
+	assert.NoError(t, err)
+	_, err = untrusted.Get(context.Background(), server.URL)
+	assert.Error(t, err)
+
+	config := DefaultConfig().Fetch
+	config.CAFile = caFile
+
+	trusted, err := NewFetcher(config)
+	assert.NoError(t, err)
+	res, err := trusted.Get(context.Background(), server.URL)
+	assert.NoError(t, err)
+	res.Body.Close()
+}
+
+func TestNewFetcher_InvalidConfig(t *testing.T) {
+	config := DefaultConfig().Fetch
+	config.CAFile = filepath.Join(t.TempDir(), "missing.pem")
+	_, err := NewFetcher(config)
+	assert.Error(t, err)
+
+	config = DefaultConfig().Fetch
+	config.Proxy = "://proxy"
+	_, err = NewFetcher(config)
+	assert.Error(t, err)
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"sort"
+	"sync"
+)
+
+// crawlTask is a page waiting in the frontier to be crawled
+type crawlTask struct {
+	url   string
+	depth int
+}
+
+// frontier is the FIFO queue of pages waiting to be crawled. It counts the tasks that are queued or being processed,
+// so the workers know the crawl is over once the queue is empty and no worker can push new tasks. The tasks being
+// processed are kept to checkpoint them along with the queued ones
+type frontier struct {
+	queue   []crawlTask
+	active  map[string]crawlTask
+	pending int
+	closed  bool
+	mu      sync.Mutex
+	cond    *sync.Cond
+}
+
+// newFrontier builds an empty frontier
+func newFrontier() *frontier {
+	f := &frontier{active: make(map[string]crawlTask)}
+	f.cond = sync.NewCond(&f.mu)
+
+	return f
+}
+
+// push adds a task to the end of the queue
+func (f *frontier) push(task crawlTask) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return
+	}
+
+	f.queue = append(f.queue, task)
+	f.pending++
+	f.cond.Signal()
+}
+
+// pop takes the next task from the queue, waiting while other workers may still push new ones.
+// It returns false when the crawl is over
+func (f *frontier) pop() (crawlTask, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for len(f.queue) == 0 && f.pending > 0 && !f.closed {
+		f.cond.Wait()
+	}
+
+	if len(f.queue) == 0 || f.closed {
+		return crawlTask{}, false
+	}
+
+	task := f.queue[0]
+	f.queue = f.queue[1:]
+	f.active[task.url] = task
+
+	return task, true
+}
+
+// done marks a popped task as processed
+func (f *frontier) done(task crawlTask) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.active, task.url)
+	f.pending--
+	if f.pending == 0 {
+		f.cond.Broadcast()
+	}
+}
+
+// close stops the frontier, discarding the queued tasks and releasing the waiting workers
+func (f *frontier) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.closed = true
+	f.pending -= len(f.queue)
+	f.queue = nil
+	f.cond.Broadcast()
+}
+
+// tasks returns the tasks being processed followed by the queued ones, which are the pages a resumed crawl has to
+// visit
+func (f *frontier) tasks() []crawlTask {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	tasks := make([]crawlTask, 0, len(f.active)+len(f.queue))
+	for _, task := range f.active {
+		tasks = append(tasks, task)
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].url < tasks[j].url
+	})
+
+	return append(tasks, f.queue...)
+}
+
+// hostLimiter bounds the number of simultaneous connections to each host, shared by all the crawl jobs
+type hostLimiter struct {
+	limit int
+	slots map[string]chan struct{}
+	mu    sync.Mutex
+}
+
+// newHostLimiter builds a limiter allowing up to limit connections per host
+func newHostLimiter(limit int) *hostLimiter {
+	return &hostLimiter{
+		limit: limit,
+		slots: make(map[string]chan struct{}),
+	}
+}
+
+// acquire waits for a free connection slot for the host and returns the function to release it
+func (l *hostLimiter) acquire(host string) func() {
+	l.mu.Lock()
+	slot, ok := l.slots[host]
+	if !ok {
+		slot = make(chan struct{}, l.limit)
+		l.slots[host] = slot
+	}
+	l.mu.Unlock()
+
+	slot <- struct{}{}
+
+	return func() {
+		<-slot
+	}
+}
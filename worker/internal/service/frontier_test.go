@@ -0,0 +1,74 @@
+package service
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFrontier_DrainsWhenNoPendingTasks(t *testing.T) {
+	f := newFrontier()
+	f.push(crawlTask{url: "https://parserdigital.com/"})
+
+	var (
+		mu      sync.Mutex
+		visited []string
+		wg      sync.WaitGroup
+	)
+
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				task, ok := f.pop()
+				if !ok {
+					return
+				}
+
+				mu.Lock()
+				visited = append(visited, task.url)
+				mu.Unlock()
+
+				// The seed discovers two pages, which are pushed before the seed is done
+				if task.url == "https://parserdigital.com/" {
+					f.push(crawlTask{url: "https://parserdigital.com/career"})
+					f.push(crawlTask{url: "https://parserdigital.com/contact-us"})
+				}
+				f.done(task)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.ElementsMatch(t, []string{
+		"https://parserdigital.com/",
+		"https://parserdigital.com/career",
+		"https://parserdigital.com/contact-us",
+	}, visited)
+}
+
+func TestHostLimiter_Acquire(t *testing.T) {
+	limiter := newHostLimiter(1)
+
+	release := limiter.acquire("parserdigital.com")
+
+	acquired := make(chan struct{})
+	go func() {
+		limiter.acquire("parserdigital.com")()
+		close(acquired)
+	}()
+
+	// Other hosts are not affected by the limit
+	limiter.acquire("example.com")()
+
+	select {
+	case <-acquired:
+		t.Fatal("expected the second connection to wait for the first one to be released")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release()
+	<-acquired
+}
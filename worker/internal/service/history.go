@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+	"worker/internal/model"
+	"worker/internal/repo"
+)
+
+// history is the last crawl of a site, kept to send conditional requests in the next one and to report what changed
+type history struct {
+	CrawledAt time.Time              `json:"crawledAt"`
+	Pages     map[string]historyPage `json:"pages"`
+}
+
+// historyPage is a page of the last crawl with its metadata, including its validators, and the links found in it to
+// reuse them when the page did not change
+type historyPage struct {
+	Found []model.Link   `json:"found,omitempty"`
+	Info  model.PageInfo `json:"info"`
+}
+
+// page returns the page of the last crawl when it can be requested conditionally, which needs its ETag or its
+// Last-Modified. It can be called on a nil history
+func (h *history) page(link string) (historyPage, bool) {
+	if h == nil {
+		return historyPage{}, false
+	}
+
+	p, ok := h.Pages[link]
+	if !ok || (p.Info.ETag == "" && p.Info.LastModified == "") {
+		return historyPage{}, false
+	}
+
+	return p, true
+}
+
+// newHistory builds the history of a crawl from its sitemap. Only the HTML pages crawled successfully are kept, and a
+// partial crawl also keeps the pages of the previous one it did not reach
+func newHistory(sitemap *model.Sitemap, previous *history, partial bool) *history {
+	h := &history{
+		CrawledAt: time.Now().UTC(),
+		Pages:     make(map[string]historyPage),
+	}
+
+	for link := range sitemap.Pages {
+		info, ok := sitemap.PageInfo[link]
+		if _, resource := sitemap.Resources[link]; !ok || resource || !isSuccess(info.Status) || len(info.Redirects) > 0 {
+			continue
+		}
+
+		info.NotModified = false
+		h.Pages[link] = historyPage{Found: sitemap.Links[link], Info: info}
+	}
+
+	if previous != nil && partial {
+		for link, p := range previous.Pages {
+			if _, ok := sitemap.PageInfo[link]; !ok {
+				h.Pages[link] = p
+			}
+		}
+	}
+
+	return h
+}
+
+// compare reports the pages of the sitemap that changed, were unchanged and were added since the previous crawl, and
+// the ones that disappeared. A page is unchanged when the server answered with a 304 or its content hash is the same.
+// When the crawl is partial, only the pages answered with an error status are reported as disappeared, since the rest
+// may not have been reached
+func (h *history) compare(sitemap *model.Sitemap, partial bool) *model.Changes {
+	changes := &model.Changes{
+		Since:       h.CrawledAt.Format(time.RFC3339),
+		Changed:     []string{},
+		Unchanged:   []string{},
+		Added:       []string{},
+		Disappeared: []string{},
+	}
+
+	for link, prev := range h.Pages {
+		info, ok := sitemap.PageInfo[link]
+		_, crawled := sitemap.Pages[link]
+
+		switch {
+		case ok && crawled && isSuccess(info.Status):
+			if info.NotModified || (info.ContentHash != "" && info.ContentHash == prev.Info.ContentHash) {
+				changes.Unchanged = append(changes.Unchanged, link)
+			} else {
+				changes.Changed = append(changes.Changed, link)
+			}
+		case !partial || (ok && info.Status >= http.StatusBadRequest):
+			changes.Disappeared = append(changes.Disappeared, link)
+		}
+	}
+
+	for link := range sitemap.Pages {
+		info, ok := sitemap.PageInfo[link]
+		_, resource := sitemap.Resources[link]
+		if _, known := h.Pages[link]; !known && ok && !resource && isSuccess(info.Status) && len(info.Redirects) == 0 {
+			changes.Added = append(changes.Added, link)
+		}
+	}
+
+	sort.Strings(changes.Changed)
+	sort.Strings(changes.Unchanged)
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Disappeared)
+
+	return changes
+}
+
+// isSuccess checks if the status is a 2xx
+func isSuccess(status int) bool {
+	return status >= http.StatusOK && status < http.StatusMultipleChoices
+}
+
+// cacheKey returns the key of the history of the request, which is the key of its sitemap in the cache of the server.
+// The crawls with options that change the result are kept apart from the default crawl of the url, under a hash of
+// those options
+func cacheKey(req *model.Request) string {
+	options := struct {
+		Limits     *model.Limits           `json:"limits,omitempty"`
+		Canonical  *model.CanonicalRules   `json:"canonical,omitempty"`
+		Scope      *model.ScopeRules       `json:"scope,omitempty"`
+		Fetch      *model.FetchOptions     `json:"fetch,omitempty"`
+		Retry      *model.RetryOptions     `json:"retry,omitempty"`
+		Follow     *model.FollowRules      `json:"follow,omitempty"`
+		Directives *model.DirectivesPolicy `json:"directives,omitempty"`
+	}{req.Limits, req.Canonical, req.Scope, req.Fetch, req.Retry, req.Follow, req.Directives}
+
+	data, err := json.Marshal(options)
+	if err != nil || string(data) == "{}" {
+		return req.Url
+	}
+
+	hash := sha256.Sum256(data)
+	return req.Url + "#" + hex.EncodeToString(hash[:])
+}
+
+// loadHistory gets the last crawl of the site with the same options, or nil when there is none or there is no history
+// repository
+func (s *crawlService) loadHistory(ctx context.Context, site string) *history {
+	if s.history == nil {
+		return nil
+	}
+
+	data, err := s.history.Load(ctx, site)
+	if err != nil {
+		if err.Error() != repo.KeyNotFound {
+			log.Printf("error loading the history of %s: %s", site, err)
+		}
+		return nil
+	}
+
+	h := &history{}
+	if err := json.Unmarshal(data, h); err != nil {
+		log.Printf("error unmarshaling the history of %s: %s", site, err)
+		return nil
+	}
+
+	return h
+}
+
+// saveHistory stores the crawl as the last one of the site. Failed and cancelled crawls are not stored, so the next
+// crawl is still compared with the last complete one
+func (s *crawlService) saveHistory(sess *crawlSession, site string) {
+	if s.history == nil || sess.sitemap.Outcome == model.OutcomeFailed || sess.sitemap.Outcome == model.OutcomeCancelled {
+		return
+	}
+
+	data, err := json.Marshal(newHistory(sess.sitemap, sess.previous, sess.sitemap.Truncated))
+	if err != nil {
+		log.Printf("error marshaling the history of %s: %s", site, err)
+		return
+	}
+
+	if err := s.history.Save(context.Background(), site, data); err != nil {
+		log.Printf("error saving the history of %s: %s", site, err)
+	}
+}
+
+// reusePage records a page that did not change since the last crawl with the links and metadata found then, and
+// pushes its links to the frontier
+func (s *crawlService) reusePage(sess *crawlSession, task crawlTask, p *page) {
+	prev, _ := sess.previous.page(task.url)
+
+	info := prev.Info
+	info.Depth, info.ResponseTime, info.NotModified = task.depth, p.elapsed.Milliseconds(), true
+	// The server can send new validators along with the 304
+	if etag := p.res.Header.Get("ETag"); etag != "" {
+		info.ETag = etag
+	}
+	if lastModified := p.res.Header.Get("Last-Modified"); lastModified != "" {
+		info.LastModified = lastModified
+	}
+
+	if info.ContentHash != "" {
+		simHash, _ := strconv.ParseUint(info.SimHash, 16, 64)
+		sess.addFingerprint(task.url, fingerprint{canonical: info.Canonical, hash: info.ContentHash, simHash: simHash})
+	}
+
+	var links []string
+	if info.Nofollow && !sess.directives.IgnoreMetaRobots {
+		log.Printf("skipping the links of %s, nofollow page", task.url)
+	} else {
+		links = s.followLinks(sess, prev.Found)
+	}
+	sess.addPage(task.url, links, prev.Found, info)
+
+	log.Printf("%s not modified, reusing its links: %v", task.url, links)
+
+	for _, link := range links {
+		sess.enqueue(link, task.depth+1)
+	}
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang/mock/gomock"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+	"worker/internal/model"
+	"worker/internal/repo"
+	mock_repo "worker/internal/repo/mocks"
+	mock_service "worker/internal/service/mocks"
+)
+
+func TestHistory_Compare(t *testing.T) {
+	url := "https://parserdigital.com/"
+	crawledAt := time.Date(2023, 11, 1, 10, 0, 0, 0, time.UTC)
+
+	previous := &history{
+		CrawledAt: crawledAt,
+		Pages: map[string]historyPage{
+			url:                {Info: model.PageInfo{Status: http.StatusOK, ContentHash: "home"}},
+			url + "career":     {Info: model.PageInfo{Status: http.StatusOK, ContentHash: "career"}},
+			url + "contact-us": {Info: model.PageInfo{Status: http.StatusOK, ContentHash: "contact"}},
+			url + "people":     {Info: model.PageInfo{Status: http.StatusOK, ContentHash: "people"}},
+			url + "form":       {Info: model.PageInfo{Status: http.StatusOK, ContentHash: "form"}},
+		},
+	}
+
+	sitemap := &model.Sitemap{
+		Pages: map[string][]string{
+			url:                {url + "career"},
+			url + "career":     nil,
+			url + "contact-us": nil,
+			url + "apply":      nil,
+			url + "form":       nil,
+		},
+		PageInfo: map[string]model.PageInfo{
+			url:                {Status: http.StatusOK, NotModified: true},
+			url + "career":     {Status: http.StatusOK, ContentHash: "career"},
+			url + "contact-us": {Status: http.StatusOK, ContentHash: "new contact"},
+			url + "apply":      {Status: http.StatusOK, ContentHash: "apply"},
+			url + "form":       {Status: http.StatusNotFound},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		partial  bool
+		expected *model.Changes
+	}{
+		{
+			name:    "Complete Crawl",
+			partial: false,
+			expected: &model.Changes{
+				Since:       "2023-11-01T10:00:00Z",
+				Changed:     []string{url + "contact-us"},
+				Unchanged:   []string{url, url + "career"},
+				Added:       []string{url + "apply"},
+				Disappeared: []string{url + "form", url + "people"},
+			},
+		},
+		{
+			name:    "Partial Crawl",
+			partial: true,
+			expected: &model.Changes{
+				Since:       "2023-11-01T10:00:00Z",
+				Changed:     []string{url + "contact-us"},
+				Unchanged:   []string{url, url + "career"},
+				Added:       []string{url + "apply"},
+				Disappeared: []string{url + "form"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, previous.compare(sitemap, test.partial))
+		})
+	}
+}
+
+func TestNewHistory(t *testing.T) {
+	url := "https://parserdigital.com/"
+	found := []model.Link{{Url: url + "career", Element: "a", Kind: model.LinkNavigation}}
+
+	sitemap := &model.Sitemap{
+		Pages: map[string][]string{
+			url:             {url + "career"},
+			url + "career":  {url + "jobs"},
+			url + "jobs":    nil,
+			url + "doc.pdf": nil,
+		},
+		PageInfo: map[string]model.PageInfo{
+			url:             {Status: http.StatusOK, ETag: `"v1"`, NotModified: true},
+			url + "career":  {Status: http.StatusMovedPermanently, Redirects: []model.RedirectHop{{Status: 301}}},
+			url + "jobs":    {Status: http.StatusOK, LastModified: "Wed, 01 Nov 2023 10:00:00 GMT"},
+			url + "doc.pdf": {Status: http.StatusOK, ContentType: "application/pdf"},
+		},
+		Links:     map[string][]model.Link{url: found},
+		Resources: map[string]string{url + "doc.pdf": "application/pdf"},
+	}
+	previous := &history{Pages: map[string]historyPage{
+		url + "people": {Info: model.PageInfo{Status: http.StatusOK}},
+		url + "jobs":   {Info: model.PageInfo{Status: http.StatusOK}},
+	}}
+
+	t.Run("Complete Crawl", func(t *testing.T) {
+		h := newHistory(sitemap, previous, false)
+
+		assert.Equal(t, map[string]historyPage{
+			url:          {Found: found, Info: model.PageInfo{Status: http.StatusOK, ETag: `"v1"`}},
+			url + "jobs": {Info: model.PageInfo{Status: http.StatusOK, LastModified: "Wed, 01 Nov 2023 10:00:00 GMT"}},
+		}, h.Pages)
+	})
+
+	t.Run("Partial Crawl Keeps The Pages Not Reached", func(t *testing.T) {
+		h := newHistory(sitemap, previous, true)
+
+		assert.Len(t, h.Pages, 3)
+		assert.Contains(t, h.Pages, url+"people")
+		assert.Equal(t, "Wed, 01 Nov 2023 10:00:00 GMT", h.Pages[url+"jobs"].Info.LastModified)
+	})
+}
+
+func TestCacheKey(t *testing.T) {
+	url := "https://parserdigital.com/"
+
+	assert.Equal(t, url, cacheKey(&model.Request{Url: url, Recrawl: true, Distributed: true}))
+
+	scoped := cacheKey(&model.Request{Url: url, Scope: &model.ScopeRules{Mode: model.ScopeDomain}})
+	limited := cacheKey(&model.Request{Url: url, Limits: &model.Limits{MaxDepth: 2}})
+	assert.Contains(t, scoped, url+"#")
+	assert.Contains(t, limited, url+"#")
+	assert.NotEqual(t, scoped, limited)
+}
+
+func TestCrawlService_Crawl_Recrawl(t *testing.T) {
+	url := "https://parserdigital.com/"
+
+	mockHttp := mock_service.NewHttpMock(url)
+	mockHttp.RegisterResponders()
+	defer mockHttp.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", url+"robots.txt", httpmock.NewStringResponder(200, "User-agent: *"))
+
+	// The seed is validated with its ETag and how-we-work with its Last-Modified
+	lastModified := "Wed, 01 Nov 2023 10:00:00 GMT"
+	var conditional []string
+	httpmock.RegisterResponder("GET", url, func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("If-None-Match") == `"v1"` {
+			conditional = append(conditional, req.URL.String())
+			return httpmock.NewStringResponse(http.StatusNotModified, ""), nil
+		}
+		res := httpmock.NewStringResponse(http.StatusOK, fmt.Sprintf(`<html><body><a href="%show-we-work">learn more</a>
+<a href="%scareer">Join us</a><a href="%scontact-us">Contact us</a></body></html>`, url, url, url))
+		res.Header.Set("ETag", `"v1"`)
+		return res, nil
+	})
+	httpmock.RegisterResponder("GET", url+"how-we-work", func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("If-Modified-Since") == lastModified {
+			conditional = append(conditional, req.URL.String())
+			return httpmock.NewStringResponse(http.StatusNotModified, ""), nil
+		}
+		res := httpmock.NewStringResponse(http.StatusOK, fmt.Sprintf(`<html><body><a href="%scases">Cases</a>
+<a href="%speople">People</a></body></html>`, url, url))
+		res.Header.Set("Last-Modified", lastModified)
+		return res, nil
+	})
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	histories := mock_repo.NewMockHistoryRepo(ctrl)
+	var saved []byte
+	histories.EXPECT().Save(gomock.Any(), url, gomock.Any()).DoAndReturn(func(ctx context.Context, site string, data []byte) error {
+		saved = data
+		return nil
+	}).Times(2)
+
+	config := DefaultConfig()
+	service := NewCrawlerService(config, newHTTPFetcher(config.Fetch, nil), nil, histories, nil)
+
+	// The first crawl is not a recrawl, so it is stored without comparing it with anything
+	sitemap := service.Crawl(context.Background(), &model.Request{Url: url}, nil)
+
+	assert.Len(t, sitemap.Pages, 10)
+	assert.Nil(t, sitemap.Changes)
+	assert.Equal(t, `"v1"`, sitemap.PageInfo[url].ETag)
+	assert.Empty(t, conditional)
+
+	// A recrawl with other options has its own history
+	limited := &model.Request{Url: url, Recrawl: true, Limits: &model.Limits{MaxPages: 2}}
+	histories.EXPECT().Load(gomock.Any(), cacheKey(limited)).Return(nil, errors.New(repo.KeyNotFound))
+	histories.EXPECT().Save(gomock.Any(), cacheKey(limited), gomock.Any()).Return(nil)
+	sitemap = service.Crawl(context.Background(), limited, nil)
+
+	assert.Len(t, sitemap.Pages, 2)
+	assert.Nil(t, sitemap.Changes)
+	assert.Empty(t, conditional)
+
+	// The career page changed, the form is gone and the contact page links to a new page
+	httpmock.RegisterResponder("GET", url+"career", httpmock.NewStringResponder(http.StatusOK, "<html>We are hiring</html>"))
+	httpmock.RegisterResponder("GET", url+"form", httpmock.NewStringResponder(http.StatusNotFound, "<html>Not found</html>"))
+	httpmock.RegisterResponder("GET", url+"contact-us", httpmock.NewStringResponder(http.StatusOK,
+		fmt.Sprintf(`<html><body><a href="%saddress">Address</a><a href="%sform">Form</a>
+<a href="%schat">Chat</a></body></html>`, url, url, url)))
+	httpmock.RegisterResponder("GET", url+"chat", httpmock.NewStringResponder(http.StatusOK, "<html>Chat with us</html>"))
+
+	histories.EXPECT().Load(gomock.Any(), url).Return(saved, nil)
+	sitemap = service.Crawl(context.Background(), &model.Request{Url: url, Recrawl: true}, nil)
+
+	assert.ElementsMatch(t, []string{url, url + "how-we-work"}, conditional)
+	assert.True(t, sitemap.PageInfo[url].NotModified)
+	assert.Equal(t, []string{url + "how-we-work", url + "career", url + "contact-us"}, sitemap.Pages[url])
+	assert.Equal(t, []string{url + "cases", url + "people"}, sitemap.Pages[url+"how-we-work"])
+
+	changes := sitemap.Changes
+	assert.NotNil(t, changes)
+	assert.Equal(t, []string{url + "career", url + "contact-us"}, changes.Changed)
+	assert.Equal(t, []string{url, url + "address", url + "cases", url + "how-we-work", url + "people"}, changes.Unchanged)
+	assert.Equal(t, []string{url + "chat"}, changes.Added)
+	assert.Equal(t, []string{url + "apply", url + "form", url + "visit"}, changes.Disappeared)
+}
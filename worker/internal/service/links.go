@@ -0,0 +1,195 @@
+package service
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"worker/internal/model"
+)
+
+// linkElements are the elements the links of a page are extracted from
+var linkElements = map[string]bool{
+	"a":      true,
+	"area":   true,
+	"iframe": true,
+	"frame":  true,
+	"link":   true,
+	"form":   true,
+	"img":    true,
+	"script": true,
+	"source": true,
+	"video":  true,
+	"audio":  true,
+}
+
+// linkRelKinds classifies the <link> elements by their rel attribute. Other relations are not links to follow or assets
+var linkRelKinds = map[string]string{
+	"alternate":  model.LinkAlternate,
+	"next":       model.LinkNavigation,
+	"prev":       model.LinkNavigation,
+	"stylesheet": model.LinkAsset,
+	"icon":       model.LinkAsset,
+}
+
+// locationElement is the element of the link to the target of a redirect that is not followed, which comes from the
+// Location header rather than from the document
+const locationElement = "location"
+
+// rawLink is a url found in an element before it is resolved
+type rawLink struct {
+	href     string
+	element  string
+	kind     string
+	nofollow bool
+}
+
+// elementLinks returns the urls referenced by an element along with their kind
+func elementLinks(name string, attrs map[string]string) []rawLink {
+	attr := func(key string) []rawLink {
+		if value, ok := attrs[key]; ok && strings.TrimSpace(value) != "" {
+			return []rawLink{{href: value, element: name, kind: elementKind(name)}}
+		}
+		return nil
+	}
+
+	switch name {
+	case "a", "area":
+		links := attr("href")
+		if len(links) > 0 {
+			links[0].nofollow = hasRel(attrs["rel"], "nofollow")
+		}
+		return links
+	case "iframe", "frame", "script", "video", "audio":
+		return attr("src")
+	case "form":
+		return attr("action")
+	case "img", "source":
+		links := attr("src")
+		if srcset, ok := attrs["srcset"]; ok {
+			for _, href := range parseSrcset(srcset) {
+				links = append(links, rawLink{href: href, element: name, kind: model.LinkAsset})
+			}
+		}
+		return links
+	case "link":
+		href, ok := attrs["href"]
+		if !ok {
+			return nil
+		}
+		for _, r := range strings.Fields(strings.ToLower(attrs["rel"])) {
+			if kind, ok := linkRelKinds[r]; ok {
+				return []rawLink{{href: href, element: name, kind: kind, nofollow: hasRel(attrs["rel"], "nofollow")}}
+			}
+		}
+	}
+
+	return nil
+}
+
+// hasRel checks if the space separated rel attribute of an element has the relation, such as "nofollow"
+func hasRel(rel, relation string) bool {
+	for _, r := range strings.Fields(strings.ToLower(rel)) {
+		if r == relation {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getBase returns the url relative links are resolved against, which is the <base href> of the document when it has
+// one or the url of the response otherwise
+func getBase(doc *document, res *http.Response, urlStr string) *url.URL {
+	base, _ := url.Parse(urlStr)
+	if res.Request != nil {
+		base = res.Request.URL
+	}
+	if doc.base != "" {
+		if baseURL, err := base.Parse(strings.TrimSpace(doc.base)); err == nil {
+			return baseURL
+		}
+	}
+
+	return base
+}
+
+// elementKind returns the kind of the links found in the src, href or action of an element other than <link>
+func elementKind(name string) string {
+	switch name {
+	case "a", "area", "iframe", "frame":
+		return model.LinkNavigation
+	case "form":
+		return model.LinkForm
+	}
+
+	return model.LinkAsset
+}
+
+// parseSrcset returns the urls of the image candidates in a srcset attribute, such as "a.png 1x, b.png 2x"
+func parseSrcset(srcset string) []string {
+	var urls []string
+	for _, candidate := range strings.Split(srcset, ",") {
+		if fields := strings.Fields(candidate); len(fields) > 0 {
+			urls = append(urls, fields[0])
+		}
+	}
+
+	return urls
+}
+
+// getLinks returns the canonical form of the links in scope found in a document, classified by element and kind, up
+// to the configured maximum. Relative links are resolved against the base url of the document
+func (s *crawlService) getLinks(sess *crawlSession, doc *document, res *http.Response, urlStr string) []model.Link {
+	var links []model.Link
+	found := make(map[model.Link]bool)
+	base := getBase(doc, res, urlStr)
+
+	for _, raw := range doc.links {
+		if s.config.MaxLinksPerPage > 0 && len(links) >= s.config.MaxLinksPerPage {
+			log.Printf("too many links in %s, keeping the first %d", urlStr, s.config.MaxLinksPerPage)
+			break
+		}
+
+		linkURL, err := url.Parse(strings.TrimSpace(raw.href))
+		if err != nil {
+			log.Printf("error resolving relative url to absolute url: %s", err)
+			continue
+		}
+
+		absoluteURL := sess.canonical.canonicalize(base.ResolveReference(linkURL))
+		link := model.Link{Url: absoluteURL.String(), Element: raw.element, Kind: raw.kind, Nofollow: raw.nofollow}
+
+		// Ensure the link belongs to the crawl scope
+		if !sess.scope.InScope(absoluteURL) || link.Url == urlStr || found[link] {
+			continue
+		}
+
+		found[link] = true
+		links = append(links, link)
+	}
+
+	return links
+}
+
+// getLocationLink returns the target of the redirect as a navigation link when the response is a redirect that was not
+// followed, so its target is still discovered. It returns nil for any other response or a target out of scope
+func (s *crawlService) getLocationLink(sess *crawlSession, res *http.Response, urlStr string) []model.Link {
+	hop, ok := redirectHop(res)
+	if !ok {
+		return nil
+	}
+
+	target, err := url.Parse(hop.Location)
+	if err != nil {
+		log.Printf("error parsing the redirect location %s: %s", hop.Location, err)
+		return nil
+	}
+
+	link := model.Link{Url: sess.canonical.canonicalize(target).String(), Element: locationElement, Kind: model.LinkNavigation}
+	if !sess.scope.InScope(target) || link.Url == urlStr {
+		return nil
+	}
+
+	return []model.Link{link}
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"worker/internal/model"
+	mock_service "worker/internal/service/mocks"
+)
+
+func TestParseSrcset(t *testing.T) {
+	assert.Equal(t, []string{"small.png", "large.png"}, parseSrcset("small.png 1x, large.png 2x"))
+	assert.Equal(t, []string{"photo.jpg"}, parseSrcset(" photo.jpg "))
+	assert.Empty(t, parseSrcset(""))
+}
+
+func TestCrawlService_Crawl_Links(t *testing.T) {
+	url := "https://parserdigital.com/"
+
+	body := `<!DOCTYPE html>
+<html>
+	<head>
+		<link rel="stylesheet" href="/style.css">
+		<link rel="alternate" hreflang="es" href="/es/">
+		<link rel="next" href="/page/2">
+		<link rel="preconnect" href="https://fonts.example.com">
+		<script src="/app.js"></script>
+	</head>
+	<body>
+		<a href="/career">Join us</a>
+		<a href="https://other.com/">Out of scope</a>
+		<map><area href="/contact-us"></map>
+		<iframe src="/how-we-work"></iframe>
+		<img src="/logo.png" srcset="/logo.png 1x, /logo@2x.png 2x">
+		<form action="/search"></form>
+	</body>
+</html>`
+
+	setup := func() *mock_service.HttpMock {
+		mockHttp := mock_service.NewHttpMock(url)
+		mockHttp.RegisterResponders()
+		httpmock.RegisterResponder("GET", url+"robots.txt", httpmock.NewStringResponder(200, "User-agent: *"))
+		httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(http.StatusOK, body))
+		httpmock.RegisterNoResponder(httpmock.NewStringResponder(http.StatusNotFound, ""))
+		return mockHttp
+	}
+
+	t.Run("Classification", func(t *testing.T) {
+		mockHttp := setup()
+		defer mockHttp.DeactivateAndReset()
+
+		sitemap := newTestCrawlerService().Crawl(context.Background(), &model.Request{Url: url}, nil)
+
+		assert.Equal(t, []model.Link{
+			{Url: url + "style.css", Element: "link", Kind: model.LinkAsset},
+			{Url: url + "es/", Element: "link", Kind: model.LinkAlternate},
+			{Url: url + "page/2", Element: "link", Kind: model.LinkNavigation},
+			{Url: url + "app.js", Element: "script", Kind: model.LinkAsset},
+			{Url: url + "career", Element: "a", Kind: model.LinkNavigation},
+			{Url: url + "contact-us", Element: "area", Kind: model.LinkNavigation},
+			{Url: url + "how-we-work", Element: "iframe", Kind: model.LinkNavigation},
+			{Url: url + "logo.png", Element: "img", Kind: model.LinkAsset},
+			{Url: url + "logo@2x.png", Element: "img", Kind: model.LinkAsset},
+			{Url: url + "search", Element: "form", Kind: model.LinkForm},
+		}, sitemap.Links[url])
+
+		assert.Equal(t, []string{url + "page/2", url + "career", url + "contact-us", url + "how-we-work"},
+			sitemap.Pages[url])
+		assert.NotContains(t, sitemap.Pages, url+"style.css")
+	})
+
+	t.Run("Follow Kinds", func(t *testing.T) {
+		mockHttp := setup()
+		defer mockHttp.DeactivateAndReset()
+
+		sitemap := newTestCrawlerService().Crawl(context.Background(), &model.Request{
+			Url:    url,
+			Follow: &model.FollowRules{Kinds: []string{model.LinkNavigation, model.LinkAlternate}},
+		}, nil)
+
+		assert.Contains(t, sitemap.Pages[url], url+"es/")
+		assert.Contains(t, sitemap.Pages, url+"es/")
+		assert.NotContains(t, sitemap.Pages[url], url+"style.css")
+	})
+}
@@ -5,6 +5,7 @@
 package mock_service
 
 import (
+	context "context"
 	reflect "reflect"
 	model "worker/internal/model"
 
@@ -35,15 +36,27 @@ func (m *MockCrawlerService) EXPECT() *MockCrawlerServiceMockRecorder {
 }
 
 // Crawl mocks base method.
-func (m *MockCrawlerService) Crawl(url string) *model.Sitemap {
+func (m *MockCrawlerService) Crawl(ctx context.Context, req *model.Request, events chan<- model.Event) *model.Sitemap {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Crawl", url)
+	ret := m.ctrl.Call(m, "Crawl", ctx, req, events)
 	ret0, _ := ret[0].(*model.Sitemap)
 	return ret0
 }
 
 // Crawl indicates an expected call of Crawl.
-func (mr *MockCrawlerServiceMockRecorder) Crawl(url interface{}) *gomock.Call {
+func (mr *MockCrawlerServiceMockRecorder) Crawl(ctx, req, events interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Crawl", reflect.TypeOf((*MockCrawlerService)(nil).Crawl), url)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Crawl", reflect.TypeOf((*MockCrawlerService)(nil).Crawl), ctx, req, events)
+}
+
+// CrawlTask mocks base method.
+func (m *MockCrawlerService) CrawlTask(ctx context.Context, task *model.PageTask, events chan<- model.Event) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "CrawlTask", ctx, task, events)
+}
+
+// CrawlTask indicates an expected call of CrawlTask.
+func (mr *MockCrawlerServiceMockRecorder) CrawlTask(ctx, task, events interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CrawlTask", reflect.TypeOf((*MockCrawlerService)(nil).CrawlTask), ctx, task, events)
 }
@@ -0,0 +1,268 @@
+package service
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"worker/internal/repo"
+)
+
+// minBackoff is the first pause applied to a host that throttles the crawler without a Retry-After header
+const minBackoff = time.Second
+
+// hostBucket is the token bucket of a host. Tokens can go negative, which represents the requests already scheduled
+// to wait for the bucket to refill
+type hostBucket struct {
+	tokens       float64
+	last         time.Time
+	blockedUntil time.Time
+	backoff      time.Duration
+}
+
+// hostScheduler spaces out the requests to each host with a token bucket shared by all the fetchers and crawl jobs,
+// and pauses the hosts that answer with 429 or 503. With a fleet repository, the requests are also spaced out across
+// all the workers
+type hostScheduler struct {
+	rate       float64
+	burst      int
+	maxBackoff time.Duration
+	buckets    map[string]*hostBucket
+	fleet      repo.HostRepo
+	mu         sync.Mutex
+	now        func() time.Time
+	sleep      func(ctx context.Context, d time.Duration) error
+}
+
+// newHostScheduler builds a scheduler allowing rate requests per second to each host with the given burst. A zero rate
+// means requests are only spaced out by the robots crawl delay
+func newHostScheduler(rate float64, burst int, maxBackoff time.Duration) *hostScheduler {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &hostScheduler{
+		rate:       rate,
+		burst:      burst,
+		maxBackoff: maxBackoff,
+		buckets:    make(map[string]*hostBucket),
+		now:        time.Now,
+		sleep:      sleepContext,
+	}
+}
+
+// wait blocks until a request to the host is allowed. The crawl delay of the robots file is enforced when it is slower
+// than the configured rate, in which case no bursts are allowed. It returns the error of the context when it is
+// cancelled while waiting
+func (s *hostScheduler) wait(ctx context.Context, host string, crawlDelay time.Duration) error {
+	for {
+		if d := s.reserve(host, crawlDelay); d > 0 {
+			if err := s.sleep(ctx, d); err != nil {
+				return err
+			}
+		}
+
+		// A request whose turn came before the host throttled the crawler waits for the end of the pause
+		if !s.paused(host) {
+			break
+		}
+	}
+
+	if s.fleet != nil {
+		return s.waitFleet(ctx, host, crawlDelay)
+	}
+
+	return ctx.Err()
+}
+
+// waitFleet blocks until the request slot of the host shared by all the workers is free, and takes it. Bursts are not
+// allowed across the fleet, so the requests are spaced out by the interval of the rate or the crawl delay
+func (s *hostScheduler) waitFleet(ctx context.Context, host string, crawlDelay time.Duration) error {
+	interval, _ := s.interval(crawlDelay)
+	if interval <= 0 {
+		return ctx.Err()
+	}
+
+	for {
+		d, err := s.fleet.Reserve(ctx, host, interval)
+		if err != nil {
+			// The schedule of the worker still applies when the shared one cannot be reached
+			log.Printf("error reserving a request to %s across the workers: %s", host, err)
+			return ctx.Err()
+		}
+		if d <= 0 {
+			return ctx.Err()
+		}
+
+		if err := s.sleep(ctx, d); err != nil {
+			return err
+		}
+	}
+}
+
+// interval returns the time between two requests to a host and the burst of requests allowed, given the configured
+// rate and the crawl delay of the robots file
+func (s *hostScheduler) interval(crawlDelay time.Duration) (time.Duration, float64) {
+	interval, burst := time.Duration(0), float64(s.burst)
+	if s.rate > 0 {
+		interval = time.Duration(float64(time.Second) / s.rate)
+	}
+	if crawlDelay > interval {
+		interval, burst = crawlDelay, 1
+	}
+
+	return interval, burst
+}
+
+// reserve takes a token from the bucket of the host and returns how long the request has to wait for it
+func (s *hostScheduler) reserve(host string, crawlDelay time.Duration) time.Duration {
+	interval, burst := s.interval(crawlDelay)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	b := s.bucket(host, now, burst)
+
+	// Requests to a throttled host are scheduled from the end of its pause
+	start := now
+	if b.blockedUntil.After(start) {
+		start = b.blockedUntil
+	}
+	wait := start.Sub(now)
+
+	if interval > 0 {
+		if elapsed := start.Sub(b.last); elapsed > 0 {
+			b.tokens = math.Min(burst, b.tokens+float64(elapsed)/float64(interval))
+			b.last = start
+		}
+
+		b.tokens--
+		if b.tokens < 0 {
+			wait += time.Duration(-b.tokens * float64(interval))
+		}
+	}
+
+	return wait
+}
+
+// bucket returns the bucket of the host, creating a full one the first time. It must be called with the lock held
+func (s *hostScheduler) bucket(host string, now time.Time, burst float64) *hostBucket {
+	b, ok := s.buckets[host]
+	if !ok {
+		b = &hostBucket{tokens: burst, last: now}
+		s.buckets[host] = b
+	}
+
+	return b
+}
+
+// throttled pauses all the requests to the host, for the Retry-After duration if the host sent it, or for an
+// exponentially growing time otherwise. A max pause greater than zero caps both, which is how a job with a time limit
+// keeps a long Retry-After from outliving it. The pause applies to all the workers when there is a fleet repository.
+// It returns the length of the pause
+func (s *hostScheduler) throttled(host string, retryAfter, maxPause time.Duration) time.Duration {
+	pause := s.pause(host, retryAfter, maxPause)
+
+	if s.fleet != nil {
+		if err := s.fleet.Pause(context.Background(), host, pause); err != nil {
+			log.Printf("error pausing the requests to %s across the workers: %s", host, err)
+		}
+	}
+
+	return pause
+}
+
+// pause blocks the bucket of the host and returns the length of the pause
+func (s *hostScheduler) pause(host string, retryAfter, maxPause time.Duration) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	b := s.bucket(host, now, float64(s.burst))
+
+	// The server knows best how long it needs, so only the backoff the crawler picks on its own is capped
+	pause := retryAfter
+	if pause <= 0 {
+		pause = b.backoff * 2
+		if pause < minBackoff {
+			pause = minBackoff
+		}
+		if s.maxBackoff > 0 && pause > s.maxBackoff {
+			pause = s.maxBackoff
+		}
+	}
+	if maxPause > 0 && pause > maxPause {
+		pause = maxPause
+	}
+
+	b.backoff = pause
+	b.blockedUntil = now.Add(pause)
+	// Only one request is allowed right after the pause so the host does not get a burst of requests
+	b.tokens = 1
+	b.last = b.blockedUntil
+
+	return pause
+}
+
+// paused checks if the requests to the host are still paused because it throttled the crawler
+func (s *hostScheduler) paused(host string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[host]
+	return ok && b.blockedUntil.After(s.now())
+}
+
+// succeeded resets the backoff of the host after a request that was not throttled
+func (s *hostScheduler) succeeded(host string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b, ok := s.buckets[host]; ok {
+		b.backoff = 0
+	}
+}
+
+// sleepContext pauses for the duration, or until the context is cancelled in which case it returns its error
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// isThrottled checks if the response asks the crawler to slow down
+func isThrottled(res *http.Response) bool {
+	return res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable
+}
+
+// parseRetryAfter parses the Retry-After header, which can be a number of seconds or an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+
+	return 0
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+	"worker/internal/model"
+	mock_repo "worker/internal/repo/mocks"
+	mock_service "worker/internal/service/mocks"
+)
+
+func newTestScheduler(rate float64, burst int) (*hostScheduler, *time.Time) {
+	now := time.Date(2023, 11, 1, 10, 0, 0, 0, time.UTC)
+	s := newHostScheduler(rate, burst, time.Minute)
+	s.now = func() time.Time { return now }
+
+	return s, &now
+}
+
+func TestHostScheduler_Reserve(t *testing.T) {
+	t.Run("Rate With Burst", func(t *testing.T) {
+		s, _ := newTestScheduler(2, 2)
+
+		assert.Equal(t, time.Duration(0), s.reserve("parserdigital.com", 0))
+		assert.Equal(t, time.Duration(0), s.reserve("parserdigital.com", 0))
+		assert.Equal(t, 500*time.Millisecond, s.reserve("parserdigital.com", 0))
+		assert.Equal(t, time.Second, s.reserve("parserdigital.com", 0))
+
+		// Each host has its own bucket
+		assert.Equal(t, time.Duration(0), s.reserve("example.com", 0))
+	})
+
+	t.Run("Bucket Refills", func(t *testing.T) {
+		s, now := newTestScheduler(2, 1)
+
+		assert.Equal(t, time.Duration(0), s.reserve("parserdigital.com", 0))
+		*now = now.Add(500 * time.Millisecond)
+		assert.Equal(t, time.Duration(0), s.reserve("parserdigital.com", 0))
+	})
+
+	t.Run("Crawl Delay Slower Than Rate", func(t *testing.T) {
+		s, _ := newTestScheduler(10, 10)
+
+		assert.Equal(t, time.Duration(0), s.reserve("parserdigital.com", 2*time.Second))
+		assert.Equal(t, 2*time.Second, s.reserve("parserdigital.com", 2*time.Second))
+		assert.Equal(t, 4*time.Second, s.reserve("parserdigital.com", 2*time.Second))
+	})
+
+	t.Run("No Rate", func(t *testing.T) {
+		s, _ := newTestScheduler(0, 1)
+
+		for i := 0; i < 5; i++ {
+			assert.Equal(t, time.Duration(0), s.reserve("parserdigital.com", 0))
+		}
+	})
+}
+
+func TestHostScheduler_Throttled(t *testing.T) {
+	s, now := newTestScheduler(0, 1)
+
+	assert.Equal(t, time.Second, s.throttled("parserdigital.com", 0, 0))
+	assert.Equal(t, time.Second, s.reserve("parserdigital.com", 0))
+	assert.Equal(t, time.Duration(0), s.reserve("example.com", 0))
+
+	// The backoff grows exponentially until a request succeeds
+	assert.Equal(t, 2*time.Second, s.throttled("parserdigital.com", 0, 0))
+	assert.Equal(t, 4*time.Second, s.throttled("parserdigital.com", 0, 0))
+	s.succeeded("parserdigital.com")
+	assert.Equal(t, time.Second, s.throttled("parserdigital.com", 0, 0))
+
+	// Retry-After is honored past the max backoff, up to the max pause of the job
+	assert.Equal(t, 30*time.Second, s.throttled("parserdigital.com", 30*time.Second, 0))
+	assert.Equal(t, time.Hour, s.throttled("parserdigital.com", time.Hour, 0))
+	assert.Equal(t, 10*time.Minute, s.throttled("parserdigital.com", time.Hour, 10*time.Minute))
+	assert.Equal(t, 500*time.Millisecond, s.throttled("example.com", 0, 500*time.Millisecond))
+
+	*now = now.Add(10 * time.Minute)
+	assert.Equal(t, time.Duration(0), s.reserve("parserdigital.com", 0))
+}
+
+func TestHostScheduler_Wait_ThrottledWhileWaiting(t *testing.T) {
+	s, now := newTestScheduler(1, 1)
+	var slept []time.Duration
+	s.sleep = func(ctx context.Context, d time.Duration) error {
+		// Another request is throttled by the host while this one waits for its turn
+		if len(slept) == 0 {
+			s.throttled("parserdigital.com", 5*time.Second, 0)
+		}
+		slept = append(slept, d)
+		*now = now.Add(d)
+		return nil
+	}
+
+	assert.Equal(t, time.Duration(0), s.reserve("parserdigital.com", 0))
+	assert.NoError(t, s.wait(context.Background(), "parserdigital.com", 0))
+	assert.Equal(t, []time.Duration{time.Second, 4 * time.Second}, slept)
+}
+
+func TestHostScheduler_Fleet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	hosts := mock_repo.NewMockHostRepo(ctrl)
+	ctx := context.Background()
+
+	s, _ := newTestScheduler(4, 4)
+	s.fleet = hosts
+	var slept []time.Duration
+	s.sleep = func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+
+	t.Run("Waits For The Shared Slot", func(t *testing.T) {
+		slept = nil
+		gomock.InOrder(
+			hosts.EXPECT().Reserve(ctx, "parserdigital.com", 250*time.Millisecond).Return(100*time.Millisecond, nil),
+			hosts.EXPECT().Reserve(ctx, "parserdigital.com", 250*time.Millisecond).Return(time.Duration(0), nil),
+		)
+
+		assert.NoError(t, s.wait(ctx, "parserdigital.com", 0))
+		assert.Equal(t, []time.Duration{100 * time.Millisecond}, slept)
+	})
+
+	t.Run("Crawl Delay", func(t *testing.T) {
+		slept = nil
+		hosts.EXPECT().Reserve(ctx, "example.com", 2*time.Second).Return(time.Duration(0), nil)
+
+		assert.NoError(t, s.wait(ctx, "example.com", 2*time.Second))
+		assert.Empty(t, slept)
+	})
+
+	t.Run("Error From Repository", func(t *testing.T) {
+		slept = nil
+		hosts.EXPECT().Reserve(ctx, "parserdigital.com", 250*time.Millisecond).Return(time.Duration(0), errors.New("some error"))
+
+		assert.NoError(t, s.wait(ctx, "parserdigital.com", 0))
+	})
+
+	t.Run("Throttled", func(t *testing.T) {
+		hosts.EXPECT().Pause(gomock.Any(), "parserdigital.com", time.Second).Return(nil)
+
+		assert.Equal(t, time.Second, s.throttled("parserdigital.com", 0, 0))
+	})
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2023, 11, 1, 10, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 120*time.Second, parseRetryAfter("120", now))
+	assert.Equal(t, 30*time.Second, parseRetryAfter("Wed, 01 Nov 2023 10:00:30 GMT", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("Wed, 01 Nov 2023 09:00:00 GMT", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("-1", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+}
+
+func TestCrawlService_Crawl_Throttled(t *testing.T) {
+	url := "https://parserdigital.com/"
+	mockHttp := mock_service.NewHttpMock(url)
+	mockHttp.RegisterResponders()
+	defer mockHttp.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", url+"robots.txt", httpmock.NewStringResponder(200, "User-agent: *"))
+
+	calls := 0
+	httpmock.RegisterResponder("GET", url+"career", func(req *http.Request) (*http.Response, error) {
+		calls++
+		if calls == 1 {
+			res := httpmock.NewStringResponse(http.StatusTooManyRequests, "Slow down")
+			res.Header.Set("Retry-After", "1")
+			return res, nil
+		}
+		return httpmock.NewStringResponse(http.StatusOK, "Dummy text"), nil
+	})
+
+	sitemap := newTestCrawlerService().Crawl(context.Background(), &model.Request{Url: url}, nil)
+
+	assert.Equal(t, 2, calls)
+	assert.Contains(t, sitemap.Pages, url+"career")
+}
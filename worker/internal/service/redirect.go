@@ -0,0 +1,77 @@
+package service
+
+import (
+	"net/http"
+	"net/url"
+	"worker/internal/model"
+)
+
+// redirectChain returns the redirects received to get the response, from the requested url onwards. The response
+// itself is the last hop when it is a redirect that was not followed
+func redirectChain(res *http.Response) []model.RedirectHop {
+	var hops []model.RedirectHop
+	if hop, ok := redirectHop(res); ok {
+		hops = append(hops, hop)
+	}
+
+	// Every request made by the client after a redirect keeps the response that caused it
+	for req := res.Request; req != nil && req.Response != nil; req = req.Response.Request {
+		if hop, ok := redirectHop(req.Response); ok {
+			hops = append(hops, hop)
+		}
+	}
+
+	for i, j := 0, len(hops)-1; i < j; i, j = i+1, j-1 {
+		hops[i], hops[j] = hops[j], hops[i]
+	}
+
+	return hops
+}
+
+// redirectHop describes a redirect response, with its Location resolved against the url that sent it
+func redirectHop(res *http.Response) (model.RedirectHop, bool) {
+	location := res.Header.Get("Location")
+	if res.Request == nil || location == "" || res.StatusCode < 300 || res.StatusCode >= 400 {
+		return model.RedirectHop{}, false
+	}
+
+	if target, err := res.Request.URL.Parse(location); err == nil {
+		location = target.String()
+	}
+
+	return model.RedirectHop{Url: res.Request.URL.String(), Status: res.StatusCode, Location: location}, true
+}
+
+// redirectIssues checks a redirect chain for loops, for more hops than maxChain and for redirects from https to http.
+// A zero maxChain does not check the length of the chain
+func redirectIssues(hops []model.RedirectHop, maxChain int) []string {
+	var issues []string
+
+	// A loop redirects back to a url already requested in the chain
+	visited := make(map[string]bool, len(hops))
+	loop, downgrade := false, false
+	for _, hop := range hops {
+		visited[hop.Url] = true
+		if visited[hop.Location] {
+			loop = true
+		}
+
+		from, errFrom := url.Parse(hop.Url)
+		to, errTo := url.Parse(hop.Location)
+		if errFrom == nil && errTo == nil && from.Scheme == "https" && to.Scheme == "http" {
+			downgrade = true
+		}
+	}
+
+	if loop {
+		issues = append(issues, model.RedirectLoop)
+	}
+	if maxChain > 0 && len(hops) > maxChain {
+		issues = append(issues, model.RedirectTooLong)
+	}
+	if downgrade {
+		issues = append(issues, model.RedirectDowngrade)
+	}
+
+	return issues
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"worker/internal/model"
+	mock_service "worker/internal/service/mocks"
+)
+
+func TestRedirectIssues(t *testing.T) {
+	tests := []struct {
+		name   string
+		hops   []model.RedirectHop
+		issues []string
+	}{
+		{"No Redirects", nil, nil},
+		{"Single Redirect", []model.RedirectHop{
+			{Url: "https://parserdigital.com/a", Status: 301, Location: "https://parserdigital.com/b"},
+		}, nil},
+		{"Loop", []model.RedirectHop{
+			{Url: "https://parserdigital.com/a", Status: 302, Location: "https://parserdigital.com/b"},
+			{Url: "https://parserdigital.com/b", Status: 302, Location: "https://parserdigital.com/a"},
+		}, []string{model.RedirectLoop}},
+		{"Too Long", []model.RedirectHop{
+			{Url: "https://parserdigital.com/a", Status: 301, Location: "https://parserdigital.com/b"},
+			{Url: "https://parserdigital.com/b", Status: 301, Location: "https://parserdigital.com/c"},
+			{Url: "https://parserdigital.com/c", Status: 301, Location: "https://parserdigital.com/d"},
+		}, []string{model.RedirectTooLong}},
+		{"Downgrade", []model.RedirectHop{
+			{Url: "https://parserdigital.com/a", Status: 301, Location: "http://parserdigital.com/a"},
+		}, []string{model.RedirectDowngrade}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.issues, redirectIssues(tt.hops, 2))
+		})
+	}
+}
+
+func TestCrawlService_Crawl_Redirects(t *testing.T) {
+	url := "https://parserdigital.com/"
+	mockHttp := mock_service.NewHttpMock(url)
+	mockHttp.RegisterResponders()
+	defer mockHttp.DeactivateAndReset()
+
+	redirect := func(status int, location string) httpmock.Responder {
+		return httpmock.NewStringResponder(status, "").HeaderSet(http.Header{"Location": {location}})
+	}
+
+	httpmock.RegisterResponder("GET", url+"robots.txt", httpmock.NewStringResponder(200, "User-agent: *"))
+	httpmock.RegisterResponder("GET", url+"career", redirect(http.StatusMovedPermanently, "/careers"))
+	httpmock.RegisterResponder("GET", url+"careers", httpmock.NewStringResponder(http.StatusOK,
+		`<html><body><a href="/apply">Apply</a></body></html>`))
+	httpmock.RegisterResponder("GET", url+"contact-us", redirect(http.StatusFound, "/contact"))
+	httpmock.RegisterResponder("GET", url+"contact", redirect(http.StatusFound, "/contact-us"))
+	httpmock.RegisterResponder("GET", url+"how-we-work", redirect(http.StatusMovedPermanently,
+		"http://parserdigital.com/how-we-work"))
+	httpmock.RegisterResponder("GET", "http://parserdigital.com/how-we-work", httpmock.NewStringResponder(http.StatusOK,
+		"Dummy text"))
+
+	sitemap := newTestCrawlerService().Crawl(context.Background(), &model.Request{Url: url}, nil)
+
+	t.Run("Final Url", func(t *testing.T) {
+		assert.Equal(t, []string{url + "careers"}, sitemap.Pages[url+"career"])
+		assert.Equal(t, []string{url + "apply"}, sitemap.Pages[url+"careers"])
+
+		career := sitemap.PageInfo[url+"career"]
+		assert.Equal(t, http.StatusMovedPermanently, career.Status)
+		assert.Equal(t, url+"careers", career.FinalUrl)
+		assert.Equal(t, []model.RedirectHop{
+			{Url: url + "career", Status: http.StatusMovedPermanently, Location: url + "careers"},
+		}, career.Redirects)
+
+		careers := sitemap.PageInfo[url+"careers"]
+		assert.Equal(t, http.StatusOK, careers.Status)
+		assert.Equal(t, 1, careers.Depth)
+		assert.Empty(t, careers.Redirects)
+	})
+
+	t.Run("Loop", func(t *testing.T) {
+		assert.NotContains(t, sitemap.Pages, url+"contact-us")
+		assert.Contains(t, sitemap.PageInfo[url+"contact-us"].Error, "redirect loop")
+		assert.Len(t, sitemap.PageInfo[url+"contact-us"].Redirects, 2)
+	})
+
+	t.Run("Issues", func(t *testing.T) {
+		assert.Equal(t, []model.RedirectIssue{
+			{Url: url + "contact-us", Issues: []string{model.RedirectLoop}},
+			{Url: url + "how-we-work", Issues: []string{model.RedirectDowngrade}},
+		}, sitemap.RedirectIssues)
+	})
+}
+
+func TestCrawlService_Crawl_RedirectsDisabled(t *testing.T) {
+	url := "https://parserdigital.com/"
+	mockHttp := mock_service.NewHttpMock(url)
+	mockHttp.RegisterResponders()
+	defer mockHttp.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", url+"robots.txt", httpmock.NewStringResponder(200, "User-agent: *"))
+	httpmock.RegisterResponder("GET", url+"career", httpmock.NewStringResponder(http.StatusMovedPermanently, "").
+		HeaderSet(http.Header{"Location": {"/careers"}}))
+	httpmock.RegisterResponder("GET", url+"careers", httpmock.NewStringResponder(http.StatusOK,
+		`<html><body><a href="/apply">Apply</a></body></html>`))
+
+	noRedirects := 0
+	sitemap := newTestCrawlerService().Crawl(context.Background(), &model.Request{
+		Url:   url,
+		Fetch: &model.FetchOptions{MaxRedirects: &noRedirects},
+	}, nil)
+
+	// The redirect is recorded as it is, and its Location is crawled as a link of the page
+	assert.Equal(t, []string{url + "careers"}, sitemap.Pages[url+"career"])
+	assert.Equal(t, []model.Link{
+		{Url: url + "careers", Element: locationElement, Kind: model.LinkNavigation},
+	}, sitemap.Links[url+"career"])
+	assert.Equal(t, http.StatusMovedPermanently, sitemap.PageInfo[url+"career"].Status)
+	assert.Equal(t, 2, sitemap.PageInfo[url+"careers"].Depth)
+	assert.Equal(t, []string{url + "apply"}, sitemap.Pages[url+"careers"])
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+	"worker/internal/model"
+)
+
+// retryPolicy decides how many times a failed request is sent again and how long to wait before each attempt
+type retryPolicy struct {
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+}
+
+// newRetryPolicy builds the retry policy of a crawl job, overriding the worker settings with the request options.
+// It also returns the maximum number of retries of the whole job
+func newRetryPolicy(config Config, opts *model.RetryOptions) (retryPolicy, int) {
+	policy := retryPolicy{
+		maxRetries: config.MaxRetries,
+		baseDelay:  config.RetryBaseDelay,
+		maxDelay:   config.RetryMaxDelay,
+	}
+	total := config.MaxJobRetries
+
+	if opts != nil {
+		if opts.MaxRetries != nil {
+			policy.maxRetries = *opts.MaxRetries
+		}
+		if opts.MaxTotalRetries != nil {
+			total = *opts.MaxTotalRetries
+		}
+	}
+
+	return policy, total
+}
+
+// delay returns the exponential backoff with full jitter to wait before a retry, where attempt starts at 0
+func (p retryPolicy) delay(attempt int) time.Duration {
+	if p.baseDelay <= 0 {
+		return 0
+	}
+
+	backoff := p.maxDelay
+	if attempt < 32 {
+		if d := p.baseDelay << attempt; d > 0 && (p.maxDelay <= 0 || d < p.maxDelay) {
+			backoff = d
+		}
+	}
+	if backoff <= 0 {
+		backoff = p.baseDelay
+	}
+
+	return time.Duration(rand.Int63n(int64(backoff))) + 1
+}
+
+// isRetryable checks if a request failed because of a transient error: a connection reset, a timeout or a 5xx
+// response other than 503, which is handled by the host scheduler
+func isRetryable(res *http.Response, err error) bool {
+	if err == nil {
+		return res.StatusCode >= http.StatusInternalServerError && res.StatusCode != http.StatusServiceUnavailable
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, os.ErrDeadlineExceeded)
+}
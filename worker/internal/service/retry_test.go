@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+	"worker/internal/model"
+	mock_service "worker/internal/service/mocks"
+)
+
+// newTestRetryCrawlerService builds a test service that retries without waiting
+func newTestRetryCrawlerService() CrawlerService {
+	config := DefaultConfig()
+	config.RetryBaseDelay = time.Millisecond
+	config.RetryMaxDelay = time.Millisecond
+	return NewCrawlerService(config, newHTTPFetcher(config.Fetch, nil), nil, nil, nil)
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	policy := retryPolicy{maxRetries: 5, baseDelay: 100 * time.Millisecond, maxDelay: time.Second}
+
+	for attempt, limit := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		for i := 0; i < 20; i++ {
+			d := policy.delay(attempt)
+			assert.Greater(t, d, time.Duration(0))
+			assert.LessOrEqual(t, d, limit*time.Millisecond)
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		err       error
+		retryable bool
+	}{
+		{"ok", http.StatusOK, nil, false},
+		{"not found", http.StatusNotFound, nil, false},
+		{"internal server error", http.StatusInternalServerError, nil, true},
+		{"bad gateway", http.StatusBadGateway, nil, true},
+		{"service unavailable", http.StatusServiceUnavailable, nil, false},
+		{"connection reset", 0, syscall.ECONNRESET, true},
+		{"unexpected eof", 0, io.ErrUnexpectedEOF, true},
+		{"other error", 0, errors.New("unsupported protocol scheme"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var res *http.Response
+			if tt.err == nil {
+				res = &http.Response{StatusCode: tt.status}
+			}
+			assert.Equal(t, tt.retryable, isRetryable(res, tt.err))
+		})
+	}
+}
+
+func TestCrawlService_Crawl_Retry(t *testing.T) {
+	url := "https://parserdigital.com/"
+
+	t.Run("Transient Error", func(t *testing.T) {
+		mockHttp := mock_service.NewHttpMock(url)
+		mockHttp.RegisterResponders()
+		defer mockHttp.DeactivateAndReset()
+
+		httpmock.RegisterResponder("GET", url+"robots.txt", httpmock.NewStringResponder(200, "User-agent: *"))
+
+		calls := 0
+		httpmock.RegisterResponder("GET", url+"career", func(req *http.Request) (*http.Response, error) {
+			calls++
+			switch calls {
+			case 1:
+				return nil, syscall.ECONNRESET
+			case 2:
+				return httpmock.NewStringResponse(http.StatusBadGateway, "Bad gateway"), nil
+			}
+			return httpmock.NewStringResponse(http.StatusOK, "Dummy text"), nil
+		})
+
+		sitemap := newTestRetryCrawlerService().Crawl(context.Background(), &model.Request{Url: url}, nil)
+
+		assert.Equal(t, 3, calls)
+		assert.Contains(t, sitemap.Pages, url+"career")
+		assert.Empty(t, sitemap.Errors)
+	})
+
+	t.Run("Persistent Error", func(t *testing.T) {
+		mockHttp := mock_service.NewHttpMock(url)
+		mockHttp.RegisterResponders()
+		defer mockHttp.DeactivateAndReset()
+
+		httpmock.RegisterResponder("GET", url+"robots.txt", httpmock.NewStringResponder(200, "User-agent: *"))
+		httpmock.RegisterResponder("GET", url+"career", httpmock.NewStringResponder(http.StatusInternalServerError, "Error"))
+
+		sitemap := newTestRetryCrawlerService().Crawl(context.Background(), &model.Request{Url: url}, nil)
+
+		assert.Equal(t, 3, httpmock.GetCallCountInfo()["GET "+url+"career"])
+		assert.NotContains(t, sitemap.Pages, url+"career")
+		assert.Equal(t, []model.PageError{{
+			Url:   url + "career",
+			Error: "error getting url: server error with status 500 after 2 retries",
+		}}, sitemap.Errors)
+	})
+
+	t.Run("Job Retry Budget", func(t *testing.T) {
+		mockHttp := mock_service.NewHttpMock(url)
+		mockHttp.RegisterResponders()
+		defer mockHttp.DeactivateAndReset()
+
+		httpmock.RegisterResponder("GET", url+"robots.txt", httpmock.NewStringResponder(200, "User-agent: *"))
+		for _, page := range []string{"how-we-work", "career", "contact-us"} {
+			httpmock.RegisterResponder("GET", url+page, httpmock.NewStringResponder(http.StatusInternalServerError, "Error"))
+		}
+
+		maxTotalRetries := 1
+		sitemap := newTestRetryCrawlerService().Crawl(context.Background(), &model.Request{
+			Url:   url,
+			Retry: &model.RetryOptions{MaxTotalRetries: &maxTotalRetries},
+		}, nil)
+
+		calls := 0
+		for _, page := range []string{"how-we-work", "career", "contact-us"} {
+			calls += httpmock.GetCallCountInfo()["GET "+url+page]
+		}
+		assert.Equal(t, 4, calls)
+		assert.Len(t, sitemap.Errors, 3)
+	})
+}
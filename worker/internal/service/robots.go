@@ -0,0 +1,277 @@
+package service
+
+import (
+	"bufio"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// userAgent is the product token the crawler identifies itself with by default when matching robots.txt groups
+const userAgent = "ParserCrawler"
+
+// maxRobotsSize is the maximum amount of a robots.txt file that gets parsed, as recommended by RFC 9309
+const maxRobotsSize = 500 * 1024
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+type robotsGroup struct {
+	agents   []string
+	rules    []robotsRule
+	delay    time.Duration
+	hasDelay bool
+}
+
+// robots holds the rules of a robots.txt file that apply to the crawler user agent
+type robots struct {
+	rules       []robotsRule
+	delay       time.Duration
+	sitemaps    []string
+	disallowAll bool
+}
+
+// allowAllRobots returns the rules used when a site has no robots.txt file
+func allowAllRobots() *robots {
+	return &robots{}
+}
+
+// disallowAllRobots returns the rules used when the robots.txt file is unreachable
+func disallowAllRobots() *robots {
+	return &robots{disallowAll: true}
+}
+
+// productToken returns the product token of a User-Agent header such as "ParserCrawler/1.0 (+https://parser.com)",
+// which is the name robots.txt groups address the crawler by. The default token is used when the header is empty
+func productToken(ua string) string {
+	fields := strings.Fields(ua)
+	if len(fields) == 0 {
+		return userAgent
+	}
+
+	token, _, _ := strings.Cut(fields[0], "/")
+	if token == "" {
+		return userAgent
+	}
+
+	return token
+}
+
+// parseRobots parses a robots.txt file and keeps the group of rules that applies to the given user agent.
+// When several groups match the user agent they are merged, and the "*" group is only used if no other group matches
+func parseRobots(r io.Reader, agent string) *robots {
+	var (
+		groups   []*robotsGroup
+		current  *robotsGroup
+		inRules  bool
+		sitemaps []string
+	)
+
+	scanner := bufio.NewScanner(io.LimitReader(r, maxRobotsSize))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRobotsSize)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+
+		switch key {
+		case "user-agent":
+			if current == nil || inRules {
+				current = &robotsGroup{}
+				groups = append(groups, current)
+				inRules = false
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			if current == nil {
+				continue
+			}
+			inRules = true
+			// An empty disallow rule matches nothing, so it has the same effect as not having the rule at all
+			if value == "" {
+				continue
+			}
+			current.rules = append(current.rules, robotsRule{allow: key == "allow", pattern: value})
+		case "crawl-delay":
+			if current == nil {
+				continue
+			}
+			inRules = true
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil || seconds < 0 {
+				continue
+			}
+			current.delay = time.Duration(seconds * float64(time.Second))
+			current.hasDelay = true
+		case "sitemap":
+			if _, err := url.Parse(value); err == nil && value != "" {
+				sitemaps = append(sitemaps, value)
+			}
+		}
+	}
+
+	res := &robots{sitemaps: sitemaps}
+
+	matched := matchRobotsGroups(groups, agent)
+	for _, g := range matched {
+		res.rules = append(res.rules, g.rules...)
+		if g.hasDelay && g.delay > res.delay {
+			res.delay = g.delay
+		}
+	}
+
+	return res
+}
+
+// matchRobotsGroups returns the groups that apply to the user agent, falling back to the "*" groups
+func matchRobotsGroups(groups []*robotsGroup, agent string) []*robotsGroup {
+	agent = strings.ToLower(agent)
+
+	var specific, wildcard []*robotsGroup
+	for _, g := range groups {
+		for _, a := range g.agents {
+			if a == "*" {
+				wildcard = append(wildcard, g)
+				break
+			}
+
+			// Only the product token is relevant, ignoring any version such as "ParserCrawler/1.0"
+			if token, _, _ := strings.Cut(a, "/"); token == agent {
+				specific = append(specific, g)
+				break
+			}
+		}
+	}
+
+	if len(specific) > 0 {
+		return specific
+	}
+
+	return wildcard
+}
+
+// allowed checks if the url can be crawled. The most specific (longest) matching rule wins and on ties allow rules
+// take precedence over disallow rules
+func (r *robots) allowed(u *url.URL) bool {
+	if r.disallowAll {
+		return false
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	// robots.txt itself is always allowed
+	if path == "/robots.txt" {
+		return true
+	}
+
+	allow, longest := true, -1
+	for _, rule := range r.rules {
+		if !matchRobotsPattern(rule.pattern, path) {
+			continue
+		}
+
+		length := len(rule.pattern)
+		if length > longest || (length == longest && rule.allow) {
+			allow, longest = rule.allow, length
+		}
+	}
+
+	return allow
+}
+
+// matchRobotsPattern checks if the path matches a robots.txt rule, where "*" matches any sequence of characters and a
+// trailing "$" anchors the rule to the end of the path
+func matchRobotsPattern(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = strings.TrimSuffix(pattern, "$")
+	}
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+
+	pos := len(parts[0])
+	for i := 1; i < len(parts); i++ {
+		part := parts[i]
+		if anchored && i == len(parts)-1 {
+			return strings.HasSuffix(path[pos:], part)
+		}
+
+		idx := strings.Index(path[pos:], part)
+		if idx < 0 {
+			return false
+		}
+		pos += idx + len(part)
+	}
+
+	return !anchored || pos == len(path)
+}
+
+// robotsCacheTTL is how long a robots file is reused before requesting it again, as recommended by RFC 9309
+const robotsCacheTTL = 24 * time.Hour
+
+type robotsCacheEntry struct {
+	robots    *robots
+	fetchedAt time.Time
+}
+
+// robotsCache keeps the parsed robots files by subdomain and user agent so they are shared between crawl jobs
+type robotsCache struct {
+	entries map[string]robotsCacheEntry
+	mu      sync.Mutex
+}
+
+// newRobotsCache builds an empty robots cache
+func newRobotsCache() *robotsCache {
+	return &robotsCache{
+		entries: make(map[string]robotsCacheEntry),
+	}
+}
+
+// get returns the cached robots rules of the agent for the subdomain if they have not expired
+func (c *robotsCache) get(subdomain, agent string) (*robots, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[robotsCacheKey(subdomain, agent)]
+	if !ok || time.Since(entry.fetchedAt) > robotsCacheTTL {
+		return nil, false
+	}
+
+	return entry.robots, true
+}
+
+// set stores the robots rules of the agent for the subdomain
+func (c *robotsCache) set(subdomain, agent string, rules *robots) {
+	c.mu.Lock()
+	c.entries[robotsCacheKey(subdomain, agent)] = robotsCacheEntry{robots: rules, fetchedAt: time.Now()}
+	c.mu.Unlock()
+}
+
+// robotsCacheKey returns the key of the robots rules of the agent for the subdomain. Agents are case insensitive
+func robotsCacheKey(subdomain, agent string) string {
+	return strings.ToLower(agent) + " " + subdomain
+}
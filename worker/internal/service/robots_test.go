@@ -0,0 +1,126 @@
+package service
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRobots(t *testing.T) {
+	body := `# robots file
+Sitemap: https://parserdigital.com/sitemap.xml
+
+User-agent: *
+Disallow: /private
+Crawl-delay: 5
+
+User-agent: ParserCrawler/1.0
+User-agent: OtherBot
+Disallow: /admin
+Allow: /admin/public
+Disallow: /*.pdf$
+Disallow: /search*q=
+Crawl-delay: 0.5
+`
+
+	rules := parseRobots(strings.NewReader(body), userAgent)
+
+	assert.Equal(t, 500*time.Millisecond, rules.delay)
+	assert.Equal(t, []string{"https://parserdigital.com/sitemap.xml"}, rules.sitemaps)
+
+	tests := []struct {
+		path    string
+		allowed bool
+	}{
+		{"/", true},
+		{"/private", true},
+		{"/admin", false},
+		{"/admin/users", false},
+		{"/admin/public", true},
+		{"/admin/public/page", true},
+		{"/files/doc.pdf", false},
+		{"/files/doc.pdf?download=1", true},
+		{"/search?q=go", false},
+		{"/search?page=1", true},
+		{"/robots.txt", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			u, _ := url.Parse("https://parserdigital.com" + tt.path)
+			assert.Equal(t, tt.allowed, rules.allowed(u))
+		})
+	}
+}
+
+func TestParseRobots_WildcardGroup(t *testing.T) {
+	body := `User-agent: OtherBot
+Disallow: /
+
+User-agent: *
+Disallow: /private
+Crawl-delay: 2
+`
+
+	rules := parseRobots(strings.NewReader(body), userAgent)
+
+	assert.Equal(t, 2*time.Second, rules.delay)
+
+	public, _ := url.Parse("https://parserdigital.com/career")
+	private, _ := url.Parse("https://parserdigital.com/private/page")
+
+	assert.True(t, rules.allowed(public))
+	assert.False(t, rules.allowed(private))
+}
+
+func TestProductToken(t *testing.T) {
+	tests := []struct {
+		ua    string
+		token string
+	}{
+		{"ParserCrawler/1.0", "ParserCrawler"},
+		{"SeoBot/2.0 (+https://parserdigital.com/bot)", "SeoBot"},
+		{"SeoBot", "SeoBot"},
+		{"", userAgent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ua, func(t *testing.T) {
+			assert.Equal(t, tt.token, productToken(tt.ua))
+		})
+	}
+}
+
+func TestMatchRobotsPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"/", "/anything", true},
+		{"/fish", "/fish.html", true},
+		{"/fish", "/Fish", false},
+		{"/fish$", "/fish", true},
+		{"/fish$", "/fish/", false},
+		{"/*.php", "/index.php?x=1", true},
+		{"/*.php$", "/index.php?x=1", false},
+		{"/fish*", "/fishheads", true},
+		{"/*fish*/salmon", "/a/fish/b/salmon", true},
+		{"/*fish*/salmon", "/a/cat/b/salmon", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.match, matchRobotsPattern(tt.pattern, tt.path))
+		})
+	}
+}
+
+func TestRobots_DisallowAll(t *testing.T) {
+	u, _ := url.Parse("https://parserdigital.com/")
+
+	assert.False(t, disallowAllRobots().allowed(u))
+	assert.True(t, allowAllRobots().allowed(u))
+}
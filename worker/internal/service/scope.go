@@ -0,0 +1,114 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"worker/internal/model"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+// Scope decides which urls belong to a crawl job, both to follow them and to record them in the sitemap.
+// Only http and https urls are in scope, and both schemes are treated the same way
+type Scope interface {
+	InScope(u *url.URL) bool
+}
+
+type hostScope struct {
+	host string
+}
+
+type subdomainScope struct {
+	host string
+}
+
+type domainScope struct {
+	domain string
+}
+
+type hostListScope struct {
+	hosts map[string]bool
+}
+
+// NewScope builds the scope for a crawl starting at the seed url. It defaults to the exact host of the seed
+func NewScope(seed *url.URL, rules *model.ScopeRules) (Scope, error) {
+	host := normalizeHost(seed.Hostname())
+	if host == "" {
+		return nil, errors.New(fmt.Sprintf("error building scope: no host in url %s", seed))
+	}
+
+	mode := model.ScopeHost
+	if rules != nil && rules.Mode != "" {
+		mode = rules.Mode
+	}
+
+	switch mode {
+	case model.ScopeHost:
+		return &hostScope{host: host}, nil
+	case model.ScopeSubdomains:
+		return &subdomainScope{host: host}, nil
+	case model.ScopeDomain:
+		domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("error getting registrable domain of %s: %s", host, err))
+		}
+		return &domainScope{domain: domain}, nil
+	case model.ScopeHosts:
+		hosts := map[string]bool{host: true}
+		for _, h := range rules.Hosts {
+			hosts[normalizeHost(h)] = true
+		}
+		return &hostListScope{hosts: hosts}, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("error building scope: unknown mode %q", mode))
+}
+
+// InScope checks if the url is in the same host as the seed
+func (s *hostScope) InScope(u *url.URL) bool {
+	return isWebURL(u) && normalizeHost(u.Hostname()) == s.host
+}
+
+// InScope checks if the url is in the host of the seed or any of its subdomains
+func (s *subdomainScope) InScope(u *url.URL) bool {
+	if !isWebURL(u) {
+		return false
+	}
+
+	host := normalizeHost(u.Hostname())
+	return host == s.host || strings.HasSuffix(host, "."+s.host)
+}
+
+// InScope checks if the url has the same registrable domain as the seed, such as example.co.uk for www.example.co.uk
+func (s *domainScope) InScope(u *url.URL) bool {
+	if !isWebURL(u) {
+		return false
+	}
+
+	domain, err := publicsuffix.EffectiveTLDPlusOne(normalizeHost(u.Hostname()))
+	return err == nil && domain == s.domain
+}
+
+// InScope checks if the url is in the seed host or any of the allowed hosts
+func (s *hostListScope) InScope(u *url.URL) bool {
+	return isWebURL(u) && s.hosts[normalizeHost(u.Hostname())]
+}
+
+// isWebURL checks if the url can be crawled
+func isWebURL(u *url.URL) bool {
+	scheme := strings.ToLower(u.Scheme)
+	return (scheme == "http" || scheme == "https") && u.Host != ""
+}
+
+// normalizeHost returns the lowercase punycode form of the host, as the canonicalizer does
+func normalizeHost(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+		return ascii
+	}
+
+	return host
+}
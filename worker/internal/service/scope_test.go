@@ -0,0 +1,86 @@
+package service
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+	"worker/internal/model"
+)
+
+func TestNewScope(t *testing.T) {
+	seed, _ := url.Parse("https://www.example.co.uk/")
+
+	tests := []struct {
+		name    string
+		rules   *model.ScopeRules
+		inScope map[string]bool
+	}{
+		{
+			name:  "Exact Host",
+			rules: nil,
+			inScope: map[string]bool{
+				"https://www.example.co.uk/about":                   true,
+				"http://www.example.co.uk/about":                    true,
+				"https://WWW.Example.co.uk/about":                   true,
+				"https://blog.www.example.co.uk/":                   false,
+				"https://www.example.co.uk.evil.net/":               false,
+				"https://other.com/?ref=https://www.example.co.uk/": false,
+				"mailto:info@www.example.co.uk":                     false,
+				"ftp://www.example.co.uk/file":                      false,
+			},
+		},
+		{
+			name:  "Subdomains",
+			rules: &model.ScopeRules{Mode: model.ScopeSubdomains},
+			inScope: map[string]bool{
+				"https://www.example.co.uk/":          true,
+				"https://blog.www.example.co.uk/":     true,
+				"https://example.co.uk/":              false,
+				"https://evilwww.example.co.uk/":      false,
+				"https://www.example.co.uk.evil.net/": false,
+			},
+		},
+		{
+			name:  "Registrable Domain",
+			rules: &model.ScopeRules{Mode: model.ScopeDomain},
+			inScope: map[string]bool{
+				"https://www.example.co.uk/":     true,
+				"https://example.co.uk/":         true,
+				"https://shop.example.co.uk/":    true,
+				"https://other.co.uk/":           false,
+				"https://example.co.uk.evil.net": false,
+			},
+		},
+		{
+			name:  "Allowed Hosts",
+			rules: &model.ScopeRules{Mode: model.ScopeHosts, Hosts: []string{"CDN.example.com"}},
+			inScope: map[string]bool{
+				"https://www.example.co.uk/":  true,
+				"https://cdn.example.com/":    true,
+				"https://shop.example.co.uk/": false,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scope, err := NewScope(seed, tt.rules)
+			assert.NoError(t, err)
+
+			for link, expected := range tt.inScope {
+				u, _ := url.Parse(link)
+				assert.Equal(t, expected, scope.InScope(u), link)
+			}
+		})
+	}
+}
+
+func TestNewScope_Errors(t *testing.T) {
+	seed, _ := url.Parse("https://parserdigital.com/")
+	_, err := NewScope(seed, &model.ScopeRules{Mode: "unknown"})
+	assert.Error(t, err)
+
+	noHost, _ := url.Parse("/relative/path")
+	_, err = NewScope(noHost, nil)
+	assert.Error(t, err)
+}
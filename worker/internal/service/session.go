@@ -0,0 +1,396 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+	"worker/internal/model"
+	"worker/internal/repo"
+)
+
+// listedDepth is the depth of the pages listed in the sitemap files that are not linked from any page closer to the seed
+const listedDepth = 1
+
+// crawlSession holds the state of a single crawl job. It is created for every call to Crawl and discarded afterwards,
+// so jobs never share visited urls or sitemap pages
+type crawlSession struct {
+	scope         Scope
+	fetcher       Fetcher
+	agent         string
+	robots        map[string]*sessionRobots
+	limits        model.Limits
+	canonical     canonicalizer
+	follow        map[string]bool
+	directives    model.DirectivesPolicy
+	retry         retryPolicy
+	retriesLeft   int
+	visitedURLs   map[string]bool
+	fingerprints  map[string]fingerprint
+	sitemap       *model.Sitemap
+	frontier      *frontier
+	stats         sessionStats
+	pages         int
+	bytes         int64
+	startedAt     time.Time
+	events        chan<- model.Event
+	previous      *history
+	shared        *sharedJob
+	visitedMu     sync.Mutex
+	sitemapPageMu sync.Mutex
+	robotsMu      sync.Mutex
+}
+
+// sessionRobots holds the robots rules of a host, fetched once per session even when many workers need them
+type sessionRobots struct {
+	once  sync.Once
+	rules *robots
+}
+
+// sessionStats counts what happened to the pages during a crawl
+type sessionStats struct {
+	visited     int
+	failed      int
+	errorStatus int
+	disallowed  int
+}
+
+// newCrawlSession builds an empty session for crawling the urls in scope with the fetcher and retry policy of the job,
+// applying the limits, canonicalization rules, followed link kinds and directives policy of the request
+func newCrawlSession(req *model.Request, scope Scope, fetcher Fetcher, retry retryPolicy, maxJobRetries int) *crawlSession {
+	sess := &crawlSession{
+		retry:        retry,
+		retriesLeft:  maxJobRetries,
+		scope:        scope,
+		fetcher:      fetcher,
+		agent:        userAgent,
+		robots:       make(map[string]*sessionRobots),
+		canonical:    newCanonicalizer(req.Canonical),
+		visitedURLs:  make(map[string]bool),
+		fingerprints: make(map[string]fingerprint),
+		sitemap: &model.Sitemap{
+			Pages:    make(map[string][]string),
+			PageInfo: make(map[string]model.PageInfo),
+			Links:    make(map[string][]model.Link),
+		},
+		frontier:  newFrontier(),
+		startedAt: time.Now(),
+	}
+
+	if req.Limits != nil {
+		sess.limits = *req.Limits
+	}
+
+	if req.Directives != nil {
+		sess.directives = *req.Directives
+	}
+
+	sess.follow = map[string]bool{model.LinkNavigation: true}
+	if req.Follow != nil && len(req.Follow.Kinds) > 0 {
+		sess.follow = make(map[string]bool, len(req.Follow.Kinds))
+		for _, kind := range req.Follow.Kinds {
+			sess.follow[kind] = true
+		}
+	}
+
+	return sess
+}
+
+// seen checks if the link has been already queued
+func (cs *crawlSession) seen(link string) bool {
+	if cs.shared != nil {
+		return cs.shared.seen(link)
+	}
+
+	cs.visitedMu.Lock()
+	defer cs.visitedMu.Unlock()
+	return cs.visitedURLs[link]
+}
+
+// claim marks the link as visited and reports whether it was not visited before
+func (cs *crawlSession) claim(link string) bool {
+	if cs.shared != nil {
+		return cs.shared.claim(link)
+	}
+
+	cs.visitedMu.Lock()
+	defer cs.visitedMu.Unlock()
+
+	if cs.visitedURLs[link] {
+		return false
+	}
+	cs.visitedURLs[link] = true
+
+	return true
+}
+
+// enqueue pushes the link to the frontier unless it has been already queued or it is deeper than the depth limit. The
+// links of a distributed job are published as page tasks instead
+func (cs *crawlSession) enqueue(link string, depth int) {
+	if cs.limits.MaxDepth > 0 && depth > cs.limits.MaxDepth {
+		if !cs.seen(link) {
+			cs.truncate(model.LimitMaxDepth)
+		}
+		return
+	}
+
+	if !cs.claim(link) {
+		return
+	}
+
+	if cs.shared != nil {
+		cs.shared.push(crawlTask{url: link, depth: depth})
+	} else {
+		cs.frontier.push(crawlTask{url: link, depth: depth})
+	}
+	cs.emit(model.EventPageDiscovered, model.PageEvent{Url: link})
+}
+
+// enqueueSeeds pushes the seed and the pages listed in the sitemap files to the frontier. The listed pages are one step
+// away from the seed through the sitemap files, so they are crawled at depth 1 whatever their depth in the site
+func (cs *crawlSession) enqueueSeeds(seed string, listed []string) {
+	cs.enqueue(seed, 0)
+	for _, link := range listed {
+		cs.enqueue(link, listedDepth)
+	}
+}
+
+// reservePage counts a page about to be fetched and reports whether the page limit allows it. The pages of a
+// distributed job are counted across all the workers
+func (cs *crawlSession) reservePage() bool {
+	if cs.shared != nil && cs.limits.MaxPages > 0 {
+		return cs.shared.count(repo.CounterPages, 1) <= int64(cs.limits.MaxPages)
+	}
+
+	cs.sitemapPageMu.Lock()
+	defer cs.sitemapPageMu.Unlock()
+
+	if cs.limits.MaxPages > 0 && cs.pages >= cs.limits.MaxPages {
+		return false
+	}
+	cs.pages++
+
+	return true
+}
+
+// addBytes counts the bytes downloaded and reports whether the byte limit has been reached. The bytes of a distributed
+// job are counted across all the workers
+func (cs *crawlSession) addBytes(n int64) bool {
+	cs.sitemapPageMu.Lock()
+	cs.bytes += n
+	bytes := cs.bytes
+	cs.sitemapPageMu.Unlock()
+
+	if cs.shared != nil && cs.limits.MaxBytes > 0 {
+		return cs.shared.count(repo.CounterBytes, n) >= cs.limits.MaxBytes
+	}
+
+	return cs.limits.MaxBytes > 0 && bytes >= cs.limits.MaxBytes
+}
+
+// truncate flags the sitemap as incomplete, keeping the first limit that was hit
+func (cs *crawlSession) truncate(limit string) {
+	cs.sitemapPageMu.Lock()
+	defer cs.sitemapPageMu.Unlock()
+
+	if !cs.sitemap.Truncated {
+		cs.sitemap.Truncated = true
+		cs.sitemap.TruncatedBy = limit
+	}
+}
+
+// stop truncates the crawl and discards the pages waiting in the frontier. A distributed job is stopped for all the
+// workers
+func (cs *crawlSession) stop(limit string) {
+	cs.truncate(limit)
+	cs.frontier.close()
+
+	if cs.shared != nil {
+		cs.shared.stop(limit)
+	}
+}
+
+// addPage stores the followed links of a page, all the links found in it and its metadata
+func (cs *crawlSession) addPage(link string, links []string, found []model.Link, info model.PageInfo) {
+	cs.sitemapPageMu.Lock()
+	cs.sitemap.Pages[link] = links
+	if len(found) > 0 {
+		cs.sitemap.Links[link] = found
+	}
+	if info.Noindex {
+		cs.sitemap.Noindex = append(cs.sitemap.Noindex, link)
+	}
+	cs.sitemap.PageInfo[link] = info
+	cs.stats.visited++
+	cs.sitemapPageMu.Unlock()
+
+	cs.countShared(repo.CounterVisited)
+	cs.emit(model.EventPageFetched, model.PageEvent{Url: link, Links: links, Info: &info})
+}
+
+// addFingerprint stores the fingerprint of a page to find its duplicates when the crawl finishes
+func (cs *crawlSession) addFingerprint(link string, fp fingerprint) {
+	cs.sitemapPageMu.Lock()
+	cs.fingerprints[link] = fp
+	cs.sitemapPageMu.Unlock()
+}
+
+// addRedirect stores a requested url that redirects to another page, as a node linking to the final url
+func (cs *crawlSession) addRedirect(link, final string, info model.PageInfo) {
+	cs.sitemapPageMu.Lock()
+	cs.sitemap.Pages[link] = []string{final}
+	cs.sitemap.PageInfo[link] = info
+	cs.sitemapPageMu.Unlock()
+
+	cs.emit(model.EventPageFetched, model.PageEvent{Url: link, Links: []string{final}, Info: &info})
+}
+
+// addRedirectIssues reports the problems found in the redirect chain of a requested url
+func (cs *crawlSession) addRedirectIssues(link string, issues []string) {
+	cs.sitemapPageMu.Lock()
+	cs.sitemap.RedirectIssues = append(cs.sitemap.RedirectIssues, model.RedirectIssue{Url: link, Issues: issues})
+	cs.sitemapPageMu.Unlock()
+}
+
+// addResource stores a url that is not an HTML page in the sitemap as a leaf node with its media type
+func (cs *crawlSession) addResource(link string, info model.PageInfo) {
+	cs.sitemapPageMu.Lock()
+	if cs.sitemap.Resources == nil {
+		cs.sitemap.Resources = make(map[string]string)
+	}
+	cs.sitemap.Pages[link] = nil
+	cs.sitemap.Resources[link] = info.ContentType
+	cs.sitemap.PageInfo[link] = info
+	if info.Noindex {
+		cs.sitemap.Noindex = append(cs.sitemap.Noindex, link)
+	}
+	cs.stats.visited++
+	cs.sitemapPageMu.Unlock()
+
+	cs.countShared(repo.CounterVisited)
+	cs.emit(model.EventPageFetched, model.PageEvent{Url: link, Info: &info})
+}
+
+// markFailed records a page that could not be crawled with its error
+func (cs *crawlSession) markFailed(link string, info model.PageInfo, err error) {
+	info.Error = err.Error()
+
+	cs.sitemapPageMu.Lock()
+	cs.sitemap.PageInfo[link] = info
+	cs.sitemap.Errors = append(cs.sitemap.Errors, model.PageError{Url: link, Error: err.Error()})
+	cs.stats.failed++
+	cs.sitemapPageMu.Unlock()
+
+	cs.countShared(repo.CounterFailed)
+	cs.emit(model.EventPageFailed, model.PageEvent{Url: link, Info: &info})
+}
+
+// emit sends an event about a page with the progress of the job to the events channel of the session, when it has one.
+// The progress of a distributed job is the one shared by all the workers
+func (cs *crawlSession) emit(eventType string, page model.PageEvent) {
+	if cs.events == nil {
+		return
+	}
+
+	event := model.Event{Type: eventType, Page: page}
+
+	if cs.shared != nil {
+		event.Progress = cs.shared.progress()
+		cs.events <- event
+		return
+	}
+
+	cs.visitedMu.Lock()
+	event.Progress.Discovered = len(cs.visitedURLs)
+	cs.visitedMu.Unlock()
+
+	cs.sitemapPageMu.Lock()
+	event.Progress.Visited = cs.stats.visited
+	event.Progress.Failed = cs.stats.failed
+	event.Progress.Disallowed = cs.stats.disallowed
+	cs.sitemapPageMu.Unlock()
+
+	cs.events <- event
+}
+
+// countShared adds a page to a counter of the distributed job of the session, if it has one
+func (cs *crawlSession) countShared(counter string) {
+	if cs.shared != nil {
+		cs.shared.count(counter, 1)
+	}
+}
+
+// markErrorStatus reports a crawled page that was answered with a client or server error status
+func (cs *crawlSession) markErrorStatus(link string, status int) {
+	cs.sitemapPageMu.Lock()
+	cs.sitemap.Errors = append(cs.sitemap.Errors, model.PageError{
+		Url:   link,
+		Error: fmt.Sprintf("error status code: %d", status),
+	})
+	cs.stats.errorStatus++
+	cs.sitemapPageMu.Unlock()
+}
+
+// setOutcome counts the attempted and succeeded pages of the job and decides its outcome. The job failed when the seed
+// could not be crawled or no page succeeded, and it is partial when only some pages failed. Cancelled jobs are only
+// reported as such
+func (cs *crawlSession) setOutcome(seed string, cancelled bool) {
+	cs.sitemapPageMu.Lock()
+	defer cs.sitemapPageMu.Unlock()
+
+	sitemap := cs.sitemap
+	sitemap.Attempted = cs.stats.visited + cs.stats.failed
+	sitemap.Succeeded = cs.stats.visited - cs.stats.errorStatus
+
+	if cancelled {
+		sitemap.Outcome = model.OutcomeCancelled
+		return
+	}
+
+	info, crawled := sitemap.PageInfo[seed]
+	if !crawled {
+		for _, link := range sitemap.Disallowed {
+			if link == seed {
+				sitemap.Errors = append(sitemap.Errors, model.PageError{Url: seed, Error: "disallowed by robots file"})
+				break
+			}
+		}
+	}
+
+	switch {
+	case !crawled || info.Error != "" || info.Status >= http.StatusBadRequest || sitemap.Succeeded == 0:
+		sitemap.Outcome = model.OutcomeFailed
+	case sitemap.Succeeded < sitemap.Attempted:
+		sitemap.Outcome = model.OutcomePartial
+	default:
+		sitemap.Outcome = model.OutcomeSucceeded
+	}
+}
+
+// takeRetry uses one retry of the job budget and reports whether there was any left. The retries of a distributed job
+// are counted across all the workers, so its budget is never reset
+func (cs *crawlSession) takeRetry() bool {
+	if cs.shared != nil {
+		return cs.shared.count(repo.CounterRetries, 1) <= int64(cs.retriesLeft)
+	}
+
+	cs.sitemapPageMu.Lock()
+	defer cs.sitemapPageMu.Unlock()
+
+	if cs.retriesLeft <= 0 {
+		return false
+	}
+	cs.retriesLeft--
+
+	return true
+}
+
+// markDisallowed records the link as skipped because the robots file disallows it
+func (cs *crawlSession) markDisallowed(link string) {
+	cs.sitemapPageMu.Lock()
+	cs.sitemap.Disallowed = append(cs.sitemap.Disallowed, link)
+	cs.stats.disallowed++
+	cs.sitemapPageMu.Unlock()
+
+	cs.countShared(repo.CounterDisallowed)
+}
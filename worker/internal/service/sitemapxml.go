@@ -0,0 +1,170 @@
+package service
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const (
+	// maxSitemapFiles bounds the number of sitemap files requested for a crawl job, including nested indexes
+	maxSitemapFiles = 100
+	// maxSitemapSize is the maximum uncompressed size of a sitemap file allowed by the sitemaps protocol
+	maxSitemapSize = 50 * 1024 * 1024
+)
+
+// sitemapDocument is either an urlset listing pages or a sitemap index listing other sitemap files
+type sitemapDocument struct {
+	XMLName  xml.Name
+	URLs     []sitemapLoc `xml:"url"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+// parseSitemap parses a sitemap file, decompressing it first if it is gzipped
+func parseSitemap(r io.Reader) (*sitemapDocument, error) {
+	br := bufio.NewReader(r)
+
+	var body io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("error decompressing sitemap: %s", err))
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	doc := &sitemapDocument{}
+	if err := xml.NewDecoder(io.LimitReader(body, maxSitemapSize)).Decode(doc); err != nil {
+		return nil, errors.New(fmt.Sprintf("error parsing sitemap: %s", err))
+	}
+
+	switch doc.XMLName.Local {
+	case "urlset", "sitemapindex":
+		return doc, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("error parsing sitemap: unexpected root element %q", doc.XMLName.Local))
+}
+
+// fetchSitemap requests and parses a sitemap file. The request goes through the politeness and connection limits of
+// its host, like the requests of the pages
+func (s *crawlService) fetchSitemap(ctx context.Context, sess *crawlSession, sitemapURL string) (*sitemapDocument, error) {
+	u, err := url.Parse(sitemapURL)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error parsing sitemap url: %s", err))
+	}
+
+	delay := s.getRobots(ctx, sess, u).delay
+	release := s.hosts.acquire(u.Host)
+	defer release()
+
+	res, _, err := s.fetch(ctx, sess, http.MethodGet, u, delay)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error getting sitemap: %s", err))
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("error getting sitemap, status code: %d", res.StatusCode))
+	}
+
+	return parseSitemap(res.Body)
+}
+
+// getSitemapURLs discovers the sitemaps of the seed site, from the robots file and the default /sitemap.xml location,
+// and returns the canonical urls in scope they list, following the sitemap indexes in scope
+func (s *crawlService) getSitemapURLs(ctx context.Context, sess *crawlSession, seed *url.URL) []string {
+	queue := append([]string{}, s.getRobots(ctx, sess, seed).sitemaps...)
+	queue = append(queue, s.getOrigin(seed)+"/sitemap.xml")
+
+	requested := make(map[string]bool)
+	listed := make(map[string]bool)
+
+	for len(queue) > 0 && len(requested) < maxSitemapFiles && ctx.Err() == nil {
+		sitemapURL := queue[0]
+		queue = queue[1:]
+
+		if requested[sitemapURL] {
+			continue
+		}
+
+		// The robots file and the sitemap indexes can point anywhere, but only the sitemaps in scope are requested
+		if u, err := url.Parse(sitemapURL); err != nil || !sess.scope.InScope(u) {
+			log.Printf("skipping sitemap %s, out of the crawl scope", sitemapURL)
+			continue
+		}
+		requested[sitemapURL] = true
+
+		doc, err := s.fetchSitemap(ctx, sess, sitemapURL)
+		if err != nil {
+			log.Printf("error reading sitemap %s: %s", sitemapURL, err)
+			continue
+		}
+
+		for _, loc := range doc.Sitemaps {
+			queue = append(queue, strings.TrimSpace(loc.Loc))
+		}
+
+		for _, loc := range doc.URLs {
+			u, err := url.Parse(strings.TrimSpace(loc.Loc))
+			if err != nil {
+				continue
+			}
+
+			u = sess.canonical.canonicalize(u)
+			if sess.scope.InScope(u) {
+				listed[u.String()] = true
+			}
+		}
+	}
+
+	urls := make([]string, 0, len(listed))
+	for u := range listed {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+
+	return urls
+}
+
+// compareSitemap reports the orphan pages, listed in the sitemap files but never linked from the crawled pages, and the
+// linked pages missing from the sitemap files
+func compareSitemap(seed string, listed []string, pages map[string][]string) (orphans, missing []string) {
+	linked := map[string]bool{seed: true}
+	for _, links := range pages {
+		for _, link := range links {
+			linked[link] = true
+		}
+	}
+
+	inSitemap := make(map[string]bool, len(listed))
+	for _, u := range listed {
+		inSitemap[u] = true
+		if !linked[u] {
+			orphans = append(orphans, u)
+		}
+	}
+
+	for u := range linked {
+		if !inSitemap[u] {
+			missing = append(missing, u)
+		}
+	}
+	sort.Strings(missing)
+
+	return orphans, missing
+}
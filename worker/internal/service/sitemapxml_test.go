@@ -0,0 +1,132 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"worker/internal/model"
+	mock_service "worker/internal/service/mocks"
+)
+
+const urlSet = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<url><loc>https://parserdigital.com/</loc></url>
+	<url><loc> https://parserdigital.com/career </loc></url>
+	<url><loc>https://parserdigital.com/hidden</loc></url>
+	<url><loc>https://other.com/page</loc></url>
+</urlset>`
+
+const sitemapIndex = `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<sitemap><loc>https://parserdigital.com/sitemap-pages.xml.gz</loc></sitemap>
+</sitemapindex>`
+
+func gzipString(t *testing.T, s string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	return buf.Bytes()
+}
+
+func TestParseSitemap(t *testing.T) {
+	t.Run("Url Set", func(t *testing.T) {
+		doc, err := parseSitemap(strings.NewReader(urlSet))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "urlset", doc.XMLName.Local)
+		assert.Len(t, doc.URLs, 4)
+	})
+
+	t.Run("Sitemap Index", func(t *testing.T) {
+		doc, err := parseSitemap(strings.NewReader(sitemapIndex))
+
+		assert.NoError(t, err)
+		assert.Equal(t, []sitemapLoc{{Loc: "https://parserdigital.com/sitemap-pages.xml.gz"}}, doc.Sitemaps)
+	})
+
+	t.Run("Gzipped", func(t *testing.T) {
+		doc, err := parseSitemap(bytes.NewReader(gzipString(t, urlSet)))
+
+		assert.NoError(t, err)
+		assert.Len(t, doc.URLs, 4)
+	})
+
+	t.Run("Not A Sitemap", func(t *testing.T) {
+		_, err := parseSitemap(strings.NewReader("<html><body>Not found</body></html>"))
+
+		assert.Error(t, err)
+	})
+}
+
+func TestCompareSitemap(t *testing.T) {
+	url := "https://parserdigital.com/"
+	pages := map[string][]string{
+		url:            {url + "career", url + "contact-us"},
+		url + "career": {url},
+	}
+
+	orphans, missing := compareSitemap(url, []string{url, url + "career", url + "hidden"}, pages)
+
+	assert.Equal(t, []string{url + "hidden"}, orphans)
+	assert.Equal(t, []string{url + "contact-us"}, missing)
+}
+
+func TestCrawlService_Crawl_SitemapSeeds(t *testing.T) {
+	url := "https://parserdigital.com/"
+	mockHttp := mock_service.NewHttpMock(url)
+	mockHttp.RegisterResponders()
+	defer mockHttp.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", url+"robots.txt", httpmock.NewStringResponder(200, `User-agent: *
+Sitemap: https://parserdigital.com/sitemap-index.xml`))
+	httpmock.RegisterResponder("GET", url+"sitemap-index.xml", httpmock.NewStringResponder(200, sitemapIndex))
+	httpmock.RegisterResponder("GET", url+"sitemap-pages.xml.gz", httpmock.NewBytesResponder(200, gzipString(t, urlSet)))
+	httpmock.RegisterResponder("GET", url+"sitemap.xml", httpmock.NewStringResponder(404, "Not found"))
+	httpmock.RegisterResponder("GET", url+"hidden", httpmock.NewStringResponder(200, "Dummy text"))
+
+	sitemap := newTestCrawlerService().Crawl(context.Background(), &model.Request{Url: url}, nil)
+
+	assert.Len(t, sitemap.Pages, 11)
+	assert.Contains(t, sitemap.Pages, url+"hidden")
+	assert.Equal(t, []string{url + "hidden"}, sitemap.Orphans)
+	assert.NotContains(t, sitemap.MissingFromSitemap, url+"career")
+	assert.Contains(t, sitemap.MissingFromSitemap, url+"how-we-work")
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["GET "+url+"sitemap.xml"])
+
+	// The listed pages are one step away from the seed, so they do not bypass the depth limit
+	assert.Equal(t, 1, sitemap.PageInfo[url+"hidden"].Depth)
+	assert.Equal(t, 1, sitemap.PageInfo[url+"career"].Depth)
+
+	limited := newTestCrawlerService().Crawl(context.Background(), &model.Request{
+		Url:    url,
+		Limits: &model.Limits{MaxDepth: 1},
+	}, nil)
+
+	assert.Contains(t, limited.Pages, url+"hidden")
+	assert.NotContains(t, limited.Pages, url+"apply")
+	assert.Equal(t, model.LimitMaxDepth, limited.TruncatedBy)
+
+	t.Run("Out Of Scope", func(t *testing.T) {
+		httpmock.RegisterResponder("GET", url+"robots.txt", httpmock.NewStringResponder(200, `User-agent: *
+Sitemap: https://other.com/sitemap.xml
+Sitemap: https://parserdigital.com/sitemap-index.xml`))
+		httpmock.RegisterResponder("GET", url+"sitemap-index.xml", httpmock.NewStringResponder(200,
+			`<sitemapindex><sitemap><loc>https://tracker.com/sitemap.xml</loc></sitemap></sitemapindex>`))
+		httpmock.RegisterResponder("GET", "https://other.com/sitemap.xml", httpmock.NewStringResponder(200, urlSet))
+		httpmock.RegisterResponder("GET", "https://tracker.com/sitemap.xml", httpmock.NewStringResponder(200, urlSet))
+
+		// The sitemaps of other hosts are not requested, wherever they are found
+		newTestCrawlerService().Crawl(context.Background(), &model.Request{Url: url}, nil)
+
+		assert.Equal(t, 0, httpmock.GetCallCountInfo()["GET https://other.com/sitemap.xml"])
+		assert.Equal(t, 0, httpmock.GetCallCountInfo()["GET https://tracker.com/sitemap.xml"])
+	})
+}
@@ -3,8 +3,10 @@ package main
 import (
 	"github.com/joho/godotenv"
 	"log"
+	"os"
 	"worker/internal/handler"
 	"worker/internal/infra"
+	"worker/internal/repo"
 	"worker/internal/service"
 )
 
@@ -14,7 +16,50 @@ func main() {
 	}
 
 	amqpClient := infra.NewAMQPClient()
-	crawlerService := service.NewCrawlerService()
+	config := service.NewConfigFromEnv()
+	fetcher, err := service.NewFetcher(config.Fetch)
+	if err != nil {
+		log.Fatalf("error building the http fetcher: %s", err)
+	}
+
+	// Redis shares the checkpoints between the workers, while the files only resume the jobs of a restarted worker
+	var checkpointRepo repo.CheckpointRepo
+	switch store := os.Getenv("CHECKPOINT_STORE"); store {
+	case "redis":
+		checkpointRepo = repo.NewRedisCheckpointRepository(infra.NewRedisClient())
+	case "file":
+		checkpointRepo = repo.NewFileCheckpointRepository(os.Getenv("CHECKPOINT_DIR"))
+	case "":
+	default:
+		log.Fatalf("unknown checkpoint store %q", store)
+	}
+
+	// The history keeps the last crawl of each site, to only download the pages that changed since then
+	var historyRepo repo.HistoryRepo
+	switch store := os.Getenv("HISTORY_STORE"); store {
+	case "redis":
+		historyRepo = repo.NewRedisHistoryRepository(infra.NewRedisClient())
+	case "":
+	default:
+		log.Fatalf("unknown history store %q", store)
+	}
+
+	// The fleet shares the distributed jobs and the politeness of the hosts between the workers
+	var fleet *service.Fleet
+	switch store := os.Getenv("FLEET_STORE"); store {
+	case "redis":
+		redisClient := infra.NewRedisClient()
+		fleet = &service.Fleet{
+			Jobs:  repo.NewRedisJobRepository(redisClient),
+			Hosts: repo.NewRedisHostRepository(redisClient),
+			Tasks: amqpClient,
+		}
+	case "":
+	default:
+		log.Fatalf("unknown fleet store %q", store)
+	}
+
+	crawlerService := service.NewCrawlerService(config, fetcher, checkpointRepo, historyRepo, fleet)
 	crawlerHandler := handler.NewCrawlerHandler(amqpClient, crawlerService)
 	crawlerHandler.Process()
 }